@@ -12,6 +12,7 @@ require (
 	github.com/onsi/gomega v1.8.1
 	github.com/pkg/errors v0.9.1
 	github.com/prometheus-operator/prometheus-operator v0.42.0
+	github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring v0.42.0
 	github.com/spf13/cobra v1.0.0
 	github.com/spf13/pflag v1.0.5
 	go.bytebuilders.dev/license-verifier v0.3.0
@@ -23,6 +24,7 @@ require (
 	k8s.io/apimachinery v0.18.9
 	k8s.io/apiserver v0.18.9
 	k8s.io/client-go v0.18.9
+	k8s.io/component-base v0.18.9
 	k8s.io/kube-aggregator v0.18.9
 	kmodules.xyz/client-go v0.0.0-20201011221802-3180ab67d845
 	kmodules.xyz/constants v0.0.0-20200506032633-a21e58ceec72
@@ -32,6 +34,7 @@ require (
 	kmodules.xyz/offshoot-api v0.0.0-20200922211229-36acc531abab
 	kmodules.xyz/webhook-runtime v0.0.0-20200922211931-8337935590de
 	kubedb.dev/apimachinery v0.14.0-beta.3.0.20201011231523-97c32f71c3c7
+	sigs.k8s.io/yaml v1.2.0
 	stash.appscode.dev/apimachinery v0.11.2
 )
 
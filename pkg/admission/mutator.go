@@ -110,7 +110,10 @@ func (a *PerconaXtraDBMutator) Admit(req *admission.AdmissionRequest) *admission
 	return status
 }
 
-// setDefaultValues provides the defaulting that is performed in mutating stage of creating/updating a MySQL database
+// setDefaultValues fills the spec fields a user may leave out before the
+// object is persisted; see PerconaXtraDB.SetDefaults for the list of defaulted
+// fields. Explicit values are never overwritten, so re-applying the mutation
+// is idempotent.
 func setDefaultValues(px *api.PerconaXtraDB) (runtime.Object, error) {
 	if px.Spec.Version == "" {
 		return nil, errors.New(`'spec.version' is missing`)
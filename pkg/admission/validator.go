@@ -19,26 +19,35 @@ package admission
 import (
 	"context"
 	"fmt"
+	"net"
+	"regexp"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"kubedb.dev/apimachinery/apis/kubedb"
 	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
 	cs "kubedb.dev/apimachinery/client/clientset/versioned"
 	amv "kubedb.dev/apimachinery/pkg/validator"
 
+	"github.com/appscode/go/log"
 	"github.com/pkg/errors"
 	"gomodules.xyz/sets"
 	admission "k8s.io/api/admission/v1beta1"
+	core "k8s.io/api/core/v1"
 	kerr "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/mergepatch"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	kmapi "kmodules.xyz/client-go/api/v1"
 	meta_util "kmodules.xyz/client-go/meta"
+	mona "kmodules.xyz/monitoring-agent-api/api/v1"
 	hookapi "kmodules.xyz/webhook-runtime/admission/v1beta1"
 )
 
@@ -54,9 +63,38 @@ var _ hookapi.AdmissionHook = &PerconaXtraDBValidator{}
 
 var forbiddenEnvVars = []string{
 	"MYSQL_ROOT_PASSWORD",
+	"MYSQL_ROOT_USERNAME",
 	"MYSQL_ALLOW_EMPTY_PASSWORD",
 	"MYSQL_RANDOM_ROOT_PASSWORD",
 	"MYSQL_ONETIME_PASSWORD",
+	"CLUSTER_NAME",
+}
+
+// reservedContainerNames are the container names the operator manages itself.
+// A user supplied init container reusing one of them would silently be
+// replaced when the operator upserts its own containers.
+var reservedContainerNames = []string{
+	api.ResourceSingularPerconaXtraDB,
+	api.ContainerExporterName,
+	"remove-lost-found",
+	"stage-init-script",
+	"proxysql",
+	"px-coordinator",
+	"audit-forwarder",
+}
+
+// reservedMountPaths are the mount paths the operator wires up itself. A user
+// supplied volume mount on one of them would shadow the data, configuration or
+// script volumes the server depends on.
+var reservedMountPaths = []string{
+	api.PerconaXtraDBDataMountPath,
+	api.PerconaXtraDBLogMountPath,
+	api.PerconaXtraDBInitDBMountPath,
+	api.PerconaXtraDBCustomConfigMountPath,
+	api.PerconaXtraDBClusterCustomConfigMountPath,
+	api.PerconaXtraDBCustomCAMountPath,
+	api.PerconaXtraDBPreStartScriptMountPath,
+	api.PerconaXtraDBKeyringVaultConfigMountPath,
 }
 
 // Resource is the resource to use for hosting validating admission webhook.
@@ -135,12 +173,26 @@ func (a *PerconaXtraDBValidator) Admit(req *admission.AdmissionRequest) *admissi
 				oldPXC.Spec.DatabaseSecret = px.Spec.DatabaseSecret
 			}
 
+			if err := validateVersionTransition(oldPXC, px); err != nil {
+				return hookapi.StatusForbidden(err)
+			}
+
+			if err := validateEncryptionTransition(oldPXC, px); err != nil {
+				return hookapi.StatusForbidden(err)
+			}
+
+			if err := validateStorageTransition(oldPXC, px); err != nil {
+				return hookapi.StatusForbidden(err)
+			}
+
 			if err := validateUpdate(px, oldPXC, px.Status.Conditions); err != nil {
 				return hookapi.StatusBadRequest(fmt.Errorf("%v", err))
 			}
 		}
-		// validate database specs
-		if err = ValidatePerconaXtraDB(a.client, a.extClient, obj.(*api.PerconaXtraDB), false); err != nil {
+		// validate database specs. Dry-run admission requests must not depend
+		// on any cluster state side effects.
+		dryRun := req.DryRun != nil && *req.DryRun
+		if err = ValidatePerconaXtraDB(a.client, a.extClient, obj.(*api.PerconaXtraDB), false, dryRun); err != nil {
 			return hookapi.StatusForbidden(err)
 		}
 	}
@@ -156,8 +208,757 @@ func validateCluster(px *api.PerconaXtraDB) error {
 			return errors.Errorf(`'spec.px.clusterName' "%s" shouldn't have more than %d characters'`,
 				clusterName, api.PerconaXtraDBMaxClusterNameLength)
 		}
-		if px.Spec.Init != nil && px.Spec.Init.Script != nil {
-			return fmt.Errorf("`.spec.init.scriptSource` is not supported for cluster. For PerconaXtraDB cluster initialization see https://stash.run/docs/latest/addons/percona-xtradb/guides/5.7/clusterd/")
+	}
+
+	return nil
+}
+
+// validateArbiter checks whether the Galera arbiter configuration is ok. An
+// arbiter only makes sense alongside cluster mode, where it joins the quorum
+// vote without storing data.
+func validateArbiter(px *api.PerconaXtraDB) error {
+	if px.Spec.Arbiter == nil {
+		return nil
+	}
+	if !px.IsCluster() {
+		return errors.New(`'spec.arbiter' is only supported for cluster mode`)
+	}
+	if px.Spec.Arbiter.Replicas != nil && *px.Spec.Arbiter.Replicas < 1 {
+		return errors.Errorf(`'spec.arbiter.replicas' "%v" invalid. Value must be at least 1`, *px.Spec.Arbiter.Replicas)
+	}
+	return nil
+}
+
+// validateProxySQL checks whether the built-in ProxySQL sidecar configuration is ok
+func validateProxySQL(px *api.PerconaXtraDB) error {
+	if px.Spec.ProxySQL == nil {
+		return nil
+	}
+	if px.Spec.ProxySQL.Image == "" {
+		return errors.New(`'spec.proxysql.image' is missing`)
+	}
+	return nil
+}
+
+// validateCoordinator checks whether the coordinator sidecar configuration is
+// ok. The coordinator evaluates wsrep state, which only exists in cluster mode.
+func validateCoordinator(px *api.PerconaXtraDB) error {
+	if px.Spec.Coordinator == nil {
+		return nil
+	}
+	if !px.IsCluster() {
+		return errors.New(`'spec.coordinator' is only supported for cluster mode`)
+	}
+	return nil
+}
+
+// validateAuditLog checks whether the audit log configuration in
+// 'spec.auditLog' is ok.
+func validateAuditLog(px *api.PerconaXtraDB) error {
+	if px.Spec.AuditLog == nil {
+		return nil
+	}
+	switch px.Spec.AuditLog.Format {
+	case "", api.AuditLogFormatJSON, api.AuditLogFormatOld, api.AuditLogFormatNew:
+	default:
+		return errors.Errorf(`'spec.auditLog.format' "%v" invalid. Supported formats are JSON, OLD and NEW`, px.Spec.AuditLog.Format)
+	}
+	return nil
+}
+
+// validateHealthChecker checks whether the health check tuning in
+// 'spec.healthChecker' is ok
+func validateHealthChecker(px *api.PerconaXtraDB) error {
+	hc := px.Spec.HealthChecker
+	if hc == nil {
+		return nil
+	}
+	if hc.PeriodSeconds != nil && *hc.PeriodSeconds < 1 {
+		return errors.Errorf(`'spec.healthChecker.periodSeconds' "%v" invalid. Value must be at least 1`, *hc.PeriodSeconds)
+	}
+	if hc.TimeoutSeconds != nil && *hc.TimeoutSeconds < 1 {
+		return errors.Errorf(`'spec.healthChecker.timeoutSeconds' "%v" invalid. Value must be at least 1`, *hc.TimeoutSeconds)
+	}
+	if hc.FailureThreshold != nil && *hc.FailureThreshold < 1 {
+		return errors.Errorf(`'spec.healthChecker.failureThreshold' "%v" invalid. Value must be at least 1`, *hc.FailureThreshold)
+	}
+	if hc.MaxReplicationLag != nil && *hc.MaxReplicationLag < 1 {
+		return errors.Errorf(`'spec.healthChecker.maxReplicationLag' "%v" invalid. Value must be at least 1`, *hc.MaxReplicationLag)
+	}
+	return nil
+}
+
+// validateStorageAutoScaler checks the datadir usage monitoring configuration
+// in 'spec.storageAutoScaler'
+func validateStorageAutoScaler(px *api.PerconaXtraDB) error {
+	sas := px.Spec.StorageAutoScaler
+	if sas == nil {
+		return nil
+	}
+	if px.Spec.StorageType != api.StorageTypeDurable {
+		return errors.New(`'spec.storageAutoScaler' requires 'spec.storageType' "Durable"`)
+	}
+	if sas.UsageThresholdPercent != nil && (*sas.UsageThresholdPercent < 1 || *sas.UsageThresholdPercent > 100) {
+		return errors.Errorf(`'spec.storageAutoScaler.usageThresholdPercent' "%v" invalid. Value must be between 1 and 100`, *sas.UsageThresholdPercent)
+	}
+	if sas.ScalingThresholdPercent != nil {
+		if *sas.ScalingThresholdPercent < 1 || *sas.ScalingThresholdPercent > 100 {
+			return errors.Errorf(`'spec.storageAutoScaler.scalingThresholdPercent' "%v" invalid. Value must be between 1 and 100`, *sas.ScalingThresholdPercent)
+		}
+		if sas.ScalingIncrement == nil || sas.ScalingIncrement.Sign() <= 0 {
+			return errors.New(`'spec.storageAutoScaler.scalingThresholdPercent' requires a positive 'spec.storageAutoScaler.scalingIncrement'`)
+		}
+	}
+	if sas.MaxStorage != nil && px.Spec.Storage != nil {
+		if request, found := px.Spec.Storage.Resources.Requests[core.ResourceStorage]; found && sas.MaxStorage.Cmp(request) < 0 {
+			return errors.Errorf(`'spec.storageAutoScaler.maxStorage' "%v" invalid. Value must not be less than the storage request "%v"`, sas.MaxStorage, &request)
+		}
+	}
+	return nil
+}
+
+// validateTLSSANs checks the user-provided subject alt names under
+// 'spec.tls.certificates': DNS names must be valid subdomains, with a single
+// leading wildcard label allowed, and IP addresses must parse.
+func validateTLSSANs(px *api.PerconaXtraDB) error {
+	if px.Spec.TLS == nil {
+		return nil
+	}
+	for _, cert := range px.Spec.TLS.Certificates {
+		for _, name := range cert.DNSNames {
+			host := strings.TrimPrefix(name, "*.")
+			if errs := validation.IsDNS1123Subdomain(host); len(errs) > 0 {
+				return fmt.Errorf(`'spec.tls.certificates[%s].dnsNames' entry %q is not a valid DNS name: %s`, cert.Alias, name, errs[0])
+			}
+		}
+		for _, ip := range cert.IPAddresses {
+			if net.ParseIP(ip) == nil {
+				return fmt.Errorf(`'spec.tls.certificates[%s].ipAddresses' entry %q is not a valid IP address`, cert.Alias, ip)
+			}
+		}
+	}
+	return nil
+}
+
+// validateReplicationMode checks 'spec.replicationMode' and rejects Galera
+// specific fields on async source-replica clusters, where they have no
+// meaning.
+func validateReplicationMode(px *api.PerconaXtraDB) error {
+	mode := px.Spec.ReplicationMode
+	if mode == "" {
+		return nil
+	}
+	if !px.IsCluster() {
+		return fmt.Errorf(`'spec.replicationMode' can only be used for xtradb cluster`)
+	}
+	switch mode {
+	case api.PerconaXtraDBReplicationModeGalera:
+		return nil
+	case api.PerconaXtraDBReplicationModeAsyncSourceReplica:
+	default:
+		return fmt.Errorf(`'spec.replicationMode' %q is invalid. Supported modes are %q and %q`,
+			mode, api.PerconaXtraDBReplicationModeGalera, api.PerconaXtraDBReplicationModeAsyncSourceReplica)
+	}
+
+	galeraOnly := []struct {
+		field string
+		set   bool
+	}{
+		{"spec.sstMethod", px.Spec.SSTMethod != ""},
+		{"spec.wsrepProviderOptions", len(px.Spec.WsrepProviderOptions) > 0},
+		{"spec.clusterAddressStrategy", px.Spec.ClusterAddressStrategy != ""},
+		{"spec.replicationPort", px.Spec.ReplicationPort != nil},
+		{"spec.allowUnsafeRecovery", px.Spec.AllowUnsafeRecovery},
+		{"spec.arbiter", px.Spec.Arbiter != nil},
+		{"spec.coordinator", px.Spec.Coordinator != nil},
+	}
+	for _, galera := range galeraOnly {
+		if galera.set {
+			return fmt.Errorf(`'%s' can only be used with 'spec.replicationMode: %s'`, galera.field, api.PerconaXtraDBReplicationModeGalera)
+		}
+	}
+	return nil
+}
+
+// validateUpdateStrategy checks 'spec.updateStrategy'. A canary rollout needs
+// more than one pod, so it is rejected for standalone databases.
+func validateUpdateStrategy(px *api.PerconaXtraDB) error {
+	strategy := px.Spec.UpdateStrategy
+	if strategy == nil {
+		return nil
+	}
+	switch strategy.Type {
+	case api.UpdateStrategyRollingUpdate, api.UpdateStrategyCanary:
+	case "":
+		return errors.New(`'spec.updateStrategy.type' is missing`)
+	default:
+		return errors.Errorf(`'spec.updateStrategy.type' %q is invalid. Supported types are %q and %q`,
+			strategy.Type, api.UpdateStrategyRollingUpdate, api.UpdateStrategyCanary)
+	}
+	if strategy.Type == api.UpdateStrategyCanary && !px.IsCluster() {
+		return errors.Errorf(`'spec.updateStrategy.type' %q can only be used for xtradb cluster`, api.UpdateStrategyCanary)
+	}
+	if strategy.Abort && strategy.Type != api.UpdateStrategyCanary {
+		return errors.Errorf(`'spec.updateStrategy.abort' can only be used with 'spec.updateStrategy.type: %s'`, api.UpdateStrategyCanary)
+	}
+	return nil
+}
+
+// validatePorts checks 'spec.port' and 'spec.replicationPort' for range
+// errors and collisions with the other ports a database pod listens on.
+func validatePorts(px *api.PerconaXtraDB) error {
+	if px.Spec.Port != nil && (*px.Spec.Port < 1 || *px.Spec.Port > 65535) {
+		return errors.Errorf(`'spec.port' "%v" invalid. Value must be between 1 and 65535`, *px.Spec.Port)
+	}
+	if px.Spec.ReplicationPort != nil {
+		if !px.IsCluster() {
+			return errors.New(`'spec.replicationPort' can only be used for xtradb cluster`)
+		}
+		// incremental state transfer listens on the next port up
+		if *px.Spec.ReplicationPort < 1 || *px.Spec.ReplicationPort > 65534 {
+			return errors.Errorf(`'spec.replicationPort' "%v" invalid. Value must be between 1 and 65534`, *px.Spec.ReplicationPort)
+		}
+	}
+
+	sqlPort := px.SQLPort()
+	if px.IsCluster() {
+		// port 4444 receives the state snapshot regardless of the method
+		if sqlPort == px.GaleraReplicationPort() || sqlPort == px.GaleraReplicationPort()+1 || sqlPort == 4444 {
+			return errors.Errorf(`'spec.port' "%v" collides with the galera replication or SST ports`, sqlPort)
+		}
+	}
+	if px.Spec.Monitor != nil && px.Spec.Monitor.Prometheus != nil && px.Spec.Monitor.Prometheus.Exporter.Port == sqlPort {
+		return errors.Errorf(`'spec.port' "%v" collides with the metrics exporter port`, sqlPort)
+	}
+	return nil
+}
+
+// validateAutoTuneBufferPool checks that the buffer pool percentage in
+// 'spec.autoTuneBufferPool' leaves room for the rest of the server.
+func validateAutoTuneBufferPool(px *api.PerconaXtraDB) error {
+	at := px.Spec.AutoTuneBufferPool
+	if at == nil || at.MemoryPercentage == nil {
+		return nil
+	}
+	if *at.MemoryPercentage < 1 || *at.MemoryPercentage > 90 {
+		return errors.Errorf(`'spec.autoTuneBufferPool.memoryPercentage' "%v" invalid. Value must be between 1 and 90`, *at.MemoryPercentage)
+	}
+	return nil
+}
+
+// validateAllowedSchemas checks that the selectors in 'spec.allowedSchemas'
+// compile, so the enforcing NetworkPolicy can not end up malformed.
+func validateAllowedSchemas(px *api.PerconaXtraDB) error {
+	as := px.Spec.AllowedSchemas
+	if as == nil {
+		return nil
+	}
+	if as.NamespaceSelector != nil {
+		if _, err := metav1.LabelSelectorAsSelector(as.NamespaceSelector); err != nil {
+			return errors.Wrap(err, `'spec.allowedSchemas.namespaceSelector' is invalid`)
+		}
+	}
+	if as.Selector != nil {
+		if _, err := metav1.LabelSelectorAsSelector(as.Selector); err != nil {
+			return errors.Wrap(err, `'spec.allowedSchemas.selector' is invalid`)
+		}
+	}
+	return nil
+}
+
+// validateServiceTemplates checks whether the templates in
+// 'spec.serviceTemplates' are ok. The governing service backs the StatefulSet
+// pod DNS and must stay headless, so its template may not change the type or
+// the clusterIP.
+func validateServiceTemplates(px *api.PerconaXtraDB) error {
+	for _, template := range px.Spec.ServiceTemplates {
+		switch template.Spec.Type {
+		case "", core.ServiceTypeClusterIP, core.ServiceTypeNodePort, core.ServiceTypeLoadBalancer:
+		default:
+			return errors.Errorf(`'spec.serviceTemplates' type "%v" invalid. Supported types are ClusterIP, NodePort and LoadBalancer`, template.Spec.Type)
+		}
+		if template.Alias == api.PerconaXtraDBGoverningServiceAlias &&
+			(template.Spec.Type != "" || template.Spec.ClusterIP != "") {
+			return errors.New(`'spec.serviceTemplates' must not set the type or clusterIP of the governing service`)
+		}
+	}
+	return nil
+}
+
+// validateWsrepProviderOptions checks whether the Galera provider options in
+// 'spec.wsrepProviderOptions' are ok. The serialized string uses "=" and ";"
+// as separators, so neither may appear in a key or value.
+func validateWsrepProviderOptions(px *api.PerconaXtraDB) error {
+	if len(px.Spec.WsrepProviderOptions) == 0 {
+		return nil
+	}
+	if !px.IsCluster() {
+		return errors.New(`'spec.wsrepProviderOptions' is only supported for cluster mode`)
+	}
+	for key, value := range px.Spec.WsrepProviderOptions {
+		if key == "" {
+			return errors.New(`'spec.wsrepProviderOptions' contains an empty key`)
+		}
+		if strings.ContainsAny(key, `=;"`) || strings.ContainsAny(value, `=;"`) {
+			return errors.Errorf(`'spec.wsrepProviderOptions' entry %q invalid. Keys and values must not contain '=', ';' or '"'`, key)
+		}
+		// the socket.ssl options are managed by the operator when replication
+		// TLS is enabled; overriding them would break the encrypted links
+		if px.Spec.TLS != nil && strings.HasPrefix(key, "socket.ssl") {
+			return errors.Errorf(`'spec.wsrepProviderOptions' must not set %q when TLS is enabled`, key)
+		}
+	}
+	return nil
+}
+
+// validateMaintenanceWindow checks that 'spec.maintenanceWindow' uses valid
+// weekday names and "HH:MM" times.
+func validateMaintenanceWindow(px *api.PerconaXtraDB) error {
+	mw := px.Spec.MaintenanceWindow
+	if mw == nil {
+		return nil
+	}
+	for _, day := range mw.Days {
+		valid := false
+		for d := time.Sunday; d <= time.Saturday; d++ {
+			if strings.EqualFold(day, d.String()) {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return errors.Errorf(`'spec.maintenanceWindow.days' "%v" invalid. Value must be a weekday name, i.e "Saturday"`, day)
+		}
+	}
+	if _, err := time.Parse("15:04", mw.Start); err != nil {
+		return errors.Errorf(`'spec.maintenanceWindow.start' "%v" invalid. Value must be in "HH:MM" format`, mw.Start)
+	}
+	if _, err := time.Parse("15:04", mw.End); err != nil {
+		return errors.Errorf(`'spec.maintenanceWindow.end' "%v" invalid. Value must be in "HH:MM" format`, mw.End)
+	}
+	return nil
+}
+
+// validateInit checks whether the initialization options are coherent. The init
+// script and waiting for a Stash restore are mutually exclusive, as both want to
+// populate the fresh data directory.
+func validateInit(px *api.PerconaXtraDB) error {
+	if px.Spec.Init != nil && px.Spec.Init.Script != nil && px.Spec.Init.WaitForInitialRestore {
+		return errors.New("`.spec.init.script` can not be combined with `.spec.init.waitForInitialRestore`")
+	}
+	if px.Spec.Init != nil && px.Spec.Init.WaitForInitialRestoreTimeoutSeconds != nil {
+		if !px.Spec.Init.WaitForInitialRestore {
+			return errors.New("`.spec.init.waitForInitialRestoreTimeoutSeconds` requires `.spec.init.waitForInitialRestore`")
+		}
+		if *px.Spec.Init.WaitForInitialRestoreTimeoutSeconds < 1 {
+			return errors.Errorf("`.spec.init.waitForInitialRestoreTimeoutSeconds` \"%v\" invalid. Value must be at least 1", *px.Spec.Init.WaitForInitialRestoreTimeoutSeconds)
+		}
+	}
+	return nil
+}
+
+// validateVersionTransition rejects version downgrades and major version jumps.
+// Only minor/patch upgrades within the same major version are performed in place.
+// Catalog names that are not plain dotted versions are left to the catalog validation.
+func validateVersionTransition(old, cur *api.PerconaXtraDB) error {
+	if old.Spec.Version == cur.Spec.Version {
+		return nil
+	}
+	oldVersion, okOld := parseVersion(old.Spec.Version)
+	curVersion, okCur := parseVersion(cur.Spec.Version)
+	if !okOld || !okCur {
+		return nil
+	}
+
+	if oldVersion[0] != curVersion[0] {
+		return errors.Errorf(`major version upgrade from %q to %q is not supported. Restore into a new database instead`, old.Spec.Version, cur.Spec.Version)
+	}
+	for i := 1; i < len(oldVersion) && i < len(curVersion); i++ {
+		if curVersion[i] != oldVersion[i] {
+			if curVersion[i] < oldVersion[i] {
+				return errors.Errorf(`downgrade from %q to %q is not supported`, old.Spec.Version, cur.Spec.Version)
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// parseVersion parses a dotted version string, i.e. "8.0.26", into its numeric parts.
+func parseVersion(version string) ([]int, bool) {
+	parts := strings.Split(version, ".")
+	out := make([]int, 0, len(parts))
+	for _, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, false
+		}
+		out = append(out, n)
+	}
+	return out, len(out) > 0
+}
+
+// validateUsers checks whether the declaratively managed users in 'spec.users' are ok
+func validateUsers(px *api.PerconaXtraDB) error {
+	names := sets.NewString()
+	for _, user := range px.Spec.Users {
+		if user.Name == "" {
+			return errors.New(`'spec.users[].name' is missing`)
+		}
+		if user.Name == "root" {
+			return errors.New(`'spec.users' must not manage the "root" user`)
+		}
+		// the operator provisions and rotates the "repl" user itself on async
+		// source-replica clusters
+		if user.Name == "repl" && px.UsesAsyncReplication() {
+			return errors.Errorf(`'spec.users' must not manage the %q user with 'spec.replicationMode: %s'`,
+				user.Name, api.PerconaXtraDBReplicationModeAsyncSourceReplica)
+		}
+		if strings.ContainsAny(user.Name, "'`\"@%") {
+			return errors.Errorf(`'spec.users[].name' %q contains forbidden characters`, user.Name)
+		}
+		if names.Has(user.Name) {
+			return errors.Errorf(`duplicate user %q in 'spec.users'`, user.Name)
+		}
+		names.Insert(user.Name)
+		if user.PasswordSecret.Name == "" {
+			return errors.Errorf(`'spec.users[].passwordSecret' is missing for user %q`, user.Name)
+		}
+		for _, grant := range user.Grants {
+			if err := validateGrant(grant); err != nil {
+				return errors.Wrapf(err, `invalid 'spec.users[].grants' entry for user %q`, user.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// grantPrivileges lists the privilege keywords accepted in
+// 'spec.users[].grants'. Server administration privileges like SUPER, FILE
+// and SHUTDOWN are deliberately absent.
+var grantPrivileges = sets.NewString(
+	"ALL", "ALL PRIVILEGES", "ALTER", "ALTER ROUTINE", "CREATE",
+	"CREATE ROUTINE", "CREATE TEMPORARY TABLES", "CREATE VIEW", "DELETE",
+	"DROP", "EVENT", "EXECUTE", "INDEX", "INSERT", "LOCK TABLES",
+	"PROCESS", "REFERENCES", "RELOAD", "REPLICATION CLIENT",
+	"REPLICATION SLAVE", "SELECT", "SHOW DATABASES", "SHOW VIEW",
+	"TRIGGER", "UPDATE", "USAGE",
+)
+
+// grantObjectRegexp matches the db.table part of a grant clause: plain
+// identifiers or the "*" wildcard on either side.
+var grantObjectRegexp = regexp.MustCompile(`^(\*|[0-9A-Za-z$_]+)\.(\*|[0-9A-Za-z$_]+)$`)
+
+// validateGrant checks one 'spec.users[].grants' clause, i.e.
+// "SELECT, INSERT ON mydb.*". The clauses are interpolated into GRANT
+// statements by the operator, so only allowlisted privilege keywords and
+// plain identifiers are accepted.
+func validateGrant(grant string) error {
+	idx := strings.Index(strings.ToUpper(grant), " ON ")
+	if idx < 0 {
+		return errors.Errorf(`grant %q must have the form "<privileges> ON <db>.<table>"`, grant)
+	}
+	for _, priv := range strings.Split(grant[:idx], ",") {
+		priv = strings.ToUpper(strings.Join(strings.Fields(priv), " "))
+		if !grantPrivileges.Has(priv) {
+			return errors.Errorf(`grant %q contains unsupported privilege %q`, grant, priv)
+		}
+	}
+	if object := strings.TrimSpace(grant[idx+4:]); !grantObjectRegexp.MatchString(object) {
+		return errors.Errorf(`grant %q must target a plain "<db>.<table>" object, optionally with "*" wildcards`, grant)
+	}
+	return nil
+}
+
+// identifierRegexp matches the unquoted identifier characters MySQL permits;
+// schema names, charsets and collations are interpolated into DDL, so nothing
+// beyond this set is accepted.
+var identifierRegexp = regexp.MustCompile(`^[0-9A-Za-z$_]+$`)
+
+// validateDatabases checks whether the declaratively managed schemas in
+// 'spec.databases' are ok.
+func validateDatabases(px *api.PerconaXtraDB) error {
+	names := sets.NewString()
+	for _, db := range px.Spec.Databases {
+		if db.Name == "" {
+			return errors.New(`'spec.databases[].name' is missing`)
+		}
+		switch db.Name {
+		case "mysql", "sys", "information_schema", "performance_schema":
+			return errors.Errorf(`'spec.databases' must not manage the system schema %q`, db.Name)
+		}
+		if len(db.Name) > 64 || !identifierRegexp.MatchString(db.Name) {
+			return errors.Errorf(`'spec.databases[].name' %q is not a valid schema name`, db.Name)
+		}
+		if names.Has(db.Name) {
+			return errors.Errorf(`duplicate schema %q in 'spec.databases'`, db.Name)
+		}
+		names.Insert(db.Name)
+		if db.Charset != "" && !identifierRegexp.MatchString(db.Charset) {
+			return errors.Errorf(`'spec.databases[].charset' %q is not a valid character set name`, db.Charset)
+		}
+		if db.Collation != "" && !identifierRegexp.MatchString(db.Collation) {
+			return errors.Errorf(`'spec.databases[].collation' %q is not a valid collation name`, db.Collation)
+		}
+	}
+	return nil
+}
+
+// validateTopologySpreadConstraints checks that user supplied constraints in
+// 'spec.podTemplate.spec.topologySpreadConstraints' only select labels the
+// generated pods actually carry; anything else silently matches no pods and
+// the constraint would never take effect.
+func validateTopologySpreadConstraints(px *api.PerconaXtraDB) error {
+	podLabels := px.OffshootSelectors()
+	for _, constraint := range px.Spec.PodTemplate.Spec.TopologySpreadConstraints {
+		if constraint.LabelSelector == nil {
+			continue
+		}
+		for key := range constraint.LabelSelector.MatchLabels {
+			if _, ok := podLabels[key]; !ok {
+				return errors.Errorf(`'spec.podTemplate.spec.topologySpreadConstraints' selects label %q which is not present on the database pods`, key)
+			}
+		}
+		for _, expr := range constraint.LabelSelector.MatchExpressions {
+			if _, ok := podLabels[expr.Key]; !ok {
+				return errors.Errorf(`'spec.podTemplate.spec.topologySpreadConstraints' selects label %q which is not present on the database pods`, expr.Key)
+			}
+		}
+	}
+	return nil
+}
+
+// validateReadinessProbe checks whether a user supplied readiness probe keeps
+// the cluster health semantics intact. For cluster mode a custom command must
+// still inspect the wsrep state, otherwise unsynced joiners would be served
+// traffic.
+func validateReadinessProbe(px *api.PerconaXtraDB) error {
+	probe := px.Spec.PodTemplate.Spec.ReadinessProbe
+	if probe == nil || !px.IsCluster() {
+		return nil
+	}
+	if probe.HTTPGet != nil || probe.TCPSocket != nil {
+		return errors.New(`'spec.podTemplate.spec.readinessProbe' for cluster must use an exec command that checks the wsrep state`)
+	}
+	if probe.Exec != nil {
+		cmd := strings.Join(probe.Exec.Command, " ")
+		// the defaulted /cluster-check.sh probe already inspects the wsrep state
+		if !strings.Contains(cmd, "wsrep") && !strings.Contains(cmd, "cluster-check") {
+			return errors.New(`'spec.podTemplate.spec.readinessProbe' command for cluster must check the wsrep state`)
+		}
+	}
+	return nil
+}
+
+// validateStartupProbe checks a user supplied startup probe for fields that
+// conflict with kubelet semantics or with the other probes. The startup probe
+// already holds liveness and readiness back until the server is up, so a
+// liveness initialDelaySeconds on top of it only delays failure detection.
+func validateStartupProbe(px *api.PerconaXtraDB) error {
+	probe := px.Spec.PodTemplate.Spec.StartupProbe
+	if probe == nil {
+		return nil
+	}
+	if probe.SuccessThreshold > 1 {
+		return errors.New(`'spec.podTemplate.spec.startupProbe.successThreshold' must be 1; the kubelet rejects other values for startup probes`)
+	}
+	if liveness := px.Spec.PodTemplate.Spec.LivenessProbe; liveness != nil && liveness.InitialDelaySeconds > 0 {
+		return errors.New(`'spec.podTemplate.spec.livenessProbe.initialDelaySeconds' conflicts with 'spec.podTemplate.spec.startupProbe'; the startup probe already defers liveness until the server is up`)
+	}
+	return nil
+}
+
+// validatePreStartScript checks that the pre-start hook names the script to
+// run inside its mounted volume.
+func validatePreStartScript(px *api.PerconaXtraDB) error {
+	script := px.Spec.PreStartScript
+	if script == nil {
+		return nil
+	}
+	if script.ScriptPath == "" {
+		return errors.New(`'spec.preStartScript.scriptPath' is required; it names the script inside the mounted volume`)
+	}
+	if strings.Contains(script.ScriptPath, "..") {
+		return errors.Errorf(`'spec.preStartScript.scriptPath' %q must not leave the script volume`, script.ScriptPath)
+	}
+	return nil
+}
+
+// validateVolumeMounts checks that user supplied volume mounts stay clear of
+// the mount paths the operator reserves for the database itself.
+func validateVolumeMounts(px *api.PerconaXtraDB) error {
+	for _, mount := range px.Spec.PodTemplate.Spec.VolumeMounts {
+		path := strings.TrimRight(mount.MountPath, "/")
+		for _, reserved := range reservedMountPaths {
+			if path == strings.TrimRight(reserved, "/") {
+				return errors.Errorf(`'spec.podTemplate.spec.volumeMounts' must not use the reserved mount path %q`, reserved)
+			}
+		}
+	}
+	return nil
+}
+
+// validateDNSConfig checks the user supplied pod DNS tuning against the
+// limits the kubelet enforces, so a bad dnsConfig fails at admission instead
+// of leaving pods unschedulable.
+func validateDNSConfig(px *api.PerconaXtraDB) error {
+	policy := px.Spec.PodTemplate.Spec.DNSPolicy
+	switch policy {
+	case "", core.DNSClusterFirst, core.DNSClusterFirstWithHostNet, core.DNSDefault, core.DNSNone:
+	default:
+		return errors.Errorf(`'spec.podTemplate.spec.dnsPolicy' %q is invalid. Valid policies are %q, %q, %q and %q`,
+			policy, core.DNSClusterFirst, core.DNSClusterFirstWithHostNet, core.DNSDefault, core.DNSNone)
+	}
+
+	cfg := px.Spec.PodTemplate.Spec.DNSConfig
+	if cfg == nil {
+		// with policy None the pod has no resolv.conf at all unless a
+		// dnsConfig provides one
+		if policy == core.DNSNone {
+			return errors.New(`'spec.podTemplate.spec.dnsConfig' is required when 'spec.podTemplate.spec.dnsPolicy' is "None"`)
+		}
+		return nil
+	}
+	if len(cfg.Nameservers) > 3 {
+		return errors.New(`'spec.podTemplate.spec.dnsConfig.nameservers' must not list more than 3 nameservers`)
+	}
+	if policy == core.DNSNone && len(cfg.Nameservers) == 0 {
+		return errors.New(`'spec.podTemplate.spec.dnsConfig.nameservers' is required when 'spec.podTemplate.spec.dnsPolicy' is "None"`)
+	}
+	for _, ns := range cfg.Nameservers {
+		if net.ParseIP(ns) == nil {
+			return errors.Errorf(`'spec.podTemplate.spec.dnsConfig.nameservers' entry %q is not an IP address`, ns)
+		}
+	}
+	if len(cfg.Searches) > 6 {
+		return errors.New(`'spec.podTemplate.spec.dnsConfig.searches' must not list more than 6 search domains`)
+	}
+	for _, search := range cfg.Searches {
+		if search == "" {
+			return errors.New(`'spec.podTemplate.spec.dnsConfig.searches' must not contain empty domains`)
+		}
+	}
+	for _, opt := range cfg.Options {
+		if opt.Name == "" {
+			return errors.New(`'spec.podTemplate.spec.dnsConfig.options' entries require a name`)
+		}
+	}
+	return nil
+}
+
+// validateInitContainers checks that user supplied init containers neither
+// reuse a reserved operator container name nor shadow each other.
+func validateInitContainers(px *api.PerconaXtraDB) error {
+	seen := sets.NewString()
+	for _, container := range px.Spec.PodTemplate.Spec.InitContainers {
+		if seen.Has(container.Name) {
+			return errors.Errorf(`'spec.podTemplate.spec.initContainers' contains duplicate container name %q`, container.Name)
+		}
+		seen.Insert(container.Name)
+		for _, reserved := range reservedContainerNames {
+			if container.Name == reserved {
+				return errors.Errorf(`'spec.podTemplate.spec.initContainers' must not use the reserved container name %q`, container.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// knownExporterCollectors are the collector names mysqld_exporter understands.
+// ref: https://github.com/prometheus/mysqld_exporter#collector-flags
+var knownExporterCollectors = sets.NewString(
+	"auto_increment.columns",
+	"binlog_size",
+	"engine_innodb_status",
+	"engine_tokudb_status",
+	"global_status",
+	"global_variables",
+	"heartbeat",
+	"info_schema.clientstats",
+	"info_schema.innodb_cmpmem",
+	"info_schema.innodb_metrics",
+	"info_schema.innodb_tablespaces",
+	"info_schema.processlist",
+	"info_schema.query_response_time",
+	"info_schema.tables",
+	"info_schema.tablestats",
+	"info_schema.schemastats",
+	"info_schema.userstats",
+	"perf_schema.eventsstatements",
+	"perf_schema.eventswaits",
+	"perf_schema.file_events",
+	"perf_schema.file_instances",
+	"perf_schema.indexiowaits",
+	"perf_schema.tableiowaits",
+	"perf_schema.tablelocks",
+	"perf_schema.replication_group_member_stats",
+	"slave_status",
+	"slave_hosts",
+)
+
+// validateExporterCollectors checks whether the collector names in
+// 'spec.monitor.prometheus.exporter.collectors' are known to mysqld_exporter.
+// A leading "-" marks a collector to disable.
+func validateExporterCollectors(px *api.PerconaXtraDB) error {
+	if px.Spec.Monitor.Prometheus == nil {
+		return nil
+	}
+	for _, collector := range px.Spec.Monitor.Prometheus.Exporter.Collectors {
+		name := strings.TrimPrefix(collector, "-")
+		if !knownExporterCollectors.Has(name) {
+			return errors.Errorf(`unknown collector %q in 'spec.monitor.prometheus.exporter.collectors'`, name)
+		}
+	}
+	return nil
+}
+
+// validateExporterTLS ensures a serving certificate is available when the
+// metrics exporter is asked to serve HTTPS: either an explicitly referenced
+// secret, or a certificate issued through 'spec.tls'.
+func validateExporterTLS(px *api.PerconaXtraDB) error {
+	if px.Spec.Monitor.Prometheus == nil || px.Spec.Monitor.Prometheus.Exporter.TLS == nil {
+		return nil
+	}
+	if px.Spec.Monitor.Prometheus.Exporter.TLS.SecretName == "" && px.Spec.TLS == nil {
+		return errors.New(`'spec.monitor.prometheus.exporter.tls' requires either 'spec.monitor.prometheus.exporter.tls.secretName' or an issuer in 'spec.tls'`)
+	}
+	return nil
+}
+
+// validateTLS checks whether the TLS configurations for client connections are ok
+func validateTLS(client kubernetes.Interface, px *api.PerconaXtraDB, strictValidation bool) error {
+	tls := px.Spec.TLS
+	if tls == nil {
+		return nil
+	}
+
+	// for cluster mode, the replication certificates must be issued, so an issuer is mandatory
+	if px.IsCluster() && tls.IssuerRef == nil {
+		return errors.New(`'spec.tls.issuerRef' is missing. An issuer must be specified to enable TLS for cluster`)
+	}
+
+	if tls.IssuerRef != nil &&
+		tls.IssuerRef.Kind != "Issuer" && tls.IssuerRef.Kind != "ClusterIssuer" {
+		return errors.Errorf(`'spec.tls.issuerRef.kind' "%s" invalid. Value must be "Issuer" or "ClusterIssuer"`, tls.IssuerRef.Kind)
+	}
+
+	if strictValidation {
+		for _, cert := range tls.Certificates {
+			if cert.SecretName == "" {
+				continue
+			}
+			secret, err := client.CoreV1().Secrets(px.Namespace).Get(context.TODO(), cert.SecretName, metav1.GetOptions{})
+			if err != nil {
+				if kerr.IsNotFound(err) {
+					return errors.Errorf(`certificate secret "%v/%v" for alias %q not found`, px.Namespace, cert.SecretName, cert.Alias)
+				}
+				return err
+			}
+			for _, key := range []string{core.TLSCertKey, core.TLSPrivateKeyKey} {
+				if _, ok := secret.Data[key]; !ok {
+					return errors.Errorf(`certificate secret "%v/%v" is missing key %q`, px.Namespace, cert.SecretName, key)
+				}
+			}
 		}
 	}
 
@@ -166,7 +967,17 @@ func validateCluster(px *api.PerconaXtraDB) error {
 
 // ValidatePerconaXtraDB checks if the object satisfies all the requirements.
 // It is not method of Interface, because it is referenced from controller package too.
-func ValidatePerconaXtraDB(client kubernetes.Interface, extClient cs.Interface, px *api.PerconaXtraDB, strictValidation bool) error {
+//
+// In dry-run mode only schema level checks run; everything that needs cluster
+// state is skipped so the call has no side effects and does not depend on
+// resources that would only exist after admission: the catalog version lookup
+// (and with it the cluster version recommendation), storage class existence,
+// and the secret and deprecation checks behind strictValidation.
+func ValidatePerconaXtraDB(client kubernetes.Interface, extClient cs.Interface, px *api.PerconaXtraDB, strictValidation, dryRun bool) error {
+	if dryRun {
+		strictValidation = false
+	}
+
 	if px.Spec.Version == "" {
 		return errors.New(`'spec.version' is missing`)
 	}
@@ -176,11 +987,18 @@ func ValidatePerconaXtraDB(client kubernetes.Interface, extClient cs.Interface,
 			*px.Spec.Replicas)
 	}
 
-	if pxVersion, err := extClient.CatalogV1alpha1().PerconaXtraDBVersions().Get(context.TODO(), string(px.Spec.Version), metav1.GetOptions{}); err != nil {
-		return err
-	} else if px.IsCluster() && pxVersion.Spec.Version != api.PerconaXtraDBClusterRecommendedVersion {
-		return errors.Errorf("unsupported version for xtradb cluster, recommended version is %s",
-			api.PerconaXtraDBClusterRecommendedVersion)
+	// scaling to zero is only meaningful while the database is halted
+	if *px.Spec.Replicas == 0 && !px.Spec.Halted {
+		return fmt.Errorf(`'spec.replicas' can only be 0 when 'spec.halted' is set`)
+	}
+
+	if !dryRun {
+		if pxVersion, err := extClient.CatalogV1alpha1().PerconaXtraDBVersions().Get(context.TODO(), string(px.Spec.Version), metav1.GetOptions{}); err != nil {
+			return err
+		} else if px.IsCluster() && pxVersion.Spec.Version != api.PerconaXtraDBClusterRecommendedVersion {
+			return errors.Errorf("unsupported version for xtradb cluster, recommended version is %s",
+				api.PerconaXtraDBClusterRecommendedVersion)
+		}
 	}
 
 	if px.IsCluster() && *px.Spec.Replicas < api.PerconaXtraDBDefaultClusterSize {
@@ -188,22 +1006,269 @@ func ValidatePerconaXtraDB(client kubernetes.Interface, extClient cs.Interface,
 			px.Spec.Replicas, api.PerconaXtraDBDefaultClusterSize)
 	}
 
+	// an even sized cluster can split into halves that both lose quorum; warn
+	// about it without rejecting the spec, as an arbiter may restore the odd vote
+	if px.IsCluster() && *px.Spec.Replicas%2 == 0 && px.Spec.Arbiter == nil {
+		log.Warningf(`PerconaXtraDB %s/%s: 'spec.replicas' %d is even. An even number of nodes risks split-brain when the network partitions; use an odd size or add an arbiter`,
+			px.Namespace, px.Name, *px.Spec.Replicas)
+	}
+
+	// a standalone server never performs a state snapshot transfer
+	if px.Spec.SSTMethod != "" {
+		if !px.IsCluster() {
+			return fmt.Errorf(`'spec.sstMethod' can only be used for xtradb cluster`)
+		}
+		if px.Spec.SSTMethod != api.PerconaXtraDBSSTMethodXtrabackupV2 && px.Spec.SSTMethod != api.PerconaXtraDBSSTMethodRsync {
+			return fmt.Errorf(`'spec.sstMethod' %q is invalid. Supported methods are %q and %q`,
+				px.Spec.SSTMethod, api.PerconaXtraDBSSTMethodXtrabackupV2, api.PerconaXtraDBSSTMethodRsync)
+		}
+	}
+
+	// a standalone server has no cluster address to resolve
+	if px.Spec.ClusterAddressStrategy != "" {
+		if !px.IsCluster() {
+			return fmt.Errorf(`'spec.clusterAddressStrategy' can only be used for xtradb cluster`)
+		}
+		if px.Spec.ClusterAddressStrategy != api.PerconaXtraDBAddressStrategyDNS && px.Spec.ClusterAddressStrategy != api.PerconaXtraDBAddressStrategyPodIP {
+			return fmt.Errorf(`'spec.clusterAddressStrategy' %q is invalid. Supported strategies are %q and %q`,
+				px.Spec.ClusterAddressStrategy, api.PerconaXtraDBAddressStrategyDNS, api.PerconaXtraDBAddressStrategyPodIP)
+		}
+	}
+
+	if err := validateReplicationMode(px); err != nil {
+		return err
+	}
+
+	if err := validateUpdateStrategy(px); err != nil {
+		return err
+	}
+
+	if err := validatePorts(px); err != nil {
+		return err
+	}
+
+	if err := validateTLSSANs(px); err != nil {
+		return err
+	}
+
+	// the selector labels tie the pods to their StatefulSet and services;
+	// user pod labels must not shadow them
+	for key := range px.Spec.PodTemplate.Labels {
+		if _, ok := px.OffshootSelectors()[key]; ok {
+			return fmt.Errorf(`'spec.podTemplate.metadata.labels' must not set the operator's selector label %q`, key)
+		}
+	}
+
+	// the same keys identify the StatefulSet itself, so controller-level
+	// labels must not shadow them either
+	for key := range px.Spec.PodTemplate.Controller.Labels {
+		if _, ok := px.OffshootSelectors()[key]; ok {
+			return fmt.Errorf(`'spec.podTemplate.controller.labels' must not set the operator's selector label %q`, key)
+		}
+	}
+
+	// the operator appends its own shutdown and upgrade steps to the lifecycle
+	// hooks of the mysqld container, which only works for exec handlers
+	if lc := px.Spec.PodTemplate.Spec.Lifecycle; lc != nil {
+		if lc.PreStop != nil && lc.PreStop.Exec == nil {
+			return fmt.Errorf(`'spec.podTemplate.spec.lifecycle.preStop' must use an exec handler; the operator appends its shutdown command to it`)
+		}
+		if lc.PostStart != nil && lc.PostStart.Exec == nil {
+			return fmt.Errorf(`'spec.podTemplate.spec.lifecycle.postStart' must use an exec handler; the operator prepends its mysql_upgrade step to it during version updates`)
+		}
+	}
+
+	// retention below a second rounds down to the server default, which is
+	// almost certainly not what was meant
+	if px.Spec.BinlogRetention != nil {
+		if px.Spec.BinlogRetention.Duration < time.Second {
+			return fmt.Errorf(`'spec.binlogRetention' %v is invalid. Value must be a positive duration of at least one second`,
+				px.Spec.BinlogRetention.Duration)
+		}
+		if px.Spec.BinlogRetention.Duration < time.Hour {
+			log.Warningf(`PerconaXtraDB %s/%s: 'spec.binlogRetention' %v is very low. Binlogs expiring before incremental backups or point-in-time recovery can read them makes both unreliable`,
+				px.Namespace, px.Name, px.Spec.BinlogRetention.Duration)
+		}
+	}
+
+	if px.Spec.MaxConnections != nil {
+		if px.Spec.MaxConnections.Value != nil && px.Spec.MaxConnections.Auto {
+			return fmt.Errorf(`'spec.maxConnections.value' and 'spec.maxConnections.auto' are mutually exclusive`)
+		}
+		if px.Spec.MaxConnections.Value == nil && !px.Spec.MaxConnections.Auto {
+			return fmt.Errorf(`'spec.maxConnections' requires either 'value' or 'auto' to be set`)
+		}
+		if px.Spec.MaxConnections.Value != nil && *px.Spec.MaxConnections.Value <= 0 {
+			return fmt.Errorf(`'spec.maxConnections.value' %d is invalid. Value must be positive`,
+				*px.Spec.MaxConnections.Value)
+		}
+		if px.Spec.MaxConnections.Auto {
+			limit, found := px.Spec.PodTemplate.Spec.Resources.Limits[core.ResourceMemory]
+			if !found || limit.IsZero() {
+				return fmt.Errorf(`'spec.maxConnections.auto' requires a memory limit on the database container to derive the limit from`)
+			}
+		}
+	}
+
+	if px.Spec.Backup != nil {
+		if px.Spec.Backup.Schedule == "" {
+			return fmt.Errorf(`'spec.backup.schedule' is missing`)
+		}
+		if px.Spec.Backup.Repository == "" {
+			return fmt.Errorf(`'spec.backup.repository' is missing`)
+		}
+	}
+
 	if err := validateCluster(px); err != nil {
 		return err
 	}
 
+	if err := validateInit(px); err != nil {
+		return err
+	}
+
+	if err := validateProxySQL(px); err != nil {
+		return err
+	}
+
+	if err := validateCoordinator(px); err != nil {
+		return err
+	}
+
+	if err := validateAuditLog(px); err != nil {
+		return err
+	}
+
+	if err := validateHealthChecker(px); err != nil {
+		return err
+	}
+
+	if err := validateAutoTuneBufferPool(px); err != nil {
+		return err
+	}
+
+	if err := validateStorageAutoScaler(px); err != nil {
+		return err
+	}
+
+	if err := validateMaintenanceWindow(px); err != nil {
+		return err
+	}
+
+	if err := validateWsrepProviderOptions(px); err != nil {
+		return err
+	}
+
+	if err := validateServiceTemplates(px); err != nil {
+		return err
+	}
+
+	if err := validateAllowedSchemas(px); err != nil {
+		return err
+	}
+
+	if err := validateArbiter(px); err != nil {
+		return err
+	}
+
+	if err := validateTLS(client, px, strictValidation); err != nil {
+		return err
+	}
+
+	if err := validateUsers(px); err != nil {
+		return err
+	}
+
+	if err := validateDatabases(px); err != nil {
+		return err
+	}
+
+	if err := validateReadinessProbe(px); err != nil {
+		return err
+	}
+
+	if err := validateStartupProbe(px); err != nil {
+		return err
+	}
+
+	if err := validatePreStartScript(px); err != nil {
+		return err
+	}
+
+	if err := validateVolumeMounts(px); err != nil {
+		return err
+	}
+
+	if err := validateDNSConfig(px); err != nil {
+		return err
+	}
+
+	if err := validateTopologySpreadConstraints(px); err != nil {
+		return err
+	}
+
+	if err := validateInitContainers(px); err != nil {
+		return err
+	}
+
 	if err := amv.ValidateEnvVar(px.Spec.PodTemplate.Spec.Env, forbiddenEnvVars, api.ResourceKindPerconaXtraDB); err != nil {
 		return err
 	}
 
+	// sharing the process namespace exposes mysqld's processes, environment
+	// and /proc entries to every other container in the pod, so make sure the
+	// user opted in knowingly
+	if spn := px.Spec.PodTemplate.Spec.ShareProcessNamespace; spn != nil && *spn {
+		log.Warningf(`PerconaXtraDB %s/%s: 'spec.podTemplate.spec.shareProcessNamespace' is enabled. Every container in the pod can view and signal mysqld's processes and read its /proc entries`,
+			px.Namespace, px.Name)
+	}
+
+	// the data volume is chowned to the mysql group of the Percona image; a
+	// different fsGroup may leave the datadir unwritable, so warn but let the
+	// user override it for images built with another group
+	if sc := px.Spec.PodTemplate.Spec.SecurityContext; sc != nil && sc.FSGroup != nil && *sc.FSGroup != api.PerconaXtraDBMySQLGroupID {
+		log.Warningf(`PerconaXtraDB %s/%s: 'spec.podTemplate.spec.securityContext.fsGroup' %d differs from the mysql group %d of the Percona image. The data volume may not be writable by mysqld`,
+			px.Namespace, px.Name, *sc.FSGroup, api.PerconaXtraDBMySQLGroupID)
+	}
+
+	// pods referencing a missing PriorityClass are rejected by the scheduler,
+	// so catch the typo here instead. The lookup needs cluster state and is
+	// skipped in dry-run mode.
+	if !dryRun && px.Spec.PodTemplate.Spec.PriorityClassName != "" {
+		if _, err := client.SchedulingV1().PriorityClasses().Get(context.TODO(), px.Spec.PodTemplate.Spec.PriorityClassName, metav1.GetOptions{}); err != nil {
+			if kerr.IsNotFound(err) {
+				return errors.Errorf(`'spec.podTemplate.spec.priorityClassName' %q does not exist`, px.Spec.PodTemplate.Spec.PriorityClassName)
+			}
+			return err
+		}
+	}
+
 	if px.Spec.StorageType == "" {
 		return fmt.Errorf(`'spec.storageType' is missing`)
 	}
 	if px.Spec.StorageType != api.StorageTypeDurable && px.Spec.StorageType != api.StorageTypeEphemeral {
 		return fmt.Errorf(`'spec.storageType' %s is invalid`, px.Spec.StorageType)
 	}
-	if err := amv.ValidateStorage(client, px.Spec.StorageType, px.Spec.Storage); err != nil {
-		return err
+	// the storage validation looks up the referenced storage class; dry-run
+	// keeps the schema level part of it
+	if dryRun {
+		if px.Spec.StorageType == api.StorageTypeDurable && px.Spec.Storage == nil {
+			return fmt.Errorf(`'spec.storage' is missing for durable storage type`)
+		}
+	} else {
+		if err := amv.ValidateStorage(client, px.Spec.StorageType, px.Spec.Storage); err != nil {
+			return err
+		}
+	}
+	if px.Spec.LogStorage != nil {
+		if px.Spec.StorageType == api.StorageTypeEphemeral {
+			return fmt.Errorf(`'spec.logStorage' can not be used with 'Ephemeral' storage`)
+		}
+		if !dryRun {
+			if err := amv.ValidateStorage(client, px.Spec.StorageType, px.Spec.LogStorage, "spec.logStorage"); err != nil {
+				return err
+			}
+		}
 	}
 
 	databaseSecret := px.Spec.DatabaseSecret
@@ -215,6 +1280,66 @@ func ValidatePerconaXtraDB(client kubernetes.Interface, extClient cs.Interface,
 			}
 		}
 
+		if px.Spec.ConfigSecret != nil {
+			if _, err := client.CoreV1().Secrets(px.Namespace).Get(context.TODO(), px.Spec.ConfigSecret.Name, metav1.GetOptions{}); err != nil {
+				return err
+			}
+		}
+
+		if px.Spec.MonitorUser != nil && px.Spec.MonitorUser.DisableAutoCreation && px.Spec.MonitorUser.SecretName != "" {
+			if _, err := client.CoreV1().Secrets(px.Namespace).Get(context.TODO(), px.Spec.MonitorUser.SecretName, metav1.GetOptions{}); err != nil {
+				return err
+			}
+		}
+
+		if px.Spec.Encryption != nil && px.Spec.Encryption.Vault != nil && px.Spec.Encryption.Vault.TokenSecret != "" {
+			if _, err := client.CoreV1().Secrets(px.Namespace).Get(context.TODO(), px.Spec.Encryption.Vault.TokenSecret, metav1.GetOptions{}); err != nil {
+				return err
+			}
+		}
+
+		// a user referenced governing service has to exist and be usable as
+		// one: headless, and selecting the database pods
+		if px.Spec.GoverningService != "" {
+			svc, err := client.CoreV1().Services(px.Namespace).Get(context.TODO(), px.Spec.GoverningService, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			if svc.Spec.ClusterIP != core.ClusterIPNone {
+				return fmt.Errorf(`'spec.governingService' %q is not a headless service`, px.Spec.GoverningService)
+			}
+			if len(svc.Spec.Selector) == 0 || !labels.SelectorFromSet(svc.Spec.Selector).Matches(labels.Set(px.OffshootSelectors())) {
+				return fmt.Errorf(`'spec.governingService' %q does not select the pods of this database`, px.Spec.GoverningService)
+			}
+		}
+
+		if px.Spec.Init != nil && px.Spec.Init.CABundleConfigMapRef != nil {
+			if _, err := client.CoreV1().ConfigMaps(px.Namespace).Get(context.TODO(), px.Spec.Init.CABundleConfigMapRef.Name, metav1.GetOptions{}); err != nil {
+				return err
+			}
+		}
+
+		for _, ref := range px.Spec.PodTemplate.Spec.ImagePullSecrets {
+			if _, err := client.CoreV1().Secrets(px.Namespace).Get(context.TODO(), ref.Name, metav1.GetOptions{}); err != nil {
+				if kerr.IsNotFound(err) {
+					return errors.Errorf(`image pull secret "%v/%v" not found`, px.Namespace, ref.Name)
+				}
+				return err
+			}
+		}
+
+		// a user-provided ServiceAccount is reused instead of created, so it
+		// has to exist up front; the operator-created one carries the offshoot
+		// name and is exempt
+		if saName := px.Spec.PodTemplate.Spec.ServiceAccountName; saName != "" && saName != px.OffshootName() {
+			if _, err := client.CoreV1().ServiceAccounts(px.Namespace).Get(context.TODO(), saName, metav1.GetOptions{}); err != nil {
+				if kerr.IsNotFound(err) {
+					return errors.Errorf(`service account "%v/%v" referenced in 'spec.podTemplate.spec.serviceAccountName' not found`, px.Namespace, saName)
+				}
+				return err
+			}
+		}
+
 		// Check if percona-xtradb Version is deprecated.
 		// If deprecated, return error
 		pxVersion, err := extClient.CatalogV1alpha1().PerconaXtraDBVersions().Get(context.TODO(), string(px.Spec.Version), metav1.GetOptions{})
@@ -236,17 +1361,156 @@ func ValidatePerconaXtraDB(client kubernetes.Interface, extClient cs.Interface,
 		return fmt.Errorf(`'spec.terminationPolicy' is missing`)
 	}
 
+	// "Pause" used to behave like today's Halt; reject it with a pointer at
+	// the migration instead of silently treating it as something else
+	if px.Spec.TerminationPolicy == "Pause" {
+		return fmt.Errorf(`'spec.terminationPolicy: Pause' is no longer supported. Use 'spec.terminationPolicy: Halt' and set 'spec.halted: true' to pause the database`)
+	}
+
 	if px.Spec.StorageType == api.StorageTypeEphemeral && px.Spec.TerminationPolicy == api.TerminationPolicyHalt {
 		return fmt.Errorf(`'spec.terminationPolicy: Halt' can not be used for 'Ephemeral' storage`)
 	}
 
+	// an ephemeral cluster survives single node restarts through SST, but a
+	// full restart loses every copy of the data at once
+	if px.IsCluster() && px.Spec.StorageType == api.StorageTypeEphemeral {
+		log.Warningf(`PerconaXtraDB %s/%s: 'spec.storageType' is Ephemeral. All data is lost if every node restarts at the same time`,
+			px.Namespace, px.Name)
+	}
+
 	monitorSpec := px.Spec.Monitor
 	if monitorSpec != nil {
+		// the operator wires up either a ServiceMonitor for the prometheus
+		// operator or scrape annotations for a builtin prometheus; any other
+		// agent has no implementation behind it
+		if monitorSpec.Agent != mona.AgentPrometheusOperator && monitorSpec.Agent != mona.AgentPrometheusBuiltin {
+			return fmt.Errorf(`'spec.monitor.agent' %q is invalid. Supported agents are %q and %q`,
+				monitorSpec.Agent, mona.AgentPrometheusOperator, mona.AgentPrometheusBuiltin)
+		}
 		if err := amv.ValidateMonitorSpec(monitorSpec); err != nil {
 			return err
 		}
+		if err := validateExporterCollectors(px); err != nil {
+			return err
+		}
+		if err := validateExporterTLS(px); err != nil {
+			return err
+		}
+	}
+
+	// without auto-creation the exporter has no credentials unless the user
+	// supplies them
+	if px.Spec.MonitorUser != nil && px.Spec.MonitorUser.DisableAutoCreation && px.Spec.MonitorUser.SecretName == "" {
+		return errors.New(`'spec.monitorUser.secretName' is required when 'spec.monitorUser.disableAutoCreation' is set`)
+	}
+
+	if err := validateEncryption(px); err != nil {
+		return err
+	}
+
+	if err := validateAuxiliaryImages(px); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// imageReferenceRegexp loosely matches a container image reference like
+// [registry[:port]/]path[:tag][@digest]. It is intentionally permissive; the
+// point is to catch obvious mistakes such as spaces or flag leftovers, not to
+// reimplement the distribution reference grammar.
+var imageReferenceRegexp = regexp.MustCompile(`^[a-z0-9][a-zA-Z0-9._/:@-]*$`)
+
+// validateAuxiliaryImages checks that the helper image overrides look like
+// image references.
+func validateAuxiliaryImages(px *api.PerconaXtraDB) error {
+	aux := px.Spec.AuxiliaryImages
+	if aux == nil {
+		return nil
+	}
+	for field, image := range map[string]string{
+		"exporter":    aux.Exporter,
+		"coordinator": aux.Coordinator,
+		"init":        aux.Init,
+	} {
+		if image != "" && !imageReferenceRegexp.MatchString(image) {
+			return errors.Errorf(`'spec.auxiliaryImages.%s' %q is not a valid image reference`, field, image)
+		}
+	}
+	return nil
+}
+
+// validateEncryption checks that an enabled keyring carries its key source:
+// keyring_vault needs the Vault connection settings including the token
+// secret, keyring_file needs nothing beyond the data volume.
+func validateEncryption(px *api.PerconaXtraDB) error {
+	enc := px.Spec.Encryption
+	if enc == nil {
+		return nil
+	}
+	switch enc.Mode {
+	case api.KeyringFile:
+		return nil
+	case api.KeyringVault:
+		if enc.Vault == nil {
+			return errors.New(`'spec.encryption.vault' is required when 'spec.encryption.mode' is "keyring_vault"`)
+		}
+		if enc.Vault.Address == "" {
+			return errors.New(`'spec.encryption.vault.address' is required`)
+		}
+		if enc.Vault.SecretMountPoint == "" {
+			return errors.New(`'spec.encryption.vault.secretMountPoint' is required`)
+		}
+		if enc.Vault.TokenSecret == "" {
+			return errors.New(`'spec.encryption.vault.tokenSecret' is required`)
+		}
+		return nil
+	default:
+		return errors.Errorf(`'spec.encryption.mode' %q is invalid. Supported modes are %q and %q`,
+			enc.Mode, api.KeyringFile, api.KeyringVault)
 	}
+}
 
+// validateEncryptionTransition blocks turning data-at-rest encryption off once
+// it has been on: without the keyring the already encrypted tablespaces can
+// not be read anymore. Switching keyring plugins is blocked for the same
+// reason; the master key does not move along.
+func validateEncryptionTransition(oldPx, px *api.PerconaXtraDB) error {
+	if oldPx.Spec.Encryption == nil {
+		return nil
+	}
+	if px.Spec.Encryption == nil {
+		return errors.New(`'spec.encryption' can not be disabled once enabled; the encrypted tablespaces would become unreadable`)
+	}
+	if px.Spec.Encryption.Mode != oldPx.Spec.Encryption.Mode {
+		return errors.Errorf(`'spec.encryption.mode' can not be changed from %q to %q; the master key is not migrated between keyrings`,
+			oldPx.Spec.Encryption.Mode, px.Spec.Encryption.Mode)
+	}
+	return nil
+}
+
+// validateStorageTransition admits growing the storage request, which
+// expandStorage rolls out to the PVCs, but keeps every other part of
+// 'spec.storage' immutable: StatefulSet volume claims can neither shrink nor
+// move to a different storage class.
+func validateStorageTransition(oldPx, px *api.PerconaXtraDB) error {
+	old, cur := oldPx.Spec.Storage, px.Spec.Storage
+	if old == nil || cur == nil {
+		if old != nil || cur != nil {
+			return errors.New(`'spec.storage' can not be added or removed after creation`)
+		}
+		return nil
+	}
+	oldSC, curSC := old.StorageClassName, cur.StorageClassName
+	if (oldSC == nil) != (curSC == nil) || (oldSC != nil && *oldSC != *curSC) {
+		return errors.New(`'spec.storage.storageClassName' can not be changed; PVCs can not move between storage classes`)
+	}
+	oldReq, oldFound := old.Resources.Requests[core.ResourceStorage]
+	curReq, curFound := cur.Resources.Requests[core.ResourceStorage]
+	if oldFound && curFound && curReq.Cmp(oldReq) < 0 {
+		return errors.Errorf(`'spec.storage.resources.requests.storage' can not shrink from %v to %v`,
+			oldReq.String(), curReq.String())
+	}
 	return nil
 }
 
@@ -285,9 +1549,7 @@ func getPreconditionFunc(conditions []kmapi.Condition) []mergepatch.Precondition
 
 var preconditionSpecFields = sets.NewString(
 	"spec.storageType",
-	"spec.storage",
 	"spec.databaseSecret",
-	"spec.podTemplate.spec.nodeSelector",
 )
 
 func preconditionFailedError() error {
@@ -174,6 +174,76 @@ var cases = []struct {
 		false,
 		false,
 	},
+	{"Create PerconaXtraDB with deprecated Spec.TerminationPolicy=Pause",
+		requestKind,
+		"foo",
+		"default",
+		admission.Create,
+		deprecatedPauseTermination(samplePerconaXtraDB()),
+		api.PerconaXtraDB{},
+		false,
+		false,
+	},
+	{"Create PerconaXtraDB with keyring_vault encryption without a token secret",
+		requestKind,
+		"foo",
+		"default",
+		admission.Create,
+		incompleteVaultEncryption(samplePerconaXtraDB()),
+		api.PerconaXtraDB{},
+		false,
+		false,
+	},
+	{"Edit PerconaXtraDB disabling encryption",
+		requestKind,
+		"foo",
+		"default",
+		admission.Update,
+		samplePerconaXtraDB(),
+		fileEncryption(samplePerconaXtraDB()),
+		false,
+		false,
+	},
+	{"Create PerconaXtraDB managing the repl user on an async cluster",
+		requestKind,
+		"foo",
+		"default",
+		admission.Create,
+		asyncManagingReplUser(samplePerconaXtraDB()),
+		api.PerconaXtraDB{},
+		false,
+		false,
+	},
+	{"Create standalone PerconaXtraDB with canary update strategy",
+		requestKind,
+		"foo",
+		"default",
+		admission.Create,
+		standaloneCanaryRollout(samplePerconaXtraDB()),
+		api.PerconaXtraDB{},
+		false,
+		false,
+	},
+	{"Edit PerconaXtraDB growing Spec.Storage",
+		requestKind,
+		"foo",
+		"default",
+		admission.Update,
+		growStorage(samplePerconaXtraDB()),
+		samplePerconaXtraDB(),
+		false,
+		true,
+	},
+	{"Edit PerconaXtraDB shrinking Spec.Storage",
+		requestKind,
+		"foo",
+		"default",
+		admission.Update,
+		shrinkStorage(samplePerconaXtraDB()),
+		samplePerconaXtraDB(),
+		false,
+		false,
+	},
 	{"Edit PerconaXtraDB Spec.DatabaseSecret with Existing Secret",
 		requestKind,
 		"foo",
@@ -413,6 +483,60 @@ func pauseDatabase(old api.PerconaXtraDB) api.PerconaXtraDB {
 	return old
 }
 
+func deprecatedPauseTermination(old api.PerconaXtraDB) api.PerconaXtraDB {
+	old.Spec.TerminationPolicy = "Pause"
+	return old
+}
+
+func fileEncryption(old api.PerconaXtraDB) api.PerconaXtraDB {
+	old.Spec.Encryption = &api.EncryptionSpec{
+		Mode: api.KeyringFile,
+	}
+	return old
+}
+
+func incompleteVaultEncryption(old api.PerconaXtraDB) api.PerconaXtraDB {
+	old.Spec.Encryption = &api.EncryptionSpec{
+		Mode: api.KeyringVault,
+		Vault: &api.KeyringVaultSpec{
+			Address:          "https://vault.example.com:8200",
+			SecretMountPoint: "secret",
+		},
+	}
+	return old
+}
+
+func growStorage(old api.PerconaXtraDB) api.PerconaXtraDB {
+	old.Spec.Storage.Resources.Requests[core.ResourceStorage] = resource.MustParse("200Mi")
+	return old
+}
+
+func shrinkStorage(old api.PerconaXtraDB) api.PerconaXtraDB {
+	old.Spec.Storage.Resources.Requests[core.ResourceStorage] = resource.MustParse("50Mi")
+	return old
+}
+
+func asyncManagingReplUser(old api.PerconaXtraDB) api.PerconaXtraDB {
+	old.Spec.Replicas = types.Int32P(api.PerconaXtraDBDefaultClusterSize)
+	old.Spec.ReplicationMode = api.PerconaXtraDBReplicationModeAsyncSourceReplica
+	old.Spec.Users = []api.PerconaXtraDBUserSpec{
+		{
+			Name: "repl",
+			PasswordSecret: core.LocalObjectReference{
+				Name: "repl-password",
+			},
+		},
+	}
+	return old
+}
+
+func standaloneCanaryRollout(old api.PerconaXtraDB) api.PerconaXtraDB {
+	old.Spec.UpdateStrategy = &api.UpdateStrategySpec{
+		Type: api.UpdateStrategyCanary,
+	}
+	return old
+}
+
 func sampleXtraDBClusterContainingInitsript() api.PerconaXtraDB {
 	perconaxtradb := samplePerconaXtraDB()
 	perconaxtradb.Spec.Replicas = types.Int32P(api.PerconaXtraDBDefaultClusterSize)
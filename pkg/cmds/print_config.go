@@ -0,0 +1,67 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"fmt"
+	"io"
+
+	"kubedb.dev/percona-xtradb/pkg/controller"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// NewCmdPrintConfig renders the my.cnf snippets the operator would generate
+// for a PerconaXtraDB manifest, without talking to a cluster or applying
+// anything, so config changes can be reviewed before rollout. Each snippet is
+// prefixed with a comment stating whether its values are operator defaults or
+// derived from user input.
+func NewCmdPrintConfig(out, errOut io.Writer) *cobra.Command {
+	var fileName string
+
+	cmd := &cobra.Command{
+		Use:               "print-config",
+		Short:             "Print the my.cnf the operator would generate for a manifest",
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if fileName == "" {
+				return errors.New("no manifest given, use --file")
+			}
+			px, err := loadManifest(fileName)
+			if err != nil {
+				fmt.Fprintf(errOut, "%v: %v\n", fileName, err)
+				cmd.SilenceUsage = true
+				cmd.SilenceErrors = true
+				return err
+			}
+
+			snippets := controller.RenderConfig(px)
+			if len(snippets) == 0 {
+				fmt.Fprintln(out, "# no generated config for this spec; only the server defaults and any custom config from 'spec.configSecret' apply")
+				return nil
+			}
+			for _, snippet := range snippets {
+				fmt.Fprintf(out, "# %v\n# source: %v\n%v\n", snippet.FileName, snippet.Source, snippet.Content)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&fileName, "file", "f", "", "Path to a YAML manifest containing a PerconaXtraDB object")
+
+	return cmd
+}
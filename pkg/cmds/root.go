@@ -59,6 +59,8 @@ func NewRootCmd(version string) *cobra.Command {
 	rootCmd.PersistentFlags().BoolVar(&cli.EnableAnalytics, "enable-analytics", cli.EnableAnalytics, "Send analytical events to Google Analytics")
 
 	rootCmd.AddCommand(v.NewCmdVersion())
+	rootCmd.AddCommand(NewCmdValidate(os.Stdout, os.Stderr))
+	rootCmd.AddCommand(NewCmdPrintConfig(os.Stdout, os.Stderr))
 
 	stopCh := genericapiserver.SetupSignalHandler()
 	rootCmd.AddCommand(NewCmdRun(version, os.Stdout, os.Stderr, stopCh))
@@ -49,6 +49,10 @@ type ExtraOptions struct {
 	ResyncPeriod                time.Duration
 	MaxNumRequeues              int
 	NumThreads                  int
+	ReconcileWorkers            int
+	DBConnectBackoffMax         time.Duration
+	DBQueryTimeout              time.Duration
+	MaxReconcileFailures        int
 
 	EnableMutatingWebhook   bool
 	EnableValidatingWebhook bool
@@ -63,11 +67,15 @@ func (s ExtraOptions) WatchNamespace() string {
 
 func NewExtraOptions() *ExtraOptions {
 	return &ExtraOptions{
-		OperatorNamespace: meta.Namespace(),
-		GoverningService:  "kubedb",
-		ResyncPeriod:      10 * time.Minute,
-		MaxNumRequeues:    5,
-		NumThreads:        2,
+		OperatorNamespace:    meta.Namespace(),
+		GoverningService:     "kubedb",
+		ResyncPeriod:         10 * time.Minute,
+		MaxNumRequeues:       5,
+		NumThreads:           2,
+		ReconcileWorkers:     2,
+		DBConnectBackoffMax:  5 * time.Minute,
+		DBQueryTimeout:       10 * time.Second,
+		MaxReconcileFailures: 10,
 		// ref: https://github.com/kubernetes/ingress-nginx/blob/e4d53786e771cc6bdd55f180674b79f5b692e552/pkg/ingress/controller/launch.go#L252-L259
 		// High enough QPS to fit all expected use cases. QPS=0 is not set here, because client code is overriding it.
 		QPS: 1e6,
@@ -83,6 +91,10 @@ func (s *ExtraOptions) AddGoFlags(fs *flag.FlagSet) {
 	fs.Float64Var(&s.QPS, "qps", s.QPS, "The maximum QPS to the master from this client")
 	fs.IntVar(&s.Burst, "burst", s.Burst, "The maximum burst for throttle")
 	fs.DurationVar(&s.ResyncPeriod, "resync-period", s.ResyncPeriod, "If non-zero, will re-list this often. Otherwise, re-list will be delayed aslong as possible (until the upstream source closes the watch or times out.")
+	fs.DurationVar(&s.DBConnectBackoffMax, "db-connect-backoff-max", s.DBConnectBackoffMax, "Upper bound of the exponential backoff applied when a database is temporarily unreachable")
+	fs.DurationVar(&s.DBQueryTimeout, "db-query-timeout", s.DBQueryTimeout, "Connect and query timeout of the operator's own connections to managed databases, used by health checks and user provisioning. A per-database spec.healthChecker.timeoutSeconds overrides it for health probes")
+	fs.IntVar(&s.MaxReconcileFailures, "max-reconcile-failures", s.MaxReconcileFailures, "Number of consecutive reconcile failures after which an object is no longer reconciled until its spec changes. 0 disables the circuit breaker")
+	fs.IntVar(&s.ReconcileWorkers, "reconcile-workers", s.ReconcileWorkers, "Number of goroutines processing PerconaXtraDB objects concurrently. Reconciles of the same object are always serialized, so values up to roughly the number of managed databases are safe; the default of 2 suits small fleets")
 
 	fs.BoolVar(&s.RestrictToOperatorNamespace, "restrict-to-operator-namespace", s.RestrictToOperatorNamespace, "If true, KubeDB operator will only handle Kubernetes objects in its own namespace.")
 
@@ -110,8 +122,12 @@ func (s *ExtraOptions) ApplyTo(cfg *controller.OperatorConfig) error {
 	cfg.ClientConfig.QPS = float32(s.QPS)
 	cfg.ClientConfig.Burst = s.Burst
 	cfg.ResyncPeriod = s.ResyncPeriod
+	cfg.DBConnectBackoffMax = s.DBConnectBackoffMax
+	cfg.DBQueryTimeout = s.DBQueryTimeout
+	cfg.MaxReconcileFailures = int32(s.MaxReconcileFailures)
 	cfg.MaxNumRequeues = s.MaxNumRequeues
 	cfg.NumThreads = s.NumThreads
+	cfg.ReconcileWorkers = s.ReconcileWorkers
 	cfg.WatchNamespace = s.WatchNamespace()
 	cfg.EnableMutatingWebhook = s.EnableMutatingWebhook
 	cfg.EnableValidatingWebhook = s.EnableValidatingWebhook
@@ -0,0 +1,90 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+	"kubedb.dev/percona-xtradb/pkg/admission"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+// NewCmdValidate validates a PerconaXtraDB manifest without talking to a
+// cluster, so the same checks the admission webhook runs can be used in CI.
+// Checks that need cluster state (catalog versions, storage classes,
+// referenced secrets) are skipped.
+func NewCmdValidate(out, errOut io.Writer) *cobra.Command {
+	var fileName string
+
+	cmd := &cobra.Command{
+		Use:               "validate",
+		Short:             "Validate a PerconaXtraDB manifest offline",
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if fileName == "" {
+				return errors.New("no manifest given, use --file")
+			}
+			if err := validateManifest(fileName); err != nil {
+				fmt.Fprintf(errOut, "%v: invalid: %v\n", fileName, err)
+				cmd.SilenceUsage = true
+				cmd.SilenceErrors = true
+				return err
+			}
+			fmt.Fprintf(out, "%v: valid\n", fileName)
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&fileName, "file", "f", "", "Path to a YAML manifest containing a PerconaXtraDB object")
+
+	return cmd
+}
+
+// loadManifest decodes a single PerconaXtraDB object from the given file and
+// applies the same defaulting as the mutating webhook.
+func loadManifest(fileName string) (*api.PerconaXtraDB, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	var px api.PerconaXtraDB
+	if err := yaml.UnmarshalStrict(data, &px); err != nil {
+		return nil, errors.Wrap(err, "failed to decode manifest")
+	}
+	if px.Kind != "" && px.Kind != api.ResourceKindPerconaXtraDB {
+		return nil, errors.Errorf("manifest contains a %v, expected a %v", px.Kind, api.ResourceKindPerconaXtraDB)
+	}
+
+	px.SetDefaults()
+	return &px, nil
+}
+
+// validateManifest loads the manifest and runs the schema level validations on
+// the defaulted result.
+func validateManifest(fileName string) error {
+	px, err := loadManifest(fileName)
+	if err != nil {
+		return err
+	}
+	return admission.ValidatePerconaXtraDB(nil, nil, px, false, true)
+}
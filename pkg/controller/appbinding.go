@@ -36,11 +36,43 @@ import (
 	meta_util "kmodules.xyz/client-go/meta"
 	appcat "kmodules.xyz/custom-resources/apis/appcatalog/v1alpha1"
 	appcat_util "kmodules.xyz/custom-resources/client/clientset/versioned/typed/appcatalog/v1alpha1/util"
+	mona "kmodules.xyz/monitoring-agent-api/api/v1"
 )
 
-func getGarbdConfig(db *api.PerconaXtraDB) ([]byte, error) {
+// getStatsConfig returns the location of the metrics exporter, so downstream
+// tooling can configure scraping from the AppBinding alone. It is only
+// populated when monitoring is configured.
+func getStatsConfig(db *api.PerconaXtraDB) *config_api.StatsConfiguration {
+	if db.Spec.Monitor == nil || db.Spec.Monitor.Agent.Vendor() != mona.VendorPrometheus {
+		return nil
+	}
+	scheme := "http"
+	if db.Spec.Monitor.Prometheus != nil && db.Spec.Monitor.Prometheus.Exporter.TLS != nil {
+		scheme = "https"
+	}
+	return &config_api.StatsConfiguration{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: config_api.SchemeGroupVersion.String(),
+			Kind:       config_api.ResourceKindStatsConfiguration,
+		},
+		Service: db.StatsService().ServiceName(),
+		Port:    db.Spec.Monitor.Prometheus.Exporter.Port,
+		Path:    db.StatsService().Path(),
+		Scheme:  scheme,
+	}
+}
+
+// getAppBindingParams builds the parameters payload of the AppBinding. Cluster
+// mode carries the garbd configuration Stash needs for backups, with the stats
+// endpoint attached; standalone databases only advertise the stats endpoint.
+func getAppBindingParams(db *api.PerconaXtraDB) ([]byte, error) {
+	stats := getStatsConfig(db)
+
 	if !db.IsCluster() {
-		return nil, nil
+		if stats == nil {
+			return nil, nil
+		}
+		return json.Marshal(stats)
 	}
 
 	var peers []string
@@ -48,6 +80,12 @@ func getGarbdConfig(db *api.PerconaXtraDB) ([]byte, error) {
 		peers = append(peers, db.PeerName(i))
 	}
 
+	// garbd has to request the SST with the method the cluster actually uses
+	sstMethod := config_api.GarbdXtrabackupSSTMethod
+	if db.Spec.SSTMethod != "" {
+		sstMethod = db.Spec.SSTMethod
+	}
+
 	return json.Marshal(config_api.GaleraArbitratorConfiguration{
 		TypeMeta: metav1.TypeMeta{
 			APIVersion: config_api.SchemeGroupVersion.String(),
@@ -55,7 +93,8 @@ func getGarbdConfig(db *api.PerconaXtraDB) ([]byte, error) {
 		},
 		Address:   fmt.Sprintf("gcomm://%s", strings.Join(peers, ",")),
 		Group:     db.Name,
-		SSTMethod: config_api.GarbdXtrabackupSSTMethod,
+		SSTMethod: sstMethod,
+		Stats:     stats,
 	})
 }
 
@@ -69,7 +108,7 @@ func (c *Controller) ensureAppBinding(db *api.PerconaXtraDB) (kutil.VerbType, er
 
 	owner := metav1.NewControllerRef(db, api.SchemeGroupVersion.WithKind(api.ResourceKindPerconaXtraDB))
 
-	garbdCnfJson, err := getGarbdConfig(db)
+	paramsJson, err := getAppBindingParams(db)
 	if err != nil {
 		return kutil.VerbUnchanged, err
 	}
@@ -79,6 +118,17 @@ func (c *Controller) ensureAppBinding(db *api.PerconaXtraDB) (kutil.VerbType, er
 		return kutil.VerbUnchanged, fmt.Errorf("failed to get PerconaXtraDBVersion %v for %v/%v. Reason: %v", db.Spec.Version, db.Namespace, db.Name, err)
 	}
 
+	// advertise the CA bundle from the issued server certificate so that
+	// clients can verify the server.
+	var caBundle []byte
+	if db.Spec.TLS != nil {
+		certSecret, err := c.Client.CoreV1().Secrets(db.Namespace).Get(context.TODO(), db.MustCertSecretName(api.PerconaXtraDBServerCert), metav1.GetOptions{})
+		if err != nil {
+			return kutil.VerbUnchanged, fmt.Errorf("failed to get certificate secret for %v/%v. Reason: %v", db.Namespace, db.Name, err)
+		}
+		caBundle = certSecret.Data["ca.crt"]
+	}
+
 	_, vt, err := appcat_util.CreateOrPatchAppBinding(
 		context.TODO(),
 		c.AppCatalogClient.AppcatalogV1alpha1(),
@@ -90,25 +140,47 @@ func (c *Controller) ensureAppBinding(db *api.PerconaXtraDB) (kutil.VerbType, er
 
 			in.Spec.Type = appmeta.Type()
 			in.Spec.Version = pxVersion.Spec.Version
-			in.Spec.ClientConfig.URL = types.StringP(fmt.Sprintf("tcp(%s:%d)/", db.ServiceName(), defaultDBPort.Port))
+
+			// when the built-in ProxySQL sidecar is enabled, clients connect
+			// through it instead of hitting mysqld directly
+			svcName, svcPort := db.ServiceName(), db.SQLPort()
+			if db.Spec.ProxySQL != nil {
+				svcName, svcPort = db.ProxySQLServiceName(), int32(api.ProxySQLMySQLNodePort)
+			}
+			in.Spec.ClientConfig.URL = types.StringP(fmt.Sprintf("tcp(%s:%d)/", svcName, svcPort))
 			in.Spec.ClientConfig.Service = &appcat.ServiceReference{
 				Scheme: "mysql",
-				Name:   db.ServiceName(),
-				Port:   defaultDBPort.Port,
+				Name:   svcName,
+				Port:   svcPort,
 				Path:   "/",
 			}
 			in.Spec.ClientConfig.InsecureSkipTLSVerify = false
+			in.Spec.ClientConfig.CABundle = caBundle
 
 			in.Spec.Secret = &core.LocalObjectReference{
 				Name: db.Spec.DatabaseSecret.SecretName,
 			}
 
-			if db.IsCluster() {
+			if paramsJson != nil {
 				in.Spec.Parameters = &runtime.RawExtension{
-					Raw: garbdCnfJson,
+					Raw: paramsJson,
 				}
 			}
 
+			// read-write splitting: advertise a separate DSN per role, so
+			// frameworks can route writes to the primary service and reads to
+			// the read-only service. A standalone database serves both roles
+			// through its only service.
+			writeURL := fmt.Sprintf("tcp(%s:%d)/", svcName, svcPort)
+			readURL := writeURL
+			if db.IsCluster() {
+				readURL = fmt.Sprintf("tcp(%s:%d)/", db.ReadServiceName(), db.SQLPort())
+			}
+			in.Annotations = core_util.UpsertMap(in.Annotations, map[string]string{
+				api.PerconaXtraDBKey + "/write-url": writeURL,
+				api.PerconaXtraDBKey + "/read-url":  readURL,
+			})
+
 			return in
 		},
 		metav1.PatchOptions{},
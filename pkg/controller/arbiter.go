@@ -0,0 +1,130 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	catalog "kubedb.dev/apimachinery/apis/catalog/v1alpha1"
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+	"kubedb.dev/apimachinery/pkg/eventer"
+
+	apps "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kutil "kmodules.xyz/client-go"
+	app_util "kmodules.xyz/client-go/apps/v1"
+	core_util "kmodules.xyz/client-go/core/v1"
+)
+
+// ensureArbiter reconciles the StatefulSet running the Galera arbiter daemons
+// (garbd). Arbiters participate in quorum voting without storing data, so the
+// StatefulSet carries no volume claim and uses the lighter resource profile
+// from spec.arbiter. When spec.arbiter is removed, the StatefulSet is deleted.
+func (c *Controller) ensureArbiter(px *api.PerconaXtraDB, pxVersion *catalog.PerconaXtraDBVersion) error {
+	if px.Spec.Arbiter == nil || !px.IsCluster() {
+		return c.deleteArbiter(px)
+	}
+
+	// arbiter pods carry their own database name label, so that the database
+	// services never route client connections to a garbd daemon
+	selectors := map[string]string{
+		api.LabelDatabaseKind: api.ResourceKindPerconaXtraDB,
+		api.LabelDatabaseName: px.ArbiterName(),
+		api.LabelRole:         api.RoleArbiter,
+	}
+	labels := px.OffshootLabels()
+	labels[api.LabelDatabaseName] = px.ArbiterName()
+	labels[api.LabelRole] = api.RoleArbiter
+
+	owner := metav1.NewControllerRef(px, api.SchemeGroupVersion.WithKind(api.ResourceKindPerconaXtraDB))
+	meta := metav1.ObjectMeta{
+		Name:      px.ArbiterName(),
+		Namespace: px.Namespace,
+	}
+
+	replicas := px.ArbiterReplicas()
+	_, vt, err := app_util.CreateOrPatchStatefulSet(
+		context.TODO(),
+		c.Client,
+		meta,
+		func(in *apps.StatefulSet) *apps.StatefulSet {
+			in.Labels = labels
+			core_util.EnsureOwnerReference(&in.ObjectMeta, owner)
+
+			in.Spec.Replicas = &replicas
+			in.Spec.ServiceName = c.GoverningService
+			in.Spec.Selector = &metav1.LabelSelector{
+				MatchLabels: selectors,
+			}
+			in.Spec.Template.Labels = selectors
+			in.Spec.Template.Spec.Containers = core_util.UpsertContainer(
+				in.Spec.Template.Spec.Containers,
+				core.Container{
+					Name:            api.RoleArbiter,
+					Image:           pxVersion.Spec.DB.Image,
+					ImagePullPolicy: core.PullIfNotPresent,
+					Command:         []string{"garbd"},
+					Args: []string{
+						fmt.Sprintf("--group=%s", px.ClusterName()),
+						// list every peer so the arbiter can still join
+						// while individual pods, including pod-0, are down
+						fmt.Sprintf("--address=%s", peerGcommAddress(px)),
+					},
+					Ports: []core.ContainerPort{
+						{
+							Name:          "sst",
+							ContainerPort: px.GaleraReplicationPort(),
+							Protocol:      core.ProtocolTCP,
+						},
+					},
+					Resources: px.Spec.Arbiter.Resources,
+				})
+			return in
+		},
+		metav1.PatchOptions{},
+	)
+	if err != nil {
+		return err
+	}
+	if vt != kutil.VerbUnchanged {
+		c.Recorder.Eventf(
+			px,
+			core.EventTypeNormal,
+			eventer.EventReasonSuccessful,
+			"Successfully %v StatefulSet %v/%v",
+			vt, px.Namespace, px.ArbiterName(),
+		)
+	}
+	return nil
+}
+
+func (c *Controller) deleteArbiter(px *api.PerconaXtraDB) error {
+	sts, err := c.Client.AppsV1().StatefulSets(px.Namespace).Get(context.TODO(), px.ArbiterName(), metav1.GetOptions{})
+	if err != nil {
+		if kerr.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if sts.Labels[api.LabelDatabaseKind] != api.ResourceKindPerconaXtraDB {
+		return nil
+	}
+	return c.Client.AppsV1().StatefulSets(px.Namespace).Delete(context.TODO(), px.ArbiterName(), metav1.DeleteOptions{})
+}
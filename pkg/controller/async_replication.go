@@ -0,0 +1,392 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+
+	"github.com/appscode/go/log"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	core_util "kmodules.xyz/client-go/core/v1"
+)
+
+const asyncReplicationConfigFileName = "async-replication.cnf"
+
+func (c *Controller) asyncReplicationConfigName(px *api.PerconaXtraDB) string {
+	return px.OffshootName() + "-async-replication-config"
+}
+
+// asyncReplicationConfig renders the my.cnf snippet for async source-replica
+// clusters: binary logging with GTID positioning, so replicas can be pointed
+// at any source with MASTER_AUTO_POSITION, and replica updates are logged for
+// failover chains. Clusters are pinned to 5.7, so the variable and statement
+// names use the 5.7 spelling throughout this file. The per-node server_id is
+// set live by the operator, since a shared snippet cannot carry it.
+func asyncReplicationConfig() string {
+	return `[mysqld]
+log-bin=mysql-bin
+relay-log=relay-bin
+gtid_mode=ON
+enforce_gtid_consistency=ON
+log_slave_updates=ON
+`
+}
+
+// ensureAsyncReplicationConfig creates a ConfigMap holding the my.cnf snippet
+// for async source-replica replication.
+func (c *Controller) ensureAsyncReplicationConfig(px *api.PerconaXtraDB) error {
+	owner := metav1.NewControllerRef(px, api.SchemeGroupVersion.WithKind(api.ResourceKindPerconaXtraDB))
+
+	meta := metav1.ObjectMeta{
+		Name:      c.asyncReplicationConfigName(px),
+		Namespace: px.Namespace,
+	}
+
+	_, _, err := core_util.CreateOrPatchConfigMap(context.TODO(), c.Client, meta, func(in *core.ConfigMap) *core.ConfigMap {
+		core_util.EnsureOwnerReference(&in.ObjectMeta, owner)
+		in.Labels = px.OffshootLabels()
+		in.Data = map[string]string{
+			asyncReplicationConfigFileName: asyncReplicationConfig(),
+		}
+		return in
+	}, metav1.PatchOptions{})
+	return err
+}
+
+// checkAsyncReplication keeps an async source-replica cluster wired up: the
+// source pod carries the primary role and accepts writes, every other pod is
+// configured as a GTID based replica of the source and labeled accordingly.
+// Pods that cannot be queried are skipped and picked up on the next tick.
+func (c *Controller) checkAsyncReplication(px *api.PerconaXtraDB) error {
+	// the replicas authenticate with the dedicated replication user, so its
+	// password has to be current on the source before any replica is pointed
+	// at it
+	if err := c.syncReplicationUser(px); err != nil {
+		return err
+	}
+
+	secret, err := c.Client.CoreV1().Secrets(px.Namespace).Get(context.TODO(), replicationUserSecretName(px), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	password := string(secret.Data[core.BasicAuthPasswordKey])
+	rotated := replicationPasswordRotated(secret)
+
+	pods, err := c.Client.CoreV1().Pods(px.Namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(px.OffshootSelectors()).String(),
+	})
+	if err != nil {
+		return err
+	}
+
+	primaryName := px.OffshootName() + "-0"
+	for i := range pods.Items {
+		if pods.Items[i].Labels[api.LabelRole] == api.RolePrimary {
+			primaryName = pods.Items[i].Name
+			break
+		}
+	}
+
+	failed := false
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Status.PodIP == "" {
+			continue
+		}
+		if err := c.reconcileAsyncPod(px, pod, primaryName, password, rotated); err != nil {
+			log.Infof("failed to reconcile async replication of pod %v/%v. Reason: %v", pod.Namespace, pod.Name, err)
+			failed = true
+		}
+	}
+
+	// only once every replica has re-run CHANGE MASTER TO with the rotated
+	// password is it recorded as applied; a skipped pod keeps the rotation
+	// pending for the next tick
+	if rotated && !failed {
+		if err := c.stampAppliedReplicationPassword(px, password); err != nil {
+			return err
+		}
+	}
+	return c.syncPrimaryStatus(px)
+}
+
+// reconcileAsyncPod brings a single pod into its desired replication role.
+// repoint forces a replica to re-run CHANGE MASTER TO even when it already
+// follows the right host, used after a credential rotation.
+func (c *Controller) reconcileAsyncPod(px *api.PerconaXtraDB, pod *core.Pod, primaryName, replPassword string, repoint bool) error {
+	en, err := c.connectToPod(px, pod.Status.PodIP)
+	if err != nil {
+		return err
+	}
+	defer en.Close()
+
+	// every node needs a distinct server_id; derive it from the ordinal,
+	// which is stable across pod restarts
+	if ordinal, ok := podOrdinal(pod.Name); ok {
+		if _, err := en.Exec(fmt.Sprintf("SET GLOBAL server_id = %d", ordinal+1)); err != nil {
+			return err
+		}
+	}
+
+	role := api.RoleReplica
+	if pod.Name == primaryName {
+		role = api.RolePrimary
+		// the source takes writes unless the whole database is read-only
+		if !px.Spec.ReadOnly {
+			if _, err := en.Exec("SET GLOBAL super_read_only = OFF"); err != nil {
+				return err
+			}
+			if _, err := en.Exec("SET GLOBAL read_only = OFF"); err != nil {
+				return err
+			}
+		}
+	} else {
+		if err := c.configureAsyncReplica(px, en, pod.Name, primaryName, replPassword, repoint); err != nil {
+			return err
+		}
+	}
+
+	if pod.Labels[api.LabelRole] != role {
+		if _, _, err := core_util.PatchPod(context.TODO(), c.Client, pod, func(in *core.Pod) *core.Pod {
+			in.Labels[api.LabelRole] = role
+			return in
+		}, metav1.PatchOptions{}); err != nil {
+			return err
+		}
+	}
+
+	// the replication lag readiness gate: a replica behind the threshold is
+	// held out of the service endpoints until it has caught up. The source
+	// itself always satisfies the gate.
+	if threshold := px.MaxReplicationLagSeconds(); threshold > 0 {
+		caughtUp := true
+		msg := "pod is the replication source"
+		if pod.Name != primaryName {
+			lag, err := replicaSecondsBehind(en)
+			if err != nil {
+				return err
+			}
+			caughtUp = replicaCaughtUp(lag, threshold)
+			if lag == nil {
+				msg = "replication is not running"
+			} else {
+				msg = fmt.Sprintf("replica is %d of at most %d seconds behind the source", *lag, threshold)
+			}
+		}
+		if err := c.syncReplicationReadinessGate(pod, caughtUp, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replicaSecondsBehind reads Seconds_Behind_Master from SHOW SLAVE STATUS,
+// the statement and column of the pinned 5.7 version; the newer
+// Seconds_Behind_Source spelling is scanned as well should the pin ever be
+// lifted. It returns nil when the pod has no replication configured or the
+// value is NULL, i.e. the SQL or IO thread is not running.
+func replicaSecondsBehind(en *sql.DB) (*int32, error) {
+	rows, err := en.Query("SHOW SLAVE STATUS")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	values := make([]interface{}, len(cols))
+	for i := range values {
+		values[i] = new(sql.RawBytes)
+	}
+	if err := rows.Scan(values...); err != nil {
+		return nil, err
+	}
+	for i, col := range cols {
+		if col != "Seconds_Behind_Source" && col != "Seconds_Behind_Master" {
+			continue
+		}
+		raw := *(values[i].(*sql.RawBytes))
+		if raw == nil {
+			return nil, nil
+		}
+		seconds, err := strconv.ParseInt(string(raw), 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		lag := int32(seconds)
+		return &lag, nil
+	}
+	return nil, nil
+}
+
+// replicaCaughtUp decides the readiness gate for a replica reporting the given
+// Seconds_Behind_Source. A nil lag means replication is not running, which
+// counts as not caught up.
+func replicaCaughtUp(lag *int32, threshold int32) bool {
+	return lag != nil && *lag <= threshold
+}
+
+// syncReplicationReadinessGate maintains the pod condition behind the
+// replication lag readiness gate. The kubelet only reports the pod Ready while
+// the condition is true, so flipping it removes the pod from every service
+// endpoint list until the next sync sets it back.
+func (c *Controller) syncReplicationReadinessGate(pod *core.Pod, caughtUp bool, message string) error {
+	status := core.ConditionFalse
+	reason := "LaggingBehindSource"
+	if caughtUp {
+		status = core.ConditionTrue
+		reason = "CaughtUp"
+	}
+	for _, cond := range pod.Status.Conditions {
+		if string(cond.Type) == api.PerconaXtraDBReplicationCaughtUpCondition && cond.Status == status {
+			return nil
+		}
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{
+			"conditions": []core.PodCondition{
+				{
+					Type:               core.PodConditionType(api.PerconaXtraDBReplicationCaughtUpCondition),
+					Status:             status,
+					LastTransitionTime: metav1.Now(),
+					Reason:             reason,
+					Message:            message,
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.Client.CoreV1().Pods(pod.Namespace).Patch(context.TODO(), pod.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{}, "status")
+	return err
+}
+
+// configureAsyncReplica points a pod at the current source with
+// CHANGE MASTER TO, using GTID auto positioning and the dedicated
+// replication user, and keeps it read-only. Already correctly configured
+// replicas are left untouched unless repoint forces the statement to be
+// re-run with a rotated password.
+func (c *Controller) configureAsyncReplica(px *api.PerconaXtraDB, en *sql.DB, podName, primaryName, password string, repoint bool) error {
+	primaryOrdinal, ok := podOrdinal(primaryName)
+	if !ok {
+		return fmt.Errorf("cannot derive the ordinal of primary pod %q", primaryName)
+	}
+	primaryHost := px.PeerName(primaryOrdinal)
+
+	var configuredHost string
+	if err := en.QueryRow(`SELECT HOST FROM performance_schema.replication_connection_configuration WHERE CHANNEL_NAME = ''`).Scan(&configuredHost); err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	if _, err := en.Exec("SET GLOBAL super_read_only = ON"); err != nil {
+		return err
+	}
+
+	if configuredHost == primaryHost && !repoint {
+		return nil
+	}
+
+	if _, err := en.Exec("STOP SLAVE"); err != nil {
+		return err
+	}
+	if _, err := en.Exec(fmt.Sprintf(
+		"CHANGE MASTER TO MASTER_HOST = '%s', MASTER_PORT = %d, MASTER_USER = '%s', MASTER_PASSWORD = %s, MASTER_AUTO_POSITION = 1",
+		primaryHost, px.SQLPort(),
+		replicationUsername, quoteStringLiteral(password))); err != nil {
+		return err
+	}
+	if _, err := en.Exec("START SLAVE"); err != nil {
+		return err
+	}
+
+	c.Recorder.Eventf(
+		px,
+		core.EventTypeNormal,
+		"ReplicaProvisioned",
+		"Pod %v now replicates from source %v",
+		podName, primaryHost,
+	)
+	return nil
+}
+
+// promoteAsyncPrimary detaches the promoted pod from its old source and
+// repoints the remaining replicas at it. The role labels and the primary
+// service are already moved by promotePrimary.
+func (c *Controller) promoteAsyncPrimary(px *api.PerconaXtraDB, newPrimary *core.Pod) error {
+	en, err := c.connectToPod(px, newPrimary.Status.PodIP)
+	if err != nil {
+		return err
+	}
+	defer en.Close()
+
+	if _, err := en.Exec("STOP SLAVE"); err != nil {
+		return err
+	}
+	if _, err := en.Exec("RESET SLAVE ALL"); err != nil {
+		return err
+	}
+	if !px.Spec.ReadOnly {
+		if _, err := en.Exec("SET GLOBAL super_read_only = OFF"); err != nil {
+			return err
+		}
+		if _, err := en.Exec("SET GLOBAL read_only = OFF"); err != nil {
+			return err
+		}
+	}
+
+	// the surviving replicas follow on the next health check tick as well;
+	// repointing them here just shortens the window without a source
+	return c.checkAsyncReplication(px)
+}
+
+// podExecutedGTIDs returns the number of transactions in a node's GTID
+// executed set, as a position comparable between the nodes of one database.
+func (c *Controller) podExecutedGTIDs(px *api.PerconaXtraDB, podIP string) (int64, error) {
+	set, err := c.podGTIDExecuted(px, podIP)
+	if err != nil {
+		return 0, err
+	}
+	return gtidSetSize(set)
+}
+
+// podOrdinal extracts the StatefulSet ordinal from a pod name.
+func podOrdinal(podName string) (int, bool) {
+	idx := strings.LastIndex(podName, "-")
+	if idx < 0 {
+		return 0, false
+	}
+	ordinal, err := strconv.Atoi(podName[idx+1:])
+	if err != nil {
+		return 0, false
+	}
+	return ordinal, true
+}
@@ -0,0 +1,45 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+)
+
+func TestReplicaCaughtUp(t *testing.T) {
+	lag := func(seconds int32) *int32 { return &seconds }
+
+	cases := []struct {
+		name      string
+		lag       *int32
+		threshold int32
+		caughtUp  bool
+	}{
+		{"below threshold", lag(5), 10, true},
+		{"at threshold", lag(10), 10, true},
+		{"crosses above threshold", lag(11), 10, false},
+		{"drops back below threshold", lag(9), 10, true},
+		{"zero lag", lag(0), 10, true},
+		{"replication not running", nil, 10, false},
+	}
+
+	for _, tc := range cases {
+		if got := replicaCaughtUp(tc.lag, tc.threshold); got != tc.caughtUp {
+			t.Errorf("replicaCaughtUp(%s) = %v, want %v", tc.name, got, tc.caughtUp)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	core_util "kmodules.xyz/client-go/core/v1"
+)
+
+const (
+	auditConfigFileName     = "audit.cnf"
+	auditLogFileName        = "audit.log"
+	auditForwarderContainer = "audit-forwarder"
+)
+
+func (c *Controller) auditConfigName(px *api.PerconaXtraDB) string {
+	return px.OffshootName() + "-audit-config"
+}
+
+// auditLogFilePath is where the audit_log plugin writes its records. With
+// spec.logStorage the file lands on the log volume, otherwise on a dedicated
+// emptyDir shared with the forwarder.
+func auditLogFilePath() string {
+	return api.PerconaXtraDBLogMountPath + "/" + auditLogFileName
+}
+
+// auditConfig renders the my.cnf snippet that loads the audit_log plugin with
+// the requested record format.
+func auditConfig(px *api.PerconaXtraDB) string {
+	return fmt.Sprintf(`[mysqld]
+plugin-load-add=audit_log.so
+audit_log_format=%v
+audit_log_file=%v
+audit_log_rotate_on_size=104857600
+audit_log_rotations=3
+`, px.AuditLogFormat(), auditLogFilePath())
+}
+
+// ensureAuditConfig creates a ConfigMap holding the my.cnf snippet that loads
+// the audit_log plugin with the requested record format.
+func (c *Controller) ensureAuditConfig(px *api.PerconaXtraDB) error {
+	owner := metav1.NewControllerRef(px, api.SchemeGroupVersion.WithKind(api.ResourceKindPerconaXtraDB))
+
+	cnf := auditConfig(px)
+
+	meta := metav1.ObjectMeta{
+		Name:      c.auditConfigName(px),
+		Namespace: px.Namespace,
+	}
+
+	_, _, err := core_util.CreateOrPatchConfigMap(context.TODO(), c.Client, meta, func(in *core.ConfigMap) *core.ConfigMap {
+		core_util.EnsureOwnerReference(&in.ObjectMeta, owner)
+		in.Labels = px.OffshootLabels()
+		in.Data = map[string]string{
+			auditConfigFileName: cnf,
+		}
+		return in
+	}, metav1.PatchOptions{})
+	return err
+}
+
+// auditForwarderSidecar builds the container tailing the audit file. The
+// default just streams the records to stdout, so the cluster log pipeline
+// picks them up; a dedicated forwarder image can replace it.
+func auditForwarderSidecar(px *api.PerconaXtraDB, logVolumeName, dbImage string) *core.Container {
+	image := px.Spec.AuditLog.ForwarderImage
+	if image == "" {
+		image = dbImage
+	}
+	return &core.Container{
+		Name:  auditForwarderContainer,
+		Image: image,
+		Command: []string{
+			"bash",
+		},
+		Args: []string{
+			"-c",
+			fmt.Sprintf(`touch %[1]v
+exec tail -n+1 -F %[1]v`, auditLogFilePath()),
+		},
+		VolumeMounts: []core.VolumeMount{
+			{
+				Name:      logVolumeName,
+				MountPath: api.PerconaXtraDBLogMountPath,
+			},
+		},
+		Resources: px.Spec.AuditLog.Resources,
+	}
+}
@@ -0,0 +1,131 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// dbBackoffBase is the delay after the first transient connectivity failure;
+// every further consecutive failure doubles it, up to the configured maximum.
+const dbBackoffBase = 10 * time.Second
+
+// defaultDBBackoffMax caps the backoff when no --db-connect-backoff-max flag
+// is given.
+const defaultDBBackoffMax = 5 * time.Minute
+
+// transientError marks an error as a transient database connectivity problem.
+// Reconciles failing with one are retried with exponential backoff instead of
+// immediately, while every other error keeps the queue's normal fail-fast
+// behavior.
+type transientError struct {
+	err error
+}
+
+func (e transientError) Error() string { return e.err.Error() }
+func (e transientError) Unwrap() error { return e.err }
+
+// markTransient wraps err as a transient connectivity error. A nil error
+// stays nil.
+func markTransient(err error) error {
+	if err == nil {
+		return nil
+	}
+	return transientError{err: err}
+}
+
+// isTransientError walks the wrap chain looking for a transientError.
+func isTransientError(err error) bool {
+	for err != nil {
+		if _, ok := err.(transientError); ok {
+			return true
+		}
+		wrapped, ok := err.(interface{ Unwrap() error })
+		if !ok {
+			return false
+		}
+		err = wrapped.Unwrap()
+	}
+	return false
+}
+
+// markTransientIfTimeout wraps err as transient when it is a connect or query
+// timeout, so the reconcile is retried with backoff instead of failing fast.
+// Every other error, an authentication failure for example, is returned
+// unchanged.
+func markTransientIfTimeout(err error) error {
+	if isTimeoutError(err) {
+		return markTransient(err)
+	}
+	return err
+}
+
+// isTimeoutError walks the wrap chain looking for a timed-out network
+// operation. The mysql driver reports a timeout on a busy connection as
+// ErrInvalidConn, so that counts too.
+func isTimeoutError(err error) bool {
+	for err != nil {
+		if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+			return true
+		}
+		if err == context.DeadlineExceeded || err == mysql.ErrInvalidConn {
+			return true
+		}
+		wrapped, ok := err.(interface{ Unwrap() error })
+		if !ok {
+			return false
+		}
+		err = wrapped.Unwrap()
+	}
+	return false
+}
+
+// nextBackoff doubles the backoff of the given object and returns the delay
+// to wait before the next attempt. State is kept per object, so one flapping
+// database does not slow down the others.
+func (c *Controller) nextBackoff(key string) time.Duration {
+	max := c.dbConnectBackoffMax
+	if max <= 0 {
+		max = defaultDBBackoffMax
+	}
+
+	c.backoffMutex.Lock()
+	defer c.backoffMutex.Unlock()
+	delay := c.dbBackoff[key]
+	if delay < dbBackoffBase {
+		delay = dbBackoffBase
+	} else {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	c.dbBackoff[key] = delay
+	return delay
+}
+
+// clearBackoff resets the backoff of the given object after a successful
+// reconcile.
+func (c *Controller) clearBackoff(key string) {
+	c.backoffMutex.Lock()
+	defer c.backoffMutex.Unlock()
+	delete(c.dbBackoff, key)
+}
@@ -0,0 +1,50 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+)
+
+// TestMarkTransientIfTimeout checks that connect/query timeouts are
+// categorized as transient, even when wrapped, while other failures keep the
+// queue's fail-fast behavior.
+func TestMarkTransientIfTimeout(t *testing.T) {
+	timeout := &net.OpError{Op: "dial", Err: context.DeadlineExceeded}
+	cases := []struct {
+		name      string
+		err       error
+		transient bool
+	}{
+		{"nil", nil, false},
+		{"dial timeout", timeout, true},
+		{"wrapped dial timeout", errors.Wrap(timeout, "failed to connect"), true},
+		{"deadline exceeded", context.DeadlineExceeded, true},
+		{"invalid connection", mysql.ErrInvalidConn, true},
+		{"access denied", errors.New("Error 1045: Access denied"), false},
+	}
+	for _, c := range cases {
+		if got := isTransientError(markTransientIfTimeout(c.err)); got != c.transient {
+			t.Errorf("%s: transient = %v, want %v", c.name, got, c.transient)
+		}
+	}
+}
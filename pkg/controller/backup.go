@@ -0,0 +1,109 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+
+	"github.com/appscode/go/log"
+	"github.com/pkg/errors"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	core_util "kmodules.xyz/client-go/core/v1"
+	appcat "kmodules.xyz/custom-resources/apis/appcatalog/v1alpha1"
+	stash_v1alpha1 "stash.appscode.dev/apimachinery/apis/stash/v1alpha1"
+	stash_v1beta1 "stash.appscode.dev/apimachinery/apis/stash/v1beta1"
+	stash_util "stash.appscode.dev/apimachinery/client/clientset/versioned/typed/stash/v1beta1/util"
+)
+
+func (c *Controller) backupConfigurationName(px *api.PerconaXtraDB) string {
+	return px.OffshootName() + "-backup"
+}
+
+// ensureBackupConfiguration creates the Stash BackupConfiguration declared in
+// spec.backup, targeting the AppBinding of this database. The object is owned
+// by the database, so its lifecycle follows the database object; clearing
+// spec.backup removes it again. Older snapshots are pruned with a keep-last-5
+// retention, matching what Stash defaults a hand-written configuration to.
+func (c *Controller) ensureBackupConfiguration(px *api.PerconaXtraDB) error {
+	if px.Spec.Backup == nil {
+		return c.deleteBackupConfiguration(px)
+	}
+
+	// the referenced repository has to exist; a BackupConfiguration against a
+	// missing repository would just produce failed sessions
+	if _, err := c.Initializers.Stash.StashClient.StashV1alpha1().Repositories(px.Namespace).Get(context.TODO(), px.Spec.Backup.Repository, metav1.GetOptions{}); err != nil {
+		if kerr.IsNotFound(err) {
+			c.Recorder.Eventf(
+				px,
+				core.EventTypeWarning,
+				"BackupRepositoryMissing",
+				"Repository %v referenced in 'spec.backup.repository' not found; backups are not scheduled until it exists",
+				px.Spec.Backup.Repository,
+			)
+			return errors.Errorf(`repository "%v/%v" referenced in 'spec.backup.repository' not found`, px.Namespace, px.Spec.Backup.Repository)
+		}
+		return err
+	}
+
+	owner := metav1.NewControllerRef(px, api.SchemeGroupVersion.WithKind(api.ResourceKindPerconaXtraDB))
+
+	meta := metav1.ObjectMeta{
+		Name:      c.backupConfigurationName(px),
+		Namespace: px.Namespace,
+	}
+
+	_, _, err := stash_util.CreateOrPatchBackupConfiguration(context.TODO(), c.Initializers.Stash.StashClient.StashV1beta1(), meta, func(in *stash_v1beta1.BackupConfiguration) *stash_v1beta1.BackupConfiguration {
+		core_util.EnsureOwnerReference(&in.ObjectMeta, owner)
+		in.Labels = px.OffshootLabels()
+		in.Spec.Schedule = px.Spec.Backup.Schedule
+		in.Spec.Repository = core.LocalObjectReference{Name: px.Spec.Backup.Repository}
+		in.Spec.Task = stash_v1beta1.TaskRef{Name: px.Spec.Backup.Task}
+		in.Spec.Target = &stash_v1beta1.BackupTarget{
+			Ref: stash_v1beta1.TargetRef{
+				APIVersion: appcat.SchemeGroupVersion.String(),
+				Kind:       appcat.ResourceKindApp,
+				Name:       px.AppBindingMeta().Name(),
+			},
+		}
+		in.Spec.RetentionPolicy = stash_v1alpha1.RetentionPolicy{
+			Name:     "keep-last-5",
+			KeepLast: 5,
+			Prune:    true,
+		}
+		return in
+	}, metav1.PatchOptions{})
+	return err
+}
+
+// deleteBackupConfiguration removes the operator-created BackupConfiguration.
+// Hand-written configurations are not touched, since they do not carry the
+// generated name.
+func (c *Controller) deleteBackupConfiguration(px *api.PerconaXtraDB) error {
+	err := c.Initializers.Stash.StashClient.StashV1beta1().BackupConfigurations(px.Namespace).Delete(context.TODO(), c.backupConfigurationName(px), metav1.DeleteOptions{})
+	if err != nil {
+		if kerr.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	log.Infof("Deleted BackupConfiguration %v/%v of PerconaXtraDB %v", px.Namespace, c.backupConfigurationName(px), px.Name)
+	return nil
+}
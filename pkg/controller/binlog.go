@@ -0,0 +1,133 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	core_util "kmodules.xyz/client-go/core/v1"
+)
+
+const (
+	binlogConfigFileName      = "binlog.cnf"
+	binlogRetentionAnnotation = api.PerconaXtraDBKey + "/binlog-retention"
+)
+
+func (c *Controller) binlogConfigName(px *api.PerconaXtraDB) string {
+	return px.OffshootName() + "-binlog-config"
+}
+
+// usesLegacyBinlogExpiry reports whether the server only understands the 5.7
+// expire_logs_days variable instead of binlog_expire_logs_seconds. Clusters
+// are pinned to 5.7 by the validator; standalone servers go by their version.
+func usesLegacyBinlogExpiry(px *api.PerconaXtraDB) bool {
+	return px.IsCluster() || strings.HasPrefix(string(px.Spec.Version), "5.")
+}
+
+// binlogExpireDays rounds the retention up to full days, so the binlogs are
+// kept at least as long as requested.
+func binlogExpireDays(seconds int64) int64 {
+	return (seconds + 24*60*60 - 1) / (24 * 60 * 60)
+}
+
+// binlogConfig renders the my.cnf snippet with the binlog retention from
+// spec.binlogRetention. 5.7 only knows the day-granular expire_logs_days, so
+// there the retention is rounded up to full days.
+func binlogConfig(px *api.PerconaXtraDB, seconds int64) string {
+	if usesLegacyBinlogExpiry(px) {
+		return fmt.Sprintf(`[mysqld]
+expire_logs_days=%d
+`, binlogExpireDays(seconds))
+	}
+	return fmt.Sprintf(`[mysqld]
+binlog_expire_logs_seconds=%d
+`, seconds)
+}
+
+// ensureBinlogConfig creates a ConfigMap holding the my.cnf snippet with the
+// binlog retention from spec.binlogRetention, so the setting survives server
+// restarts.
+func (c *Controller) ensureBinlogConfig(px *api.PerconaXtraDB, seconds int64) error {
+	owner := metav1.NewControllerRef(px, api.SchemeGroupVersion.WithKind(api.ResourceKindPerconaXtraDB))
+
+	cnf := binlogConfig(px, seconds)
+
+	meta := metav1.ObjectMeta{
+		Name:      c.binlogConfigName(px),
+		Namespace: px.Namespace,
+	}
+
+	_, _, err := core_util.CreateOrPatchConfigMap(context.TODO(), c.Client, meta, func(in *core.ConfigMap) *core.ConfigMap {
+		core_util.EnsureOwnerReference(&in.ObjectMeta, owner)
+		in.Labels = px.OffshootLabels()
+		in.Data = map[string]string{
+			binlogConfigFileName: cnf,
+		}
+		return in
+	}, metav1.PatchOptions{})
+	return err
+}
+
+// isBinlogRetentionChanging reports whether the running StatefulSet still
+// carries a retention different from spec.binlogRetention, based on the
+// retention annotation.
+func (c *Controller) isBinlogRetentionChanging(px *api.PerconaXtraDB) (bool, error) {
+	sts, err := c.Client.AppsV1().StatefulSets(px.Namespace).Get(context.TODO(), px.OffshootName(), metav1.GetOptions{})
+	if err != nil {
+		if kerr.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return sts.Spec.Template.Annotations[binlogRetentionAnnotation] != px.Spec.PodTemplate.Annotations[binlogRetentionAnnotation], nil
+}
+
+// applyBinlogRetention pushes a changed spec.binlogRetention to the running
+// servers via SET GLOBAL. Both binlog_expire_logs_seconds and the 5.7
+// expire_logs_days are dynamic variables, so no restart is needed; the
+// generated config file carries the value across restarts. Clearing the
+// retention leaves the running servers untouched until their next restart,
+// which falls back to the server default.
+func (c *Controller) applyBinlogRetention(px *api.PerconaXtraDB) error {
+	changed, err := c.isBinlogRetentionChanging(px)
+	if err != nil {
+		return err
+	}
+	if !changed {
+		return nil
+	}
+	seconds := px.BinlogExpireSeconds()
+	if seconds == 0 {
+		return nil
+	}
+	if usesLegacyBinlogExpiry(px) {
+		return c.applyDynamicConfig(px, map[string]string{
+			"expire_logs_days": strconv.FormatInt(binlogExpireDays(seconds), 10),
+		})
+	}
+	return c.applyDynamicConfig(px, map[string]string{
+		"binlog_expire_logs_seconds": strconv.FormatInt(seconds, 10),
+	})
+}
@@ -0,0 +1,415 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+	"kubedb.dev/apimachinery/client/clientset/versioned/typed/kubedb/v1alpha2/util"
+
+	"github.com/appscode/go/log"
+	"github.com/appscode/go/types"
+	apps "k8s.io/api/apps/v1"
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	kutil "kmodules.xyz/client-go"
+	kmapi "kmodules.xyz/client-go/api/v1"
+	core_util "kmodules.xyz/client-go/core/v1"
+)
+
+const (
+	// bootstrapOrdinalAnnotation forces the named ordinal to be the bootstrap
+	// node on full-outage recovery, for when the user knows which node holds
+	// the most advanced data.
+	bootstrapOrdinalAnnotation = api.PerconaXtraDBKey + "/bootstrap-ordinal"
+
+	// bootstrapPodAnnotation records the bootstrap node the operator settled
+	// on. While set, the pod template carries an init container that flips
+	// safe_to_bootstrap in the grastate.dat of that node; the annotation is
+	// cleared once the cluster has regained quorum.
+	bootstrapPodAnnotation = api.PerconaXtraDBKey + "/bootstrap-pod"
+)
+
+// recordSeqno remembers the last committed seqno a cluster node reported while
+// it was reachable. After a full outage this equals the seqno in the node's
+// grastate.dat, since every node went through the same final transactions.
+func (c *Controller) recordSeqno(px *api.PerconaXtraDB, podName string, seqno int64) {
+	c.bootstrapMutex.Lock()
+	defer c.bootstrapMutex.Unlock()
+	c.lastSeqno[px.Namespace+"/"+px.Name+"/"+podName] = seqno
+}
+
+// armBootstrapRecovery picks the bootstrap node for a cluster whose nodes are
+// all down and records the choice in the bootstrap-pod annotation: the ordinal
+// forced by the bootstrap-ordinal annotation when present, otherwise the node
+// with the highest seqno observed before the outage. When nothing is on record
+// and spec.allowUnsafeRecovery is set, the seqnos are read from the
+// grastate.dat files on the data volumes instead. The decision is recorded as
+// an event and in the RecoveryPerformed condition.
+func (c *Controller) armBootstrapRecovery(px *api.PerconaXtraDB) error {
+	if px.Annotations[bootstrapPodAnnotation] != "" {
+		return nil
+	}
+
+	podName, reason := c.chooseBootstrapPod(px)
+	if podName == "" {
+		// nothing on record, typically because the operator itself restarted
+		// during the outage. The seqnos then have to come from the
+		// grastate.dat files, and bootstrapping from those cannot be
+		// cross-checked against a live node, so it requires the explicit
+		// opt-in.
+		if !px.Spec.AllowUnsafeRecovery {
+			log.Warningf("PerconaXtraDB %v/%v is fully down with no seqno on record. Set 'spec.allowUnsafeRecovery' to let the operator inspect the grastate.dat files and bootstrap from the most advanced node, or force a node with the %s annotation",
+				px.Namespace, px.Name, bootstrapOrdinalAnnotation)
+			c.Recorder.Eventf(
+				px,
+				core.EventTypeWarning,
+				"RecoveryBlocked",
+				"Cluster is fully down and automatic recovery is not allowed. Set 'spec.allowUnsafeRecovery' or the %s annotation",
+				bootstrapOrdinalAnnotation,
+			)
+			return nil
+		}
+		done, err := c.inspectGrastate(px)
+		if err != nil {
+			return err
+		}
+		if !done {
+			log.Infof("PerconaXtraDB %v/%v: waiting for the grastate inspection jobs to finish", px.Namespace, px.Name)
+			return nil
+		}
+		podName, reason = c.chooseBootstrapPod(px)
+		if podName == "" {
+			// every grastate.dat reported seqno -1, i.e. no node shut down
+			// cleanly; with the opt-in given, falling back to the first
+			// ordinal beats staying down forever
+			podName = fmt.Sprintf("%s-0", px.OffshootName())
+			reason = "every grastate.dat reports seqno -1; defaulting to the first ordinal under 'spec.allowUnsafeRecovery'"
+		}
+	}
+
+	return c.recordBootstrapChoice(px, podName, reason)
+}
+
+// recordBootstrapChoice pins the chosen bootstrap node in the bootstrap-pod
+// annotation and surfaces the decision as an event and condition.
+func (c *Controller) recordBootstrapChoice(px *api.PerconaXtraDB, podName, reason string) error {
+	per, _, err := util.PatchPerconaXtraDB(context.TODO(), c.DBClient.KubedbV1alpha2(), px, func(in *api.PerconaXtraDB) *api.PerconaXtraDB {
+		if in.Annotations == nil {
+			in.Annotations = map[string]string{}
+		}
+		in.Annotations[bootstrapPodAnnotation] = podName
+		return in
+	}, metav1.PatchOptions{})
+	if err != nil {
+		return err
+	}
+	px.Annotations = per.Annotations
+
+	log.Infof("PerconaXtraDB %v/%v: selected pod %v as the bootstrap node. Reason: %s", px.Namespace, px.Name, podName, reason)
+	c.Recorder.Eventf(
+		px,
+		core.EventTypeNormal,
+		"BootstrapNodeSelected",
+		"Selected pod %v as the bootstrap node for full cluster recovery. Reason: %s",
+		podName, reason,
+	)
+	return c.setRecoveryPerformedCondition(px, podName, reason)
+}
+
+// armUnhaltBootstrap picks the bootstrap node for a Galera cluster resuming
+// from spec.halted. The halt scaled the pods down in reverse ordinal order
+// after a clean shutdown, so the preserved grastate.dat files are
+// authoritative and inspecting them needs no unsafe-recovery opt-in.
+// Standalone databases and async clusters restart without a bootstrap
+// decision.
+func (c *Controller) armUnhaltBootstrap(px *api.PerconaXtraDB) error {
+	if !px.IsCluster() || px.UsesAsyncReplication() {
+		return nil
+	}
+	if px.Annotations[bootstrapPodAnnotation] != "" {
+		return nil
+	}
+	if err := wait.PollImmediate(kutil.RetryInterval, kutil.GCTimeout, func() (bool, error) {
+		return c.inspectGrastate(px)
+	}); err != nil {
+		return err
+	}
+	podName, reason := c.chooseBootstrapPod(px)
+	if podName == "" {
+		// every grastate.dat reported seqno -1; the first ordinal was the
+		// last node running before the halt, so it is the safe default
+		podName = fmt.Sprintf("%s-0", px.OffshootName())
+		reason = "no usable seqno in the preserved grastate.dat files; defaulting to the first ordinal"
+	}
+	return c.recordBootstrapChoice(px, podName, reason)
+}
+
+// chooseBootstrapPod resolves which pod may bootstrap the cluster, along with
+// the reason for the choice. An empty pod name means nothing is forced and no
+// seqno is on record; the caller decides how to fill the gap.
+func (c *Controller) chooseBootstrapPod(px *api.PerconaXtraDB) (string, string) {
+	replicas := types.Int32(px.Spec.Replicas)
+	if raw, ok := px.Annotations[bootstrapOrdinalAnnotation]; ok {
+		if ordinal, err := strconv.Atoi(raw); err == nil && ordinal >= 0 && ordinal < int(replicas) {
+			return fmt.Sprintf("%s-%d", px.OffshootName(), ordinal), "forced by the " + bootstrapOrdinalAnnotation + " annotation"
+		}
+		log.Infof("ignoring invalid %s annotation %q on PerconaXtraDB %v/%v", bootstrapOrdinalAnnotation, raw, px.Namespace, px.Name)
+	}
+
+	c.bootstrapMutex.Lock()
+	defer c.bootstrapMutex.Unlock()
+	var chosen string
+	var chosenSeqno int64 = -1
+	for i := 0; i < int(replicas); i++ {
+		podName := fmt.Sprintf("%s-%d", px.OffshootName(), i)
+		if seqno, ok := c.lastSeqno[px.Namespace+"/"+px.Name+"/"+podName]; ok && seqno > chosenSeqno {
+			chosen = podName
+			chosenSeqno = seqno
+		}
+	}
+	if chosen == "" {
+		return "", "no seqno on record"
+	}
+	return chosen, fmt.Sprintf("highest recorded seqno %d", chosenSeqno)
+}
+
+// grastateJobName returns the name of the short-lived job that reads the
+// grastate.dat on the data volume of the given ordinal.
+func grastateJobName(px *api.PerconaXtraDB, ordinal int) string {
+	return fmt.Sprintf("%s-grastate-%d", px.OffshootName(), ordinal)
+}
+
+// inspectGrastate reads the grastate.dat of every cluster node through
+// short-lived jobs that mount the node's data volume and write the seqno to
+// their termination message. The collected seqnos are recorded as if the
+// nodes had reported them while running, so chooseBootstrapPod can pick the
+// most advanced node. Returns false while jobs are still running; the health
+// check loop retries on its next tick.
+func (c *Controller) inspectGrastate(px *api.PerconaXtraDB) (bool, error) {
+	pxVersion, err := c.DBClient.CatalogV1alpha1().PerconaXtraDBVersions().Get(context.TODO(), string(px.Spec.Version), metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+
+	replicas := int(types.Int32(px.Spec.Replicas))
+	owner := metav1.NewControllerRef(px, api.SchemeGroupVersion.WithKind(api.ResourceKindPerconaXtraDB))
+
+	done := true
+	succeeded := 0
+	for i := 0; i < replicas; i++ {
+		job, err := c.Client.BatchV1().Jobs(px.Namespace).Get(context.TODO(), grastateJobName(px, i), metav1.GetOptions{})
+		if kerr.IsNotFound(err) {
+			if err := c.createGrastateJob(px, initHelperImage(px, pxVersion.Spec.InitContainer.Image), owner, i); err != nil {
+				return false, err
+			}
+			log.Infof("PerconaXtraDB %v/%v: launched job %v to inspect the grastate.dat of ordinal %d", px.Namespace, px.Name, grastateJobName(px, i), i)
+			done = false
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		if job.Status.Succeeded == 0 && job.Status.Failed == 0 {
+			done = false
+			continue
+		}
+		if job.Status.Failed > 0 {
+			log.Warningf("grastate inspection job %v/%v failed; pod %v-%d is skipped as a bootstrap candidate", px.Namespace, job.Name, px.OffshootName(), i)
+			continue
+		}
+		seqno, err := c.grastateJobResult(px, job.Name)
+		if err != nil {
+			log.Warningln(err)
+			continue
+		}
+		podName := fmt.Sprintf("%s-%d", px.OffshootName(), i)
+		log.Infof("PerconaXtraDB %v/%v: grastate.dat of pod %v reports seqno %d", px.Namespace, px.Name, podName, seqno)
+		c.recordSeqno(px, podName, seqno)
+		succeeded++
+	}
+	if !done {
+		return false, nil
+	}
+
+	// every job finished; clean them up regardless of outcome so a later
+	// outage starts with a fresh inspection
+	policy := metav1.DeletePropagationBackground
+	for i := 0; i < replicas; i++ {
+		if err := c.Client.BatchV1().Jobs(px.Namespace).Delete(context.TODO(), grastateJobName(px, i), metav1.DeleteOptions{PropagationPolicy: &policy}); err != nil && !kerr.IsNotFound(err) {
+			return false, err
+		}
+	}
+	if succeeded == 0 {
+		return false, fmt.Errorf("could not read the grastate.dat of any node of PerconaXtraDB %v/%v", px.Namespace, px.Name)
+	}
+	return true, nil
+}
+
+// createGrastateJob launches a job that mounts the data volume of the given
+// ordinal read-only and writes the seqno line of grastate.dat to its
+// termination message.
+func (c *Controller) createGrastateJob(px *api.PerconaXtraDB, image string, owner *metav1.OwnerReference, ordinal int) error {
+	job := &batch.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      grastateJobName(px, ordinal),
+			Namespace: px.Namespace,
+			Labels:    px.OffshootLabels(),
+		},
+		Spec: batch.JobSpec{
+			BackoffLimit: types.Int32P(0),
+			Template: core.PodTemplateSpec{
+				Spec: core.PodSpec{
+					RestartPolicy: core.RestartPolicyNever,
+					Containers: []core.Container{
+						{
+							Name:            "read-grastate",
+							Image:           image,
+							ImagePullPolicy: core.PullIfNotPresent,
+							Command: []string{
+								"sh",
+								"-c",
+								fmt.Sprintf(`if [ -f %[1]s/grastate.dat ]; then awk '/^seqno:/ {print $2}' %[1]s/grastate.dat > /dev/termination-log; else echo -1 > /dev/termination-log; fi`, api.PerconaXtraDBDataMountPath),
+							},
+							VolumeMounts: []core.VolumeMount{
+								{
+									Name:      "data",
+									MountPath: api.PerconaXtraDBDataMountPath,
+								},
+							},
+						},
+					},
+					Volumes: []core.Volume{
+						{
+							Name: "data",
+							VolumeSource: core.VolumeSource{
+								PersistentVolumeClaim: &core.PersistentVolumeClaimVolumeSource{
+									ClaimName: fmt.Sprintf("data-%s-%d", px.OffshootName(), ordinal),
+									ReadOnly:  true,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	core_util.EnsureOwnerReference(&job.ObjectMeta, owner)
+	_, err := c.Client.BatchV1().Jobs(px.Namespace).Create(context.TODO(), job, metav1.CreateOptions{})
+	if kerr.IsAlreadyExists(err) {
+		return nil
+	}
+	return err
+}
+
+// grastateJobResult parses the seqno a finished inspection job wrote to its
+// termination message.
+func (c *Controller) grastateJobResult(px *api.PerconaXtraDB, jobName string) (int64, error) {
+	pods, err := c.Client.CoreV1().Pods(px.Namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(map[string]string{"job-name": jobName}).String(),
+	})
+	if err != nil {
+		return 0, err
+	}
+	for i := range pods.Items {
+		for _, cs := range pods.Items[i].Status.ContainerStatuses {
+			if cs.State.Terminated == nil || cs.State.Terminated.ExitCode != 0 {
+				continue
+			}
+			seqno, err := strconv.ParseInt(strings.TrimSpace(cs.State.Terminated.Message), 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("job %v/%v wrote an unparsable grastate seqno %q", px.Namespace, jobName, cs.State.Terminated.Message)
+			}
+			return seqno, nil
+		}
+	}
+	return 0, fmt.Errorf("job %v/%v finished, but no terminated container with a grastate seqno was found", px.Namespace, jobName)
+}
+
+// setRecoveryPerformedCondition records on the status that the operator
+// bootstrapped the cluster after a full outage.
+func (c *Controller) setRecoveryPerformedCondition(px *api.PerconaXtraDB, podName, reason string) error {
+	per, err := util.UpdatePerconaXtraDBStatus(context.TODO(), c.DBClient.KubedbV1alpha2(), px.ObjectMeta, func(in *api.PerconaXtraDBStatus) *api.PerconaXtraDBStatus {
+		in.Conditions = kmapi.SetCondition(in.Conditions, kmapi.NewCondition(
+			api.DatabaseRecoveryPerformed,
+			fmt.Sprintf("Cluster was bootstrapped from pod %s after a full outage. Reason: %s", podName, reason),
+			px.Generation,
+		))
+		return in
+	}, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+	px.Status = per.Status
+	return nil
+}
+
+// clearBootstrapRecovery removes the recovery annotation once the cluster has
+// regained quorum, so the next reconcile drops the recovery init container
+// from the pod template.
+func (c *Controller) clearBootstrapRecovery(px *api.PerconaXtraDB) error {
+	if px.Annotations[bootstrapPodAnnotation] == "" {
+		return nil
+	}
+	per, _, err := util.PatchPerconaXtraDB(context.TODO(), c.DBClient.KubedbV1alpha2(), px, func(in *api.PerconaXtraDB) *api.PerconaXtraDB {
+		delete(in.Annotations, bootstrapPodAnnotation)
+		return in
+	}, metav1.PatchOptions{})
+	if err != nil {
+		return err
+	}
+	px.Annotations = per.Annotations
+	log.Infof("PerconaXtraDB %v/%v regained quorum; bootstrap recovery disarmed", px.Namespace, px.Name)
+	return nil
+}
+
+// recreateStalePods deletes down pods that do not run the updated pod template
+// yet. Init containers only run on pod creation and the rolling update stalls
+// on the unready predecessors, so during a full outage the stale pods are
+// removed outright and the StatefulSet recreates them with the recovery init
+// container in place.
+func (c *Controller) recreateStalePods(px *api.PerconaXtraDB, pods *core.PodList) error {
+	sts, err := c.Client.AppsV1().StatefulSets(px.Namespace).Get(context.TODO(), px.OffshootName(), metav1.GetOptions{})
+	if err != nil {
+		if kerr.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if sts.Status.UpdateRevision == "" {
+		return nil
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Labels[apps.ControllerRevisionHashLabelKey] == sts.Status.UpdateRevision {
+			continue
+		}
+		if err := c.Client.CoreV1().Pods(px.Namespace).Delete(context.TODO(), pod.Name, metav1.DeleteOptions{}); err != nil && !kerr.IsNotFound(err) {
+			return err
+		}
+		log.Infof("deleted stale pod %v/%v so it restarts with the recovery init container", pod.Namespace, pod.Name)
+	}
+	return nil
+}
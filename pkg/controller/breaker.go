@@ -0,0 +1,112 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"kubedb.dev/apimachinery/apis/kubedb"
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+	"kubedb.dev/apimachinery/client/clientset/versioned/typed/kubedb/v1alpha2/util"
+
+	"github.com/appscode/go/log"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kmapi "kmodules.xyz/client-go/api/v1"
+)
+
+// resumeReconcileAnnotation lets an operator resume a circuit-broken object
+// without changing its spec.
+const resumeReconcileAnnotation = kubedb.GroupName + "/resume"
+
+// recordReconcileFailure counts a failed reconcile and returns the number of
+// consecutive failures of the object.
+func (c *Controller) recordReconcileFailure(key string) int32 {
+	c.failureMutex.Lock()
+	defer c.failureMutex.Unlock()
+	c.reconcileFailures[key]++
+	return c.reconcileFailures[key]
+}
+
+// clearReconcileFailures resets the consecutive-failure counter after a
+// successful reconcile.
+func (c *Controller) clearReconcileFailures(key string) {
+	c.failureMutex.Lock()
+	defer c.failureMutex.Unlock()
+	delete(c.reconcileFailures, key)
+}
+
+// breakReconcile opens the circuit breaker once an object has failed
+// maxReconcileFailures times in a row: a ReconcileHalted condition records the
+// last error and reconcileBroken skips the object from then on. It reports
+// whether the breaker opened.
+func (c *Controller) breakReconcile(px *api.PerconaXtraDB, key string, lastErr error) bool {
+	if c.maxReconcileFailures <= 0 {
+		return false
+	}
+	count := c.recordReconcileFailure(key)
+	if count < c.maxReconcileFailures {
+		return false
+	}
+
+	msg := fmt.Sprintf("Reconciliation halted after %d consecutive failures. Last error: %v. Update the spec or add the %q annotation to resume",
+		count, lastErr, resumeReconcileAnnotation)
+	c.Recorder.Eventf(
+		px,
+		core.EventTypeWarning,
+		api.DatabaseReconcileHalted,
+		"Reconciliation of PerconaXtraDB %v/%v halted after %d consecutive failures. Last error: %v",
+		px.Namespace, px.Name, count, lastErr,
+	)
+	per, err := util.UpdatePerconaXtraDBStatus(context.TODO(), c.DBClient.KubedbV1alpha2(), px.ObjectMeta, func(in *api.PerconaXtraDBStatus) *api.PerconaXtraDBStatus {
+		in.Conditions = kmapi.SetCondition(in.Conditions, kmapi.NewCondition(api.DatabaseReconcileHalted, msg, px.Generation))
+		return in
+	}, metav1.UpdateOptions{})
+	if err != nil {
+		log.Errorln(err)
+		return true
+	}
+	px.Status = per.Status
+	return true
+}
+
+// reconcileBroken reports whether the object is circuit-broken. A spec change
+// or the resume annotation closes the breaker again and clears the condition.
+func (c *Controller) reconcileBroken(px *api.PerconaXtraDB) bool {
+	_, cond := kmapi.GetCondition(px.Status.Conditions, api.DatabaseReconcileHalted)
+	if cond == nil || cond.Status != core.ConditionTrue {
+		return false
+	}
+
+	_, resumed := px.Annotations[resumeReconcileAnnotation]
+	if !resumed && cond.ObservedGeneration == px.Generation {
+		return true
+	}
+
+	c.clearReconcileFailures(px.Namespace + "/" + px.Name)
+	per, err := util.UpdatePerconaXtraDBStatus(context.TODO(), c.DBClient.KubedbV1alpha2(), px.ObjectMeta, func(in *api.PerconaXtraDBStatus) *api.PerconaXtraDBStatus {
+		in.Conditions = kmapi.RemoveCondition(in.Conditions, api.DatabaseReconcileHalted)
+		return in
+	}, metav1.UpdateOptions{})
+	if err != nil {
+		log.Errorln(err)
+		return true
+	}
+	px.Status = per.Status
+	return false
+}
@@ -0,0 +1,94 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	core_util "kmodules.xyz/client-go/core/v1"
+)
+
+const (
+	autoTuneConfigFileName   = "auto-tune.cnf"
+	bufferPoolSizeAnnotation = api.PerconaXtraDBKey + "/buffer-pool-size"
+)
+
+func (c *Controller) autoTuneConfigName(px *api.PerconaXtraDB) string {
+	return px.OffshootName() + "-auto-tune-config"
+}
+
+// computeBufferPoolSize returns the innodb_buffer_pool_size in bytes derived
+// from the memory limit of the database container, or 0 when no limit is set
+// and the server default should be kept.
+func computeBufferPoolSize(px *api.PerconaXtraDB) int64 {
+	limit, found := px.Spec.PodTemplate.Spec.Resources.Limits[core.ResourceMemory]
+	if !found || limit.IsZero() {
+		return 0
+	}
+	return limit.Value() * int64(px.BufferPoolMemoryPercentage()) / 100
+}
+
+// autoTuneConfig renders the my.cnf snippet with the computed buffer pool
+// size.
+func autoTuneConfig(size int64) string {
+	return fmt.Sprintf(`[mysqld]
+innodb_buffer_pool_size=%d
+`, size)
+}
+
+// ensureAutoTuneConfig creates a ConfigMap holding the my.cnf snippet with the
+// computed buffer pool size.
+func (c *Controller) ensureAutoTuneConfig(px *api.PerconaXtraDB, size int64) error {
+	owner := metav1.NewControllerRef(px, api.SchemeGroupVersion.WithKind(api.ResourceKindPerconaXtraDB))
+
+	cnf := autoTuneConfig(size)
+
+	meta := metav1.ObjectMeta{
+		Name:      c.autoTuneConfigName(px),
+		Namespace: px.Namespace,
+	}
+
+	_, _, err := core_util.CreateOrPatchConfigMap(context.TODO(), c.Client, meta, func(in *core.ConfigMap) *core.ConfigMap {
+		core_util.EnsureOwnerReference(&in.ObjectMeta, owner)
+		in.Labels = px.OffshootLabels()
+		in.Data = map[string]string{
+			autoTuneConfigFileName: cnf,
+		}
+		return in
+	}, metav1.PatchOptions{})
+	return err
+}
+
+// isBufferPoolChanging reports whether the running StatefulSet still carries a
+// buffer pool size different from the one computed for the current memory
+// limit, in which case the new value has to be rolled out.
+func (c *Controller) isBufferPoolChanging(px *api.PerconaXtraDB) (bool, error) {
+	sts, err := c.Client.AppsV1().StatefulSets(px.Namespace).Get(context.TODO(), px.OffshootName(), metav1.GetOptions{})
+	if err != nil {
+		if kerr.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return sts.Spec.Template.Annotations[bufferPoolSizeAnnotation] != px.Spec.PodTemplate.Annotations[bufferPoolSizeAnnotation], nil
+}
@@ -0,0 +1,194 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+	"kubedb.dev/apimachinery/client/clientset/versioned/typed/kubedb/v1alpha2/util"
+
+	"github.com/appscode/go/log"
+	"github.com/appscode/go/types"
+	apps "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	kmapi "kmodules.xyz/client-go/api/v1"
+	apps_util "kmodules.xyz/client-go/apps/v1"
+)
+
+// canaryAborted reports whether the user asked a running canary rollout to
+// stop.
+func canaryAborted(px *api.PerconaXtraDB) bool {
+	return px.UsesCanaryRollout() && px.Spec.UpdateStrategy.Abort
+}
+
+// reconcileCanaryRollout drives a partitioned canary rollout: the StatefulSet
+// partition starts at the replica count, holding every pod on the old
+// template, and is stepped down one pod per pass once all already updated
+// pods run the new revision and report ready. It runs on the health check
+// tick, so "ready" includes the database probes and readiness gates. The
+// CanaryInProgress condition tracks the position, and an abort restores the
+// partition so no further pod rolls.
+func (c *Controller) reconcileCanaryRollout(px *api.PerconaXtraDB) error {
+	if !px.UsesCanaryRollout() {
+		return nil
+	}
+
+	sts, err := c.Client.AppsV1().StatefulSets(px.Namespace).Get(context.TODO(), px.OffshootName(), metav1.GetOptions{})
+	if err != nil {
+		if kerr.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if sts.Spec.UpdateStrategy.Type != apps.RollingUpdateStatefulSetStrategyType ||
+		sts.Spec.UpdateStrategy.RollingUpdate == nil ||
+		sts.Spec.UpdateStrategy.RollingUpdate.Partition == nil {
+		// no partitioned rollout underway, i.e. the strategy is still parked
+		// at OnDelete between rollouts
+		return c.syncCanaryCondition(px, false, "No partitioned rollout in progress")
+	}
+
+	replicas := types.Int32(sts.Spec.Replicas)
+	partition := *sts.Spec.UpdateStrategy.RollingUpdate.Partition
+
+	if canaryAborted(px) {
+		if partition < replicas {
+			if err := c.setCanaryPartition(sts, replicas); err != nil {
+				return err
+			}
+			c.Recorder.Eventf(
+				px,
+				core.EventTypeNormal,
+				"CanaryAborted",
+				"Canary rollout aborted; partition restored from %d to %d",
+				partition, replicas,
+			)
+		}
+		return c.syncCanaryCondition(px, false, fmt.Sprintf("Canary rollout aborted; partition restored to %d", replicas))
+	}
+
+	if sts.Status.UpdateRevision == "" || sts.Status.UpdateRevision == sts.Status.CurrentRevision {
+		// nothing is rolling; park the partition back at the replica count so
+		// the next template change starts fully held
+		if partition != replicas {
+			if err := c.setCanaryPartition(sts, replicas); err != nil {
+				return err
+			}
+		}
+		return c.syncCanaryCondition(px, false, "All pods run the updated template")
+	}
+
+	pods, err := c.Client.CoreV1().Pods(px.Namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(px.OffshootSelectors()).String(),
+	})
+	if err != nil {
+		return err
+	}
+
+	if partition > 0 && canaryReadyToAdvance(pods.Items, partition, replicas, sts.Status.UpdateRevision) {
+		if err := c.setCanaryPartition(sts, partition-1); err != nil {
+			return err
+		}
+		c.Recorder.Eventf(
+			px,
+			core.EventTypeNormal,
+			"CanaryAdvanced",
+			"Canary rollout advanced; partition moved from %d to %d",
+			partition, partition-1,
+		)
+		partition--
+	}
+	return c.syncCanaryCondition(px, true,
+		fmt.Sprintf("Canary rollout in progress; partition at %d of %d replicas", partition, replicas))
+}
+
+// canaryReadyToAdvance reports whether every pod at or above the partition
+// runs the update revision and is ready, i.e. the canary pods of this step
+// have passed. A pod missing from the list, one being recreated for example,
+// holds the rollout.
+func canaryReadyToAdvance(pods []core.Pod, partition, replicas int32, updateRevision string) bool {
+	passed := int32(0)
+	for i := range pods {
+		pod := &pods[i]
+		ordinal, ok := podOrdinal(pod.Name)
+		if !ok || int32(ordinal) < partition || int32(ordinal) >= replicas {
+			continue
+		}
+		if pod.Labels[apps.ControllerRevisionHashLabelKey] != updateRevision || !podReady(pod) {
+			return false
+		}
+		passed++
+	}
+	return passed == replicas-partition
+}
+
+// podReady reports whether the kubelet considers the pod Ready, which folds
+// in the database readiness probe and the operator's readiness gates.
+func podReady(pod *core.Pod) bool {
+	if pod.Status.Phase != core.PodRunning {
+		return false
+	}
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == core.PodReady {
+			return cond.Status == core.ConditionTrue
+		}
+	}
+	return false
+}
+
+// setCanaryPartition moves the StatefulSet partition to the given ordinal.
+func (c *Controller) setCanaryPartition(sts *apps.StatefulSet, partition int32) error {
+	_, _, err := apps_util.PatchStatefulSet(context.TODO(), c.Client, sts, func(in *apps.StatefulSet) *apps.StatefulSet {
+		in.Spec.UpdateStrategy.RollingUpdate = &apps.RollingUpdateStatefulSetStrategy{
+			Partition: types.Int32P(partition),
+		}
+		return in
+	}, metav1.PatchOptions{})
+	if err != nil {
+		return err
+	}
+	log.Infof("PerconaXtraDB %v/%v: canary partition set to %d", sts.Namespace, sts.Name, partition)
+	return nil
+}
+
+// syncCanaryCondition maintains the CanaryInProgress condition, skipping the
+// status update when nothing changed.
+func (c *Controller) syncCanaryCondition(px *api.PerconaXtraDB, inProgress bool, message string) error {
+	status := core.ConditionTrue
+	if !inProgress {
+		status = core.ConditionFalse
+	}
+	if _, cond := kmapi.GetCondition(px.Status.Conditions, api.DatabaseCanaryInProgress); cond != nil &&
+		cond.Status == status && cond.Message == message {
+		return nil
+	}
+	per, err := util.UpdatePerconaXtraDBStatus(context.TODO(), c.DBClient.KubedbV1alpha2(), px.ObjectMeta, func(in *api.PerconaXtraDBStatus) *api.PerconaXtraDBStatus {
+		in.Conditions = kmapi.SetCondition(in.Conditions, kmapi.NewCondition(
+			api.DatabaseCanaryInProgress, message, px.Generation, inProgress))
+		return in
+	}, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+	px.Status = per.Status
+	return nil
+}
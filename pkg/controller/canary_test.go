@@ -0,0 +1,87 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"testing"
+
+	apps "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func canaryPod(ordinal int, revision string, ready bool) core.Pod {
+	status := core.ConditionFalse
+	if ready {
+		status = core.ConditionTrue
+	}
+	return core.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: fmt.Sprintf("demo-%d", ordinal),
+			Labels: map[string]string{
+				apps.ControllerRevisionHashLabelKey: revision,
+			},
+		},
+		Status: core.PodStatus{
+			Phase: core.PodRunning,
+			Conditions: []core.PodCondition{
+				{Type: core.PodReady, Status: status},
+			},
+		},
+	}
+}
+
+// TestCanaryReadyToAdvance walks a three node cluster through a canary
+// rollout and checks that the partition only advances once every already
+// updated pod runs the new revision and reports ready.
+func TestCanaryReadyToAdvance(t *testing.T) {
+	const updated = "rev-2"
+	cases := []struct {
+		name      string
+		pods      []core.Pod
+		partition int32
+		advance   bool
+	}{
+		{"nothing updated yet, full hold steps down",
+			[]core.Pod{canaryPod(0, "rev-1", true), canaryPod(1, "rev-1", true), canaryPod(2, "rev-1", true)},
+			3, true},
+		{"canary pod still on the old revision",
+			[]core.Pod{canaryPod(0, "rev-1", true), canaryPod(1, "rev-1", true), canaryPod(2, "rev-1", true)},
+			2, false},
+		{"canary pod updated but not ready",
+			[]core.Pod{canaryPod(0, "rev-1", true), canaryPod(1, "rev-1", true), canaryPod(2, updated, false)},
+			2, false},
+		{"canary pod updated and healthy",
+			[]core.Pod{canaryPod(0, "rev-1", true), canaryPod(1, "rev-1", true), canaryPod(2, updated, true)},
+			2, true},
+		{"updated pod being recreated holds the rollout",
+			[]core.Pod{canaryPod(0, "rev-1", true), canaryPod(1, updated, true)},
+			1, false},
+		{"earlier canary regressed to not ready",
+			[]core.Pod{canaryPod(0, "rev-1", true), canaryPod(1, updated, true), canaryPod(2, updated, false)},
+			1, false},
+		{"all remaining pods passed",
+			[]core.Pod{canaryPod(0, "rev-1", true), canaryPod(1, updated, true), canaryPod(2, updated, true)},
+			1, true},
+	}
+	for _, c := range cases {
+		if got := canaryReadyToAdvance(c.pods, c.partition, 3, updated); got != c.advance {
+			t.Errorf("%s: canaryReadyToAdvance() = %v, want %v", c.name, got, c.advance)
+		}
+	}
+}
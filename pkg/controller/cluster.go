@@ -0,0 +1,276 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+	"kubedb.dev/apimachinery/client/clientset/versioned/typed/kubedb/v1alpha2/util"
+
+	"github.com/appscode/go/log"
+	"github.com/appscode/go/types"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	kmapi "kmodules.xyz/client-go/api/v1"
+	core_util "kmodules.xyz/client-go/core/v1"
+)
+
+// the Galera cluster status reported while the nodes form a healthy primary component
+const galeraClusterStatusPrimary = "Primary"
+
+// wsrepLocalStateLabel carries the wsrep_local_state_comment of a cluster pod
+// as a label value, i.e. "synced" or "donor-desynced", so that services can
+// select synced nodes.
+const wsrepLocalStateLabel = api.PerconaXtraDBKey + "/wsrep-local-state"
+
+// isDonorState reports whether a wsrep local state describes an SST donor.
+// A donor is temporarily desynced while it feeds a state snapshot to a joiner,
+// but operationally healthy: it serves reads and rejoins the synced set on its
+// own once the transfer finishes, unlike a genuinely failed node.
+func isDonorState(state string) bool {
+	switch strings.ToLower(state) {
+	case "donor/desynced", "donor", "desynced":
+		return true
+	}
+	return false
+}
+
+// wsrepStateLabelValue converts a wsrep_local_state_comment into a valid label
+// value: lower-cased, with the slash of "Donor/Desynced" replaced, since label
+// values must not contain slashes.
+func wsrepStateLabelValue(state string) string {
+	return strings.ReplaceAll(strings.ToLower(state), "/", "-")
+}
+
+// desiredReplicas returns the replica count the StatefulSet should be patched
+// to. Growing a cluster applies spec.replicas directly. Shrinking happens one
+// pod at a time, and only while the remaining nodes form a healthy primary
+// component, so that a scale-down can not break quorum.
+func (c *Controller) desiredReplicas(px *api.PerconaXtraDB) (*int32, error) {
+	sts, err := c.Client.AppsV1().StatefulSets(px.Namespace).Get(context.TODO(), px.OffshootName(), metav1.GetOptions{})
+	if err != nil {
+		if kerr.IsNotFound(err) {
+			return px.Spec.Replicas, nil
+		}
+		return nil, err
+	}
+
+	current := types.Int32(sts.Spec.Replicas)
+	if err := c.syncScalingStatus(px, current); err != nil {
+		return nil, err
+	}
+
+	if !px.IsCluster() || types.Int32(px.Spec.Replicas) >= current {
+		return px.Spec.Replicas, nil
+	}
+
+	// removing async replicas cannot break quorum, so the spec count applies
+	// directly; should the current source be among the removed ordinals, the
+	// failover checker promotes a survivor
+	if px.UsesAsyncReplication() {
+		return px.Spec.Replicas, nil
+	}
+
+	status, size, err := c.galeraClusterStatus(px)
+	if err != nil {
+		c.Recorder.Eventf(
+			px,
+			core.EventTypeWarning,
+			"ScalingBlocked",
+			"Deferring scale down of PerconaXtraDB %v/%v. Reason: %v",
+			px.Namespace, px.Name, err,
+		)
+		return sts.Spec.Replicas, nil
+	}
+	// arbiter daemons count towards the reported cluster size
+	expected := current + px.ArbiterReplicas()
+	if status != galeraClusterStatusPrimary || int32(size) != expected {
+		c.Recorder.Eventf(
+			px,
+			core.EventTypeWarning,
+			"ScalingBlocked",
+			"Deferring scale down of PerconaXtraDB %v/%v. Cluster status is %q with %d of %d nodes synced",
+			px.Namespace, px.Name, status, size, expected,
+		)
+		return sts.Spec.Replicas, nil
+	}
+
+	return types.Int32P(current - 1), nil
+}
+
+// syncScalingStatus records the replica count the operator is converging
+// toward in status.targetReplicas together with a Scaling condition. Rapid
+// spec.replicas edits only move the recorded target; each reconcile then
+// steps the StatefulSet toward the latest value, so intermediate counts are
+// never rolled out. Once the StatefulSet matches the spec, target and
+// condition are dropped again.
+func (c *Controller) syncScalingStatus(px *api.PerconaXtraDB, current int32) error {
+	target := types.Int32(px.Spec.Replicas)
+	if target == current {
+		if px.Status.TargetReplicas == nil && !kmapi.HasCondition(px.Status.Conditions, api.DatabaseScaling) {
+			return nil
+		}
+		per, err := util.UpdatePerconaXtraDBStatus(context.TODO(), c.DBClient.KubedbV1alpha2(), px.ObjectMeta, func(in *api.PerconaXtraDBStatus) *api.PerconaXtraDBStatus {
+			in.TargetReplicas = nil
+			in.Conditions = kmapi.RemoveCondition(in.Conditions, api.DatabaseScaling)
+			return in
+		}, metav1.UpdateOptions{})
+		if err != nil {
+			return err
+		}
+		px.Status = per.Status
+		return nil
+	}
+
+	if types.Int32(px.Status.TargetReplicas) == target && kmapi.HasCondition(px.Status.Conditions, api.DatabaseScaling) {
+		return nil
+	}
+	per, err := util.UpdatePerconaXtraDBStatus(context.TODO(), c.DBClient.KubedbV1alpha2(), px.ObjectMeta, func(in *api.PerconaXtraDBStatus) *api.PerconaXtraDBStatus {
+		in.TargetReplicas = types.Int32P(target)
+		in.Conditions = kmapi.SetCondition(in.Conditions, kmapi.NewCondition(
+			api.DatabaseScaling,
+			fmt.Sprintf("Scaling from %d to %d replicas", current, target),
+			px.Generation))
+		return in
+	}, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+	px.Status = per.Status
+	return nil
+}
+
+// labelClusterPods labels every running cluster pod with its current
+// wsrep_local_state_comment and its role, so that the read service can direct
+// traffic to synced secondaries. Pods that cannot be queried are skipped.
+func (c *Controller) labelClusterPods(px *api.PerconaXtraDB) error {
+	if !px.IsCluster() {
+		return nil
+	}
+	// async source-replica pods have no wsrep state; their roles are labeled
+	// by the async replication check instead
+	if px.UsesAsyncReplication() {
+		return nil
+	}
+	// with the coordinator sidecar enabled, each pod labels itself
+	if px.Spec.Coordinator != nil {
+		return nil
+	}
+
+	pods, err := c.Client.CoreV1().Pods(px.Namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(px.OffshootSelectors()).String(),
+	})
+	if err != nil {
+		return err
+	}
+
+	// a failover or the override annotation may have moved the primary role;
+	// preserve the current assignment and only default to the first ordinal
+	// when no pod carries the role yet, so relabeling does not undo a
+	// promotion
+	primaryName := px.Annotations[primaryOverrideAnnotation]
+	if primaryName == "" {
+		for i := range pods.Items {
+			if pods.Items[i].Labels[api.LabelRole] == api.RolePrimary {
+				primaryName = pods.Items[i].Name
+				break
+			}
+		}
+	}
+	if primaryName == "" {
+		primaryName = px.OffshootName() + "-0"
+	}
+
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Status.PodIP == "" {
+			continue
+		}
+		state, err := c.podWsrepState(px, pod.Status.PodIP)
+		if err != nil {
+			log.Infof("failed to query wsrep state of pod %v/%v. Reason: %v", pod.Namespace, pod.Name, err)
+			continue
+		}
+
+		role := api.RoleReplica
+		if pod.Name == primaryName {
+			role = api.RolePrimary
+		}
+		if _, _, err := core_util.PatchPod(context.TODO(), c.Client, pod, func(in *core.Pod) *core.Pod {
+			in.Labels[wsrepLocalStateLabel] = wsrepStateLabelValue(state)
+			in.Labels[api.LabelRole] = role
+			return in
+		}, metav1.PatchOptions{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// podWsrepState returns the lower-cased wsrep_local_state_comment of a single node.
+func (c *Controller) podWsrepState(px *api.PerconaXtraDB, podIP string) (string, error) {
+	secret, err := c.Client.CoreV1().Secrets(px.Namespace).Get(context.TODO(), px.GetDatabaseSecretName(), metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+
+	en, err := sql.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s:%d)/%s",
+		string(secret.Data[core.BasicAuthUsernameKey]),
+		string(secret.Data[core.BasicAuthPasswordKey]),
+		podIP, px.SQLPort(),
+		c.dbDSNParams()))
+	if err != nil {
+		return "", err
+	}
+	defer en.Close()
+
+	var name, state string
+	if err := en.QueryRow(`SHOW STATUS LIKE 'wsrep_local_state_comment'`).Scan(&name, &state); err != nil {
+		return "", err
+	}
+	return strings.ToLower(state), nil
+}
+
+// galeraClusterStatus queries wsrep_cluster_status and wsrep_cluster_size from
+// the database.
+func (c *Controller) galeraClusterStatus(px *api.PerconaXtraDB) (string, int, error) {
+	en, err := c.connectToPrimary(px)
+	if err != nil {
+		return "", 0, err
+	}
+	defer en.Close()
+
+	var name, status, sizeValue string
+	if err := en.QueryRow(`SHOW STATUS LIKE 'wsrep_cluster_status'`).Scan(&name, &status); err != nil {
+		return "", 0, err
+	}
+	if err := en.QueryRow(`SHOW STATUS LIKE 'wsrep_cluster_size'`).Scan(&name, &sizeValue); err != nil {
+		return "", 0, err
+	}
+	size, err := strconv.Atoi(sizeValue)
+	if err != nil {
+		return "", 0, err
+	}
+	return status, size, nil
+}
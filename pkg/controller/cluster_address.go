@@ -0,0 +1,115 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+
+	"github.com/appscode/go/types"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	core_util "kmodules.xyz/client-go/core/v1"
+)
+
+const clusterAddressConfigFileName = "cluster-address.cnf"
+
+func (c *Controller) clusterAddressConfigName(px *api.PerconaXtraDB) string {
+	return px.OffshootName() + "-cluster-address-config"
+}
+
+// usesPodIPAddressStrategy reports whether spec.clusterAddressStrategy asks
+// for pod-IP based cluster addresses. The default, an empty strategy or
+// "DNS", keeps the DNS names of the governing service.
+func usesPodIPAddressStrategy(px *api.PerconaXtraDB) bool {
+	return px.IsCluster() && px.Spec.ClusterAddressStrategy == api.PerconaXtraDBAddressStrategyPodIP
+}
+
+// gcommAddress builds the wsrep_cluster_address list for the pod-IP strategy:
+// one entry per expected peer, using the pod IP where the pod is already
+// running and falling back to the peer's DNS name until then, so the list
+// never degenerates into a bare "gcomm://" that would bootstrap a new cluster.
+func (c *Controller) gcommAddress(px *api.PerconaXtraDB) (string, error) {
+	port := px.GaleraReplicationPort()
+	replicas := int(types.Int32(px.Spec.Replicas))
+	addrs := make([]string, 0, replicas)
+	for i := 0; i < replicas; i++ {
+		podName := fmt.Sprintf("%s-%d", px.OffshootName(), i)
+		pod, err := c.Client.CoreV1().Pods(px.Namespace).Get(context.TODO(), podName, metav1.GetOptions{})
+		if err != nil && !kerr.IsNotFound(err) {
+			return "", err
+		}
+		if err == nil && pod.Status.PodIP != "" {
+			addrs = append(addrs, fmt.Sprintf("%s:%d", pod.Status.PodIP, port))
+			continue
+		}
+		addrs = append(addrs, fmt.Sprintf("%s:%d", px.PeerName(i), port))
+	}
+	return "gcomm://" + strings.Join(addrs, ","), nil
+}
+
+// peerGcommAddress builds the wsrep_cluster_address list from the peers' DNS
+// names only, i.e. what gcommAddress degrades to before any pod is running.
+func peerGcommAddress(px *api.PerconaXtraDB) string {
+	port := px.GaleraReplicationPort()
+	replicas := int(types.Int32(px.Spec.Replicas))
+	addrs := make([]string, 0, replicas)
+	for i := 0; i < replicas; i++ {
+		addrs = append(addrs, fmt.Sprintf("%s:%d", px.PeerName(i), port))
+	}
+	return "gcomm://" + strings.Join(addrs, ",")
+}
+
+// clusterAddressConfig renders the my.cnf snippet with the given gcomm list.
+func clusterAddressConfig(address string) string {
+	return fmt.Sprintf(`[mysqld]
+wsrep_cluster_address=%s
+`, address)
+}
+
+// ensureClusterAddressConfig renders the current gcomm list into a ConfigMap
+// snippet. It is refreshed from the health check loop as well, so pod IP
+// changes reach the config before the next node restart reads it.
+func (c *Controller) ensureClusterAddressConfig(px *api.PerconaXtraDB) error {
+	address, err := c.gcommAddress(px)
+	if err != nil {
+		return err
+	}
+
+	owner := metav1.NewControllerRef(px, api.SchemeGroupVersion.WithKind(api.ResourceKindPerconaXtraDB))
+
+	cnf := clusterAddressConfig(address)
+
+	meta := metav1.ObjectMeta{
+		Name:      c.clusterAddressConfigName(px),
+		Namespace: px.Namespace,
+	}
+
+	_, _, err = core_util.CreateOrPatchConfigMap(context.TODO(), c.Client, meta, func(in *core.ConfigMap) *core.ConfigMap {
+		core_util.EnsureOwnerReference(&in.ObjectMeta, owner)
+		in.Labels = px.OffshootLabels()
+		in.Data = map[string]string{
+			clusterAddressConfigFileName: cnf,
+		}
+		return in
+	}, metav1.PatchOptions{})
+	return err
+}
@@ -0,0 +1,48 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+)
+
+// TestDonorTransition walks a node through the states it reports around a
+// state snapshot transfer and checks that the donor phase counts as healthy
+// while keeping the node out of the synced set the services select on.
+func TestDonorTransition(t *testing.T) {
+	cases := []struct {
+		state      string
+		donor      bool
+		labelValue string
+	}{
+		{"Synced", false, "synced"},
+		{"Donor/Desynced", true, "donor-desynced"},
+		{"Synced", false, "synced"},
+		// states of a genuinely recovering or broken node are not donors
+		{"Joining", false, "joining"},
+		{"Joined", false, "joined"},
+		{"Initialized", false, "initialized"},
+	}
+	for _, c := range cases {
+		if got := isDonorState(c.state); got != c.donor {
+			t.Errorf("isDonorState(%q) = %v, want %v", c.state, got, c.donor)
+		}
+		if got := wsrepStateLabelValue(c.state); got != c.labelValue {
+			t.Errorf("wsrepStateLabelValue(%q) = %q, want %q", c.state, got, c.labelValue)
+		}
+	}
+}
@@ -17,6 +17,8 @@ limitations under the License.
 package controller
 
 import (
+	"time"
+
 	cs "kubedb.dev/apimachinery/client/clientset/versioned"
 	amc "kubedb.dev/apimachinery/pkg/controller"
 
@@ -39,7 +41,19 @@ const (
 type OperatorConfig struct {
 	amc.Config
 
-	LicenseFile      string
+	LicenseFile string
+	// DBConnectBackoffMax caps the exponential backoff applied to transient
+	// database connectivity errors.
+	DBConnectBackoffMax time.Duration
+	// DBQueryTimeout bounds connects and queries of the operator's own
+	// database connections. Zero falls back to a conservative default.
+	DBQueryTimeout time.Duration
+	// MaxReconcileFailures is the number of consecutive reconcile failures
+	// after which an object is circuit-broken. Zero disables the breaker.
+	MaxReconcileFailures int32
+	// ReconcileWorkers is the number of goroutines processing PerconaXtraDB
+	// objects. Zero falls back to NumThreads.
+	ReconcileWorkers int
 	ClientConfig     *rest.Config
 	KubeClient       kubernetes.Interface
 	CRDClient        crd_cs.Interface
@@ -72,6 +86,10 @@ func (c *OperatorConfig) New() (*Controller, error) {
 		c.Config,
 		c.Recorder,
 	)
+	ctrl.dbConnectBackoffMax = c.DBConnectBackoffMax
+	ctrl.dbQueryTimeout = c.DBQueryTimeout
+	ctrl.maxReconcileFailures = c.MaxReconcileFailures
+	ctrl.reconcileWorkers = c.ReconcileWorkers
 
 	if err := ctrl.EnsureCustomResourceDefinitions(); err != nil {
 		return nil, err
@@ -18,6 +18,8 @@ package controller
 
 import (
 	"context"
+	"sync"
+	"time"
 
 	catalog "kubedb.dev/apimachinery/apis/catalog/v1alpha1"
 	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
@@ -59,6 +61,45 @@ type Controller struct {
 	pxQueue    *queue.Worker
 	pxInformer cache.SharedIndexInformer
 	pxLister   api_listers.PerconaXtraDBLister
+
+	// tracks since when the primary of a database has been unreachable,
+	// keyed by namespace/name
+	failoverMutex    sync.Mutex
+	primaryDownSince map[string]time.Time
+
+	// per-database health check bookkeeping, keyed by namespace/name
+	healthMutex     sync.Mutex
+	lastHealthCheck map[string]time.Time
+	healthFailures  map[string]int32
+
+	// per-database backoff for transient connectivity errors, keyed by
+	// namespace/name
+	backoffMutex        sync.Mutex
+	dbBackoff           map[string]time.Duration
+	dbConnectBackoffMax time.Duration
+
+	// connect/read/write timeout of the operator's own connections to managed
+	// databases; zero falls back to defaultDBQueryTimeout
+	dbQueryTimeout time.Duration
+
+	// rate limits automatic storage expansions, keyed by namespace/name
+	expandMutex       sync.Mutex
+	lastStorageExpand map[string]time.Time
+
+	// circuit breaker for repeatedly failing reconciles, keyed by
+	// namespace/name
+	failureMutex         sync.Mutex
+	reconcileFailures    map[string]int32
+	maxReconcileFailures int32
+
+	// number of goroutines processing PerconaXtraDB objects; zero falls back
+	// to the shared NumThreads setting
+	reconcileWorkers int
+
+	// last seqno seen per cluster node, keyed by namespace/name/pod; used to
+	// pick the bootstrap node on full-outage recovery
+	bootstrapMutex sync.Mutex
+	lastSeqno      map[string]int64
 }
 
 func New(
@@ -89,6 +130,13 @@ func New(
 				api.LabelDatabaseKind: api.ResourceKindPerconaXtraDB,
 			},
 		},
+		primaryDownSince:  map[string]time.Time{},
+		lastHealthCheck:   map[string]time.Time{},
+		healthFailures:    map[string]int32{},
+		dbBackoff:         map[string]time.Duration{},
+		lastStorageExpand: map[string]time.Time{},
+		reconcileFailures: map[string]int32{},
+		lastSeqno:         map[string]int64{},
 	}
 }
 
@@ -159,6 +207,15 @@ func (c *Controller) StartAndRunControllers(stopCh <-chan struct{}) {
 	// Initialize and start Stash controllers
 	go stash.NewController(c.Controller, &c.Config.Initializers.Stash, c.WatchNamespace).StartAfterStashInstalled(c.MaxNumRequeues, c.NumThreads, c.selector, stopCh)
 
+	// Start the periodic cluster quorum checker
+	c.RunClusterHealthChecker(stopCh)
+
+	// Start the periodic primary failover checker
+	c.RunFailoverChecker(stopCh)
+
+	// Start the periodic datadir usage checker
+	c.RunStorageUsageChecker(stopCh)
+
 	// Start PerconaXtraDB controller
 	c.RunControllers(stopCh)
 
@@ -0,0 +1,107 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+
+	core "k8s.io/api/core/v1"
+)
+
+const (
+	coordinatorContainerName = "px-coordinator"
+	coordinatorDir           = "/var/run/px-coordinator"
+	coordinatorReadyFile     = coordinatorDir + "/ready"
+)
+
+// coordinatorContainer builds the coordinator sidecar. It runs next to every
+// cluster node, re-evaluates the local wsrep state every few seconds, keeps a
+// readiness file the main readiness probe consults and labels its own pod as
+// primary or replica. Exactly one node of the primary component reports
+// wsrep_local_index 0, so at no point during bootstrap can two pods claim the
+// primary label.
+func coordinatorContainer(px *api.PerconaXtraDB, image string) *core.Container {
+	script := fmt.Sprintf(`mkdir -p %[1]v
+token=$(cat /var/run/secrets/kubernetes.io/serviceaccount/token)
+cacert=/var/run/secrets/kubernetes.io/serviceaccount/ca.crt
+while true; do
+    sleep 5
+    status=$(mysql -uroot -p"${MYSQL_ROOT_PASSWORD}" -h 127.0.0.1 -NBe "SHOW STATUS LIKE 'wsrep_cluster_status'" 2>/dev/null | awk '{print $2}')
+    state=$(mysql -uroot -p"${MYSQL_ROOT_PASSWORD}" -h 127.0.0.1 -NBe "SHOW STATUS LIKE 'wsrep_local_state_comment'" 2>/dev/null | awk '{print $2}')
+    index=$(mysql -uroot -p"${MYSQL_ROOT_PASSWORD}" -h 127.0.0.1 -NBe "SHOW STATUS LIKE 'wsrep_local_index'" 2>/dev/null | awk '{print $2}')
+    if [ "$status" = "Primary" ] && { [ "$state" = "Synced" ] || [ "$state" = "Donor/Desynced" ]; }; then
+        touch %[2]v
+    else
+        rm -f %[2]v
+    fi
+    role=%[4]v
+    if [ "$status" = "Primary" ] && [ "$index" = "0" ]; then
+        role=%[3]v
+    fi
+    lowered=$(echo "$state" | tr '[:upper:]' '[:lower:]' | tr '/' '-')
+    if [ "$role $lowered" != "$(cat %[1]v/labels 2>/dev/null)" ]; then
+        curl -sS --cacert "$cacert" -H "Authorization: Bearer $token" \
+            -H "Content-Type: application/merge-patch+json" -X PATCH \
+            "https://kubernetes.default.svc/api/v1/namespaces/${POD_NAMESPACE}/pods/${POD_NAME}" \
+            -d "{\"metadata\":{\"labels\":{\"%[5]v\":\"$role\",\"%[6]v\":\"$lowered\"}}}" >/dev/null \
+            && echo "$role $lowered" > %[1]v/labels
+    fi
+done`,
+		coordinatorDir, coordinatorReadyFile,
+		api.RolePrimary, api.RoleReplica,
+		api.LabelRole, wsrepLocalStateLabel)
+
+	return &core.Container{
+		Name:  coordinatorContainerName,
+		Image: image,
+		Command: []string{
+			"bash",
+		},
+		Args: []string{
+			"-c",
+			script,
+		},
+		Env: []core.EnvVar{
+			{
+				Name: "POD_NAME",
+				ValueFrom: &core.EnvVarSource{
+					FieldRef: &core.ObjectFieldSelector{
+						FieldPath: "metadata.name",
+					},
+				},
+			},
+			{
+				Name: "POD_NAMESPACE",
+				ValueFrom: &core.EnvVarSource{
+					FieldRef: &core.ObjectFieldSelector{
+						FieldPath: "metadata.namespace",
+					},
+				},
+			},
+		},
+		VolumeMounts: []core.VolumeMount{
+			{
+				Name:      "coordinator",
+				MountPath: coordinatorDir,
+			},
+		},
+		Resources:       px.Spec.Coordinator.Resources,
+		SecurityContext: px.Spec.Coordinator.SecurityContext,
+	}
+}
@@ -0,0 +1,142 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+	"kubedb.dev/apimachinery/client/clientset/versioned/typed/kubedb/v1alpha2/util"
+
+	"github.com/appscode/go/log"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+	"gomodules.xyz/sets"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kmapi "kmodules.xyz/client-go/api/v1"
+	core_util "kmodules.xyz/client-go/core/v1"
+)
+
+const managedDatabasesKey = "databases"
+
+func (c *Controller) managedDatabasesConfigMapName(px *api.PerconaXtraDB) string {
+	return px.OffshootName() + "-managed-databases"
+}
+
+// reconcileDatabases creates the schemas declared in spec.databases. It runs
+// after the database becomes ready, and failures surface as the "SchemasReady"
+// condition instead of blocking the reconcile.
+func (c *Controller) reconcileDatabases(px *api.PerconaXtraDB) {
+	err := c.syncDatabases(px)
+	msg := "All schemas in spec.databases have been created"
+	if err != nil {
+		log.Errorln(err)
+		msg = err.Error()
+	}
+
+	per, serr := util.UpdatePerconaXtraDBStatus(context.TODO(), c.DBClient.KubedbV1alpha2(), px.ObjectMeta, func(in *api.PerconaXtraDBStatus) *api.PerconaXtraDBStatus {
+		in.Conditions = kmapi.SetCondition(in.Conditions, kmapi.NewCondition(api.DatabaseSchemasReady, msg, px.Generation, err == nil))
+		return in
+	}, metav1.UpdateOptions{})
+	if serr != nil {
+		log.Errorln(serr)
+		return
+	}
+	px.Status = per.Status
+}
+
+func (c *Controller) syncDatabases(px *api.PerconaXtraDB) error {
+	previous, err := c.previouslyManagedDatabases(px)
+	if err != nil {
+		return err
+	}
+	if len(px.Spec.Databases) == 0 && previous.Len() == 0 {
+		return nil
+	}
+
+	en, err := c.connectToPrimary(px)
+	if err != nil {
+		return err
+	}
+	defer en.Close()
+
+	current := sets.NewString()
+	for _, db := range px.Spec.Databases {
+		current.Insert(db.Name)
+
+		stmt := fmt.Sprintf("CREATE DATABASE IF NOT EXISTS `%s`", db.Name)
+		if db.Charset != "" {
+			stmt += fmt.Sprintf(" CHARACTER SET %s", db.Charset)
+		}
+		if db.Collation != "" {
+			stmt += fmt.Sprintf(" COLLATE %s", db.Collation)
+		}
+		if _, err := en.Exec(stmt); err != nil {
+			return errors.Wrapf(err, "failed to create schema %q", db.Name)
+		}
+	}
+
+	// schemas removed from spec.databases are deliberately kept; dropping
+	// them would destroy data, so the leftover is only pointed out
+	for _, name := range previous.Difference(current).List() {
+		c.Recorder.Eventf(
+			px,
+			core.EventTypeWarning,
+			"SchemaRetained",
+			"Schema %q was removed from 'spec.databases' but is kept to avoid data loss; drop it manually if it is no longer needed",
+			name,
+		)
+	}
+
+	return c.recordManagedDatabases(px, current)
+}
+
+// previouslyManagedDatabases returns the schemas created by an earlier
+// reconcile, recorded in the managed-databases ConfigMap.
+func (c *Controller) previouslyManagedDatabases(px *api.PerconaXtraDB) (sets.String, error) {
+	cm, err := c.Client.CoreV1().ConfigMaps(px.Namespace).Get(context.TODO(), c.managedDatabasesConfigMapName(px), metav1.GetOptions{})
+	if err != nil {
+		if kerr.IsNotFound(err) {
+			return sets.NewString(), nil
+		}
+		return nil, err
+	}
+	return sets.NewString(strings.Fields(cm.Data[managedDatabasesKey])...), nil
+}
+
+func (c *Controller) recordManagedDatabases(px *api.PerconaXtraDB, databases sets.String) error {
+	owner := metav1.NewControllerRef(px, api.SchemeGroupVersion.WithKind(api.ResourceKindPerconaXtraDB))
+
+	meta := metav1.ObjectMeta{
+		Name:      c.managedDatabasesConfigMapName(px),
+		Namespace: px.Namespace,
+	}
+
+	_, _, err := core_util.CreateOrPatchConfigMap(context.TODO(), c.Client, meta, func(in *core.ConfigMap) *core.ConfigMap {
+		core_util.EnsureOwnerReference(&in.ObjectMeta, owner)
+		in.Labels = px.OffshootLabels()
+		in.Data = map[string]string{
+			managedDatabasesKey: strings.Join(databases.List(), "\n"),
+		}
+		return in
+	}, metav1.PatchOptions{})
+	return err
+}
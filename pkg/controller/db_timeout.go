@@ -0,0 +1,45 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"time"
+)
+
+// defaultDBQueryTimeout bounds the operator's own connections to managed
+// databases when no --db-query-timeout flag is given. Without a bound a
+// single overloaded database can stall its reconcile on a hanging query.
+const defaultDBQueryTimeout = 10 * time.Second
+
+// queryTimeout returns the configured connect/query timeout for the
+// operator's database connections.
+func (c *Controller) queryTimeout() time.Duration {
+	if c.dbQueryTimeout > 0 {
+		return c.dbQueryTimeout
+	}
+	return defaultDBQueryTimeout
+}
+
+// dbDSNParams applies the operator-wide connect/query timeout to a DSN.
+func (c *Controller) dbDSNParams() string {
+	timeout := c.queryTimeout()
+	if timeout <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("?timeout=%s&readTimeout=%s&writeTimeout=%s", timeout, timeout, timeout)
+}
@@ -22,7 +22,9 @@ import (
 	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
 
 	"github.com/appscode/go/log"
+	"github.com/appscode/go/types"
 	"github.com/pkg/errors"
+	apps "k8s.io/api/apps/v1"
 	core "k8s.io/api/core/v1"
 	kerr "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -30,10 +32,14 @@ import (
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
 	kutil "kmodules.xyz/client-go"
+	apps_util "kmodules.xyz/client-go/apps/v1"
 	core_util "kmodules.xyz/client-go/core/v1"
 	dynamic_util "kmodules.xyz/client-go/dynamic"
 )
 
+// waitUntilPaused blocks until nothing of a halted database is running
+// anymore: every pod is gone and the scaled-down StatefulSets report zero
+// replicas. Only then may the caller mark the database Halted.
 func (c *Controller) waitUntilPaused(db *api.PerconaXtraDB) error {
 	log.Infof("waiting for pods for PerconaXtraDB %v/%v to be deleted\n", db.Namespace, db.Name)
 	if err := core_util.WaitUntilPodDeletedBySelector(context.TODO(), c.Client, db.Namespace, metav1.SetAsLabelSelector(db.OffshootSelectors())); err != nil {
@@ -49,7 +55,7 @@ func (c *Controller) waitUntilPaused(db *api.PerconaXtraDB) error {
 		return err
 	}
 
-	if err := c.waitUntilStatefulSetsDeleted(db); err != nil {
+	if err := c.waitUntilStatefulSetsScaledDown(db); err != nil {
 		return err
 	}
 
@@ -69,16 +75,36 @@ func (c *Controller) waitUntilRBACStuffDeleted(px *api.PerconaXtraDB) error {
 	return nil
 }
 
-func (c *Controller) waitUntilStatefulSetsDeleted(db *api.PerconaXtraDB) error {
-	log.Infof("waiting for statefulsets for PerconaXtraDB %v/%v to be deleted\n", db.Namespace, db.Name)
+func (c *Controller) waitUntilStatefulSetsScaledDown(db *api.PerconaXtraDB) error {
+	log.Infof("waiting for statefulsets for PerconaXtraDB %v/%v to scale down\n", db.Namespace, db.Name)
 	return wait.PollImmediate(kutil.RetryInterval, kutil.GCTimeout, func() (bool, error) {
-		if sts, err := c.Client.AppsV1().StatefulSets(db.Namespace).List(context.TODO(), metav1.ListOptions{LabelSelector: labels.SelectorFromSet(db.OffshootSelectors()).String()}); err != nil && kerr.IsNotFound(err) || len(sts.Items) == 0 {
-			return true, nil
+		sts, err := c.Client.AppsV1().StatefulSets(db.Namespace).List(context.TODO(), metav1.ListOptions{LabelSelector: labels.SelectorFromSet(db.OffshootSelectors()).String()})
+		if err != nil {
+			return kerr.IsNotFound(err), nil
 		}
-		return false, nil
+		return fullyScaledDown(sts.Items), nil
 	})
 }
 
+// scaleToZero is the StatefulSet transform a halt applies: the pods go away
+// while the object itself, its PVCs and the pod identities stay in place for
+// a later unhalt.
+func scaleToZero(in *apps.StatefulSet) *apps.StatefulSet {
+	in.Spec.Replicas = types.Int32P(0)
+	return in
+}
+
+// fullyScaledDown reports whether every given StatefulSet has been scaled to
+// zero and has no replicas left.
+func fullyScaledDown(stss []apps.StatefulSet) bool {
+	for i := range stss {
+		if types.Int32(stss[i].Spec.Replicas) != 0 || stss[i].Status.Replicas != 0 {
+			return false
+		}
+	}
+	return true
+}
+
 func (c *Controller) waitUntilDeploymentsDeleted(db *api.PerconaXtraDB) error {
 	log.Infof("waiting for deployments for PerconaXtraDB %v/%v to be deleted\n", db.Namespace, db.Name)
 	return wait.PollImmediate(kutil.RetryInterval, kutil.GCTimeout, func() (bool, error) {
@@ -89,7 +115,9 @@ func (c *Controller) waitUntilDeploymentsDeleted(db *api.PerconaXtraDB) error {
 	})
 }
 
-// haltDatabase keeps PVC and secrets and deletes rest of the resources generated by kubedb
+// haltDatabase scales the database down to zero pods while keeping the
+// StatefulSets, PVCs and secrets, and deletes the rest of the resources
+// generated by kubedb
 func (c *Controller) haltDatabase(db *api.PerconaXtraDB) error {
 	labelSelector := labels.SelectorFromSet(db.OffshootSelectors()).String()
 	policy := metav1.DeletePropagationBackground
@@ -120,18 +148,22 @@ func (c *Controller) haltDatabase(db *api.PerconaXtraDB) error {
 		return err
 	}
 
-	// delete sts collection offshoot labels
-	log.Infof("deleting StatefulSets of PerconaXtraDB %v/%v.", db.Namespace, db.Name)
-	if err := c.Client.
+	// scale the StatefulSets to zero instead of deleting them: the pods go
+	// away while the PVCs, the secrets and the pod identities stay in place
+	// for a later unhalt
+	log.Infof("scaling StatefulSets of PerconaXtraDB %v/%v down to zero.", db.Namespace, db.Name)
+	stsList, err := c.Client.
 		AppsV1().
 		StatefulSets(db.Namespace).
-		DeleteCollection(
-			context.TODO(),
-			metav1.DeleteOptions{PropagationPolicy: &policy},
-			metav1.ListOptions{LabelSelector: labelSelector},
-		); err != nil {
+		List(context.TODO(), metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil && !kerr.IsNotFound(err) {
 		return err
 	}
+	for i := range stsList.Items {
+		if _, _, err := apps_util.PatchStatefulSet(context.TODO(), c.Client, &stsList.Items[i], scaleToZero, metav1.PatchOptions{}); err != nil {
+			return err
+		}
+	}
 
 	// delete deployment collection offshoot labels
 	log.Infof("deleting Deployments of PerconaXtraDB %v/%v.", db.Namespace, db.Name)
@@ -0,0 +1,75 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+
+	"github.com/appscode/go/types"
+	apps "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestHaltUnhaltRoundTrip(t *testing.T) {
+	sts := apps.StatefulSet{
+		Spec:   apps.StatefulSetSpec{Replicas: types.Int32P(3)},
+		Status: apps.StatefulSetStatus{Replicas: 3},
+	}
+
+	// halting scales to zero, but the database is not paused while pods are
+	// still draining
+	scaleToZero(&sts)
+	if got := types.Int32(sts.Spec.Replicas); got != 0 {
+		t.Errorf("scaleToZero left spec.replicas at %d", got)
+	}
+	if fullyScaledDown([]apps.StatefulSet{sts}) {
+		t.Error("fullyScaledDown = true while pods are still draining")
+	}
+
+	// once the last pod is gone the database may be marked Halted
+	sts.Status.Replicas = 0
+	if !fullyScaledDown([]apps.StatefulSet{sts}) {
+		t.Error("fullyScaledDown = false after the pods are gone")
+	}
+
+	// unhalting scales back up
+	sts.Spec.Replicas = types.Int32P(3)
+	if fullyScaledDown([]apps.StatefulSet{sts}) {
+		t.Error("fullyScaledDown = true after scaling back up")
+	}
+}
+
+func TestUnhaltBootstrapChoiceFromGrastate(t *testing.T) {
+	c := &Controller{lastSeqno: map[string]int64{}}
+	px := &api.PerconaXtraDB{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"},
+		Spec:       api.PerconaXtraDBSpec{Replicas: types.Int32P(3)},
+	}
+
+	// the seqnos the grastate inspection of an unhalt records decide the
+	// bootstrap node: the most advanced one wins
+	c.recordSeqno(px, "demo-0", 17)
+	c.recordSeqno(px, "demo-1", 42)
+	c.recordSeqno(px, "demo-2", 23)
+
+	podName, _ := c.chooseBootstrapPod(px)
+	if podName != "demo-1" {
+		t.Errorf("chooseBootstrapPod = %q, want %q", podName, "demo-1")
+	}
+}
@@ -0,0 +1,194 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+
+	"github.com/appscode/go/log"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// dynamicVariables lists the my.cnf variables the server accepts at runtime
+// via SET GLOBAL. A spec.configSecret change that only touches these is
+// applied over a connection instead of rolling the pods. Extend the set here
+// when further variables turn out to be safe.
+var dynamicVariables = sets.NewString(
+	"max_connections",
+	"max_allowed_packet",
+	"wait_timeout",
+	"interactive_timeout",
+	"slow_query_log",
+	"long_query_time",
+	"innodb_buffer_pool_size",
+	"innodb_flush_log_at_trx_commit",
+	"innodb_io_capacity",
+	"sql_mode",
+)
+
+// applyOrRollConfig decides how a changed spec.configSecret reaches the
+// server: configs made up of known-dynamic variables only are applied live
+// via SET GLOBAL, everything else reports true, so the caller rolls the pods.
+func (c *Controller) applyOrRollConfig(px *api.PerconaXtraDB) (bool, error) {
+	if px.Spec.ConfigSecret == nil {
+		return false, nil
+	}
+	changed, err := c.isConfigChanging(px)
+	if err != nil {
+		return false, err
+	}
+	if !changed {
+		return false, nil
+	}
+
+	vars, allDynamic, err := c.configSecretVariables(px)
+	if err != nil {
+		return false, err
+	}
+	if !allDynamic || len(vars) == 0 {
+		return true, nil
+	}
+	return false, c.applyDynamicConfig(px, vars)
+}
+
+// isConfigChanging reports whether the custom config differs from the one the
+// running StatefulSet was rendered with, based on the config hash annotation.
+func (c *Controller) isConfigChanging(px *api.PerconaXtraDB) (bool, error) {
+	sts, err := c.Client.AppsV1().StatefulSets(px.Namespace).Get(context.TODO(), px.OffshootName(), metav1.GetOptions{})
+	if err != nil {
+		if kerr.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return sts.Spec.Template.Annotations[customConfigHashAnnotation] != px.Spec.PodTemplate.Annotations[customConfigHashAnnotation], nil
+}
+
+// configSecretVariables parses the files in spec.configSecret into variable
+// assignments. It also reports whether every entry is a known-dynamic
+// variable; section headers and comments are skipped, flag-only lines count
+// as non-dynamic since they cannot be set at runtime.
+func (c *Controller) configSecretVariables(px *api.PerconaXtraDB) (map[string]string, bool, error) {
+	secret, err := c.Client.CoreV1().Secrets(px.Namespace).Get(context.TODO(), px.Spec.ConfigSecret.Name, metav1.GetOptions{})
+	if err != nil {
+		if kerr.IsNotFound(err) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	vars := map[string]string{}
+	allDynamic := true
+	for _, content := range secret.Data {
+		for _, line := range strings.Split(string(content), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") ||
+				(strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]")) {
+				continue
+			}
+			parts := strings.SplitN(line, "=", 2)
+			if len(parts) != 2 {
+				allDynamic = false
+				continue
+			}
+			name := strings.ReplaceAll(strings.TrimSpace(parts[0]), "-", "_")
+			vars[name] = strings.TrimSpace(parts[1])
+			if !dynamicVariables.Has(name) {
+				allDynamic = false
+			}
+		}
+	}
+	return vars, allDynamic, nil
+}
+
+// applyDynamicConfig runs SET GLOBAL for each variable on every running pod
+// and records the applied changes as a ConfigApplied event.
+func (c *Controller) applyDynamicConfig(px *api.PerconaXtraDB, vars map[string]string) error {
+	pods, err := c.Client.CoreV1().Pods(px.Namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(px.OffshootSelectors()).String(),
+	})
+	if err != nil {
+		return err
+	}
+
+	var applied []string
+	for name, value := range vars {
+		applied = append(applied, fmt.Sprintf("%s=%s", name, value))
+	}
+
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Status.PodIP == "" {
+			continue
+		}
+		if err := c.setGlobalVariables(px, pod.Status.PodIP, vars); err != nil {
+			return markTransient(fmt.Errorf("failed to apply dynamic config to pod %v/%v: %v", pod.Namespace, pod.Name, err))
+		}
+	}
+
+	log.Infof("Applied dynamic configuration to PerconaXtraDB %v/%v without a restart: %s",
+		px.Namespace, px.Name, strings.Join(applied, ", "))
+	c.Recorder.Eventf(
+		px,
+		core.EventTypeNormal,
+		"ConfigApplied",
+		"Applied dynamic configuration without a restart: %s",
+		strings.Join(applied, ", "),
+	)
+	return nil
+}
+
+// setGlobalVariables applies the variable assignments on a single node.
+func (c *Controller) setGlobalVariables(px *api.PerconaXtraDB, podIP string, vars map[string]string) error {
+	en, err := c.connectToPod(px, podIP)
+	if err != nil {
+		return err
+	}
+	defer en.Close()
+
+	for name, value := range vars {
+		if _, err := en.Exec(fmt.Sprintf("SET GLOBAL %s = %s", name, quoteVariableValue(value))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// quoteVariableValue leaves numeric values bare and single-quotes everything
+// else the way the server expects.
+func quoteVariableValue(value string) string {
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return value
+	}
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// quoteStringLiteral renders a value as a MySQL string literal. Passwords come
+// from user-provided secrets and may contain quotes or backslashes, so both
+// are escaped to keep the value from breaking out of the literal.
+func quoteStringLiteral(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `''`).Replace(value) + "'"
+}
@@ -0,0 +1,82 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+
+	"github.com/pkg/errors"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	core_util "kmodules.xyz/client-go/core/v1"
+)
+
+const (
+	// keyringVaultConfigFileName is the config file the keyring_vault plugin
+	// is pointed at through --keyring_vault_config.
+	keyringVaultConfigFileName = "keyring_vault.conf"
+
+	// keyringVaultTokenKey is the key of the Vault token inside the user
+	// supplied token secret.
+	keyringVaultTokenKey = "token"
+)
+
+func (c *Controller) keyringVaultConfigSecretName(px *api.PerconaXtraDB) string {
+	return px.OffshootName() + "-keyring-vault-config"
+}
+
+// ensureKeyringVaultConfig renders the keyring_vault plugin configuration into
+// a secret the StatefulSet mounts. It is a secret rather than a ConfigMap
+// because the rendered file embeds the Vault token.
+func (c *Controller) ensureKeyringVaultConfig(px *api.PerconaXtraDB) error {
+	if px.Spec.Encryption == nil || px.Spec.Encryption.Mode != api.KeyringVault {
+		return nil
+	}
+	vault := px.Spec.Encryption.Vault
+
+	tokenSecret, err := c.Client.CoreV1().Secrets(px.Namespace).Get(context.TODO(), vault.TokenSecret, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	token, ok := tokenSecret.Data[keyringVaultTokenKey]
+	if !ok || len(token) == 0 {
+		return errors.Errorf(`secret %s/%s has no %q key`, px.Namespace, vault.TokenSecret, keyringVaultTokenKey)
+	}
+
+	config := fmt.Sprintf("vault_url = %s\nsecret_mount_point = %s\ntoken = %s\n",
+		vault.Address, vault.SecretMountPoint, token)
+
+	owner := metav1.NewControllerRef(px, api.SchemeGroupVersion.WithKind(api.ResourceKindPerconaXtraDB))
+
+	meta := metav1.ObjectMeta{
+		Name:      c.keyringVaultConfigSecretName(px),
+		Namespace: px.Namespace,
+	}
+
+	_, _, err = core_util.CreateOrPatchSecret(context.TODO(), c.Client, meta, func(in *core.Secret) *core.Secret {
+		core_util.EnsureOwnerReference(&in.ObjectMeta, owner)
+		in.Labels = px.OffshootLabels()
+		in.Data = map[string][]byte{
+			keyringVaultConfigFileName: []byte(config),
+		}
+		return in
+	}, metav1.PatchOptions{})
+	return err
+}
@@ -0,0 +1,134 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+
+	promapi "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	core_util "kmodules.xyz/client-go/core/v1"
+	mona "kmodules.xyz/monitoring-agent-api/api/v1"
+)
+
+const (
+	// exporterCertMountPath is where the exporter serving certificate secret
+	// is mounted in the exporter container.
+	exporterCertMountPath = "/etc/mysql/exporter-certs"
+	// exporterWebConfigMountPath is where the generated web config for
+	// mysqld_exporter is mounted.
+	exporterWebConfigMountPath = "/etc/mysql/exporter-web-config"
+	exporterWebConfigFileName  = "web-config.yml"
+)
+
+// exporterTLSEnabled reports whether the metrics exporter should serve HTTPS.
+func exporterTLSEnabled(px *api.PerconaXtraDB) bool {
+	return px.Spec.Monitor != nil &&
+		px.Spec.Monitor.Agent.Vendor() == mona.VendorPrometheus &&
+		px.Spec.Monitor.Prometheus != nil &&
+		px.Spec.Monitor.Prometheus.Exporter.TLS != nil
+}
+
+// exporterTLSSecretName resolves the secret holding the exporter serving
+// certificate: the explicitly referenced one, or the certificate issued for
+// the metrics-exporter alias of spec.tls.
+func exporterTLSSecretName(px *api.PerconaXtraDB) string {
+	if name := px.Spec.Monitor.Prometheus.Exporter.TLS.SecretName; name != "" {
+		return name
+	}
+	return px.MustCertSecretName(api.PerconaXtraDBMetricsExporterCert)
+}
+
+// exporterWebConfigName returns the name of the ConfigMap carrying the
+// mysqld_exporter web config.
+func (c *Controller) exporterWebConfigName(px *api.PerconaXtraDB) string {
+	return px.OffshootName() + "-exporter-web-config"
+}
+
+// ensureExporterWebConfig generates the web config file pointing
+// mysqld_exporter at the mounted serving certificate.
+func (c *Controller) ensureExporterWebConfig(px *api.PerconaXtraDB) error {
+	owner := metav1.NewControllerRef(px, api.SchemeGroupVersion.WithKind(api.ResourceKindPerconaXtraDB))
+
+	webConfig := fmt.Sprintf(`tls_server_config:
+  cert_file: %[1]s/tls.crt
+  key_file: %[1]s/tls.key
+`, exporterCertMountPath)
+
+	_, _, err := core_util.CreateOrPatchConfigMap(
+		context.TODO(),
+		c.Client,
+		metav1.ObjectMeta{
+			Name:      c.exporterWebConfigName(px),
+			Namespace: px.Namespace,
+		},
+		func(in *core.ConfigMap) *core.ConfigMap {
+			core_util.EnsureOwnerReference(&in.ObjectMeta, owner)
+			in.Labels = px.OffshootLabels()
+			in.Data = map[string]string{
+				exporterWebConfigFileName: webConfig,
+			}
+			return in
+		},
+		metav1.PatchOptions{},
+	)
+	return err
+}
+
+// ensureServiceMonitorTLS flips the ServiceMonitor endpoint to scrape over
+// https once the exporter serves TLS. The vendored agent library only writes
+// plain http endpoints, so the scheme is patched on top of its output.
+func (c *Controller) ensureServiceMonitorTLS(px *api.PerconaXtraDB) error {
+	sm, err := c.promClient.ServiceMonitors(px.Namespace).Get(context.TODO(), px.StatsService().ServiceMonitorName(), metav1.GetOptions{})
+	if err != nil {
+		if kerr.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	changed := false
+	for i := range sm.Spec.Endpoints {
+		endpoint := &sm.Spec.Endpoints[i]
+		if endpoint.Scheme == "https" && endpoint.TLSConfig != nil {
+			continue
+		}
+		endpoint.Scheme = "https"
+		endpoint.TLSConfig = &promapi.TLSConfig{
+			CA: promapi.SecretOrConfigMap{
+				Secret: &core.SecretKeySelector{
+					LocalObjectReference: core.LocalObjectReference{
+						Name: exporterTLSSecretName(px),
+					},
+					Key: "ca.crt",
+				},
+			},
+			ServerName: fmt.Sprintf("%s.%s.svc", px.StatsService().ServiceName(), px.Namespace),
+		}
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	_, err = c.promClient.ServiceMonitors(px.Namespace).Update(context.TODO(), sm, metav1.UpdateOptions{})
+	return err
+}
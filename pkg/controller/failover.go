@@ -0,0 +1,337 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+	"kubedb.dev/apimachinery/client/clientset/versioned/typed/kubedb/v1alpha2/util"
+	"kubedb.dev/apimachinery/pkg/eventer"
+
+	"github.com/appscode/go/log"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	kmapi "kmodules.xyz/client-go/api/v1"
+	core_util "kmodules.xyz/client-go/core/v1"
+)
+
+const (
+	// failoverCheckInterval is how often the reachability of every primary is probed.
+	failoverCheckInterval = 10 * time.Second
+
+	// defaultFailoverThreshold is how long the primary must stay unreachable
+	// before a secondary is promoted.
+	defaultFailoverThreshold = 2 * time.Minute
+
+	// failoverThresholdAnnotation overrides the default failover threshold per
+	// database with a duration, i.e. "5m".
+	failoverThresholdAnnotation = api.PerconaXtraDBKey + "/failover-after"
+
+	// primaryOverrideAnnotation pins the primary role to the named pod. While
+	// set, automatic promotion only applies that choice.
+	primaryOverrideAnnotation = api.PerconaXtraDBKey + "/primary"
+)
+
+// RunFailoverChecker watches the health of every primary pod and promotes the
+// most up-to-date secondary once the primary stays unreachable beyond the
+// failover threshold. It runs until stopCh closes.
+func (c *Controller) RunFailoverChecker(stopCh <-chan struct{}) {
+	go wait.Until(c.checkFailover, failoverCheckInterval, stopCh)
+}
+
+func (c *Controller) checkFailover() {
+	dbs, err := c.pxLister.PerconaXtraDBs(core.NamespaceAll).List(labels.Everything())
+	if err != nil {
+		log.Errorf("failed to list PerconaXtraDBs for failover check. Reason: %v", err)
+		return
+	}
+	for _, px := range dbs {
+		if !px.IsCluster() || px.Spec.Halted || px.Status.Phase != api.DatabasePhaseReady {
+			continue
+		}
+		if err := c.checkPrimaryFailover(px.DeepCopy()); err != nil {
+			log.Errorf("failed to check failover of PerconaXtraDB %v/%v. Reason: %v", px.Namespace, px.Name, err)
+		}
+	}
+}
+
+// checkPrimaryFailover promotes a new primary when the current one has been
+// unreachable for longer than the failover threshold, or when the user pinned
+// a different pod via the primary override annotation.
+func (c *Controller) checkPrimaryFailover(px *api.PerconaXtraDB) error {
+	pods, err := c.Client.CoreV1().Pods(px.Namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(px.OffshootSelectors()).String(),
+	})
+	if err != nil {
+		return err
+	}
+
+	var primary *core.Pod
+	for i := range pods.Items {
+		if pods.Items[i].Labels[api.LabelRole] == api.RolePrimary {
+			primary = &pods.Items[i]
+			break
+		}
+	}
+
+	// a manual override takes effect immediately
+	if override, ok := px.Annotations[primaryOverrideAnnotation]; ok && override != "" {
+		if primary != nil && primary.Name == override {
+			return nil
+		}
+		for i := range pods.Items {
+			if pods.Items[i].Name == override {
+				return c.promotePrimary(px, primary, &pods.Items[i], "pinned by annotation")
+			}
+		}
+		return fmt.Errorf("pod %q named in the %s annotation does not exist", override, primaryOverrideAnnotation)
+	}
+
+	key := px.Namespace + "/" + px.Name
+	if primary != nil && primary.Status.PodIP != "" {
+		if _, err := c.podReplicationPosition(px, primary.Status.PodIP); err == nil {
+			c.failoverMutex.Lock()
+			delete(c.primaryDownSince, key)
+			c.failoverMutex.Unlock()
+			return nil
+		}
+	}
+
+	c.failoverMutex.Lock()
+	since, ok := c.primaryDownSince[key]
+	if !ok {
+		since = time.Now()
+		c.primaryDownSince[key] = since
+	}
+	c.failoverMutex.Unlock()
+
+	if time.Since(since) < c.failoverThreshold(px) {
+		return nil
+	}
+
+	// pick the reachable secondary with the most advanced replication position
+	var candidate *core.Pod
+	var candidateSeqno int64 = -1
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if (primary != nil && pod.Name == primary.Name) || pod.Status.PodIP == "" {
+			continue
+		}
+		seqno, err := c.podReplicationPosition(px, pod.Status.PodIP)
+		if err != nil {
+			continue
+		}
+		if seqno > candidateSeqno {
+			candidate = pod
+			candidateSeqno = seqno
+		}
+	}
+	if candidate == nil {
+		c.Recorder.Eventf(
+			px,
+			core.EventTypeWarning,
+			eventer.EventReasonFailedToStart,
+			"Primary of PerconaXtraDB %v/%v is unreachable, but no healthy secondary is available for promotion",
+			px.Namespace, px.Name,
+		)
+		return nil
+	}
+
+	if err := c.promotePrimary(px, primary, candidate, fmt.Sprintf("primary unreachable since %s", since.Format(time.RFC3339))); err != nil {
+		return err
+	}
+	c.failoverMutex.Lock()
+	delete(c.primaryDownSince, key)
+	c.failoverMutex.Unlock()
+	return nil
+}
+
+// syncPrimaryStatus records in the status which pod the primary service
+// currently targets, so clients can see the node serving writes without
+// querying the database. The update is skipped when nothing changed.
+func (c *Controller) syncPrimaryStatus(px *api.PerconaXtraDB) error {
+	selector := px.OffshootSelectors()
+	selector[api.LabelRole] = api.RolePrimary
+	if px.IsCluster() && !px.UsesAsyncReplication() {
+		// mirror the primary service selector: a donor keeps the role label
+		// but is not a write endpoint until it reports synced again
+		selector[wsrepLocalStateLabel] = "synced"
+	}
+	pods, err := c.Client.CoreV1().Pods(px.Namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(selector).String(),
+	})
+	if err != nil {
+		return err
+	}
+
+	primary := ""
+	for i := range pods.Items {
+		if pods.Items[i].Status.PodIP != "" {
+			primary = pods.Items[i].Name
+			break
+		}
+	}
+
+	if px.Status.Primary == primary {
+		return nil
+	}
+	per, err := util.UpdatePerconaXtraDBStatus(context.TODO(), c.DBClient.KubedbV1alpha2(), px.ObjectMeta, func(in *api.PerconaXtraDBStatus) *api.PerconaXtraDBStatus {
+		in.Primary = primary
+		return in
+	}, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+	px.Status = per.Status
+	return nil
+}
+
+// promotePrimary moves the primary role label from the old pod to the new one,
+// points the primary service at role=primary pods and records the promotion.
+func (c *Controller) promotePrimary(px *api.PerconaXtraDB, old, new *core.Pod, reason string) error {
+	c.Recorder.Eventf(
+		px,
+		core.EventTypeNormal,
+		eventer.EventReasonStarting,
+		"Promoting pod %v to primary of PerconaXtraDB %v/%v. Reason: %s",
+		new.Name, px.Namespace, px.Name, reason,
+	)
+
+	if old != nil {
+		if _, _, err := core_util.PatchPod(context.TODO(), c.Client, old, func(in *core.Pod) *core.Pod {
+			in.Labels[api.LabelRole] = api.RoleReplica
+			return in
+		}, metav1.PatchOptions{}); err != nil {
+			return err
+		}
+	}
+	if _, _, err := core_util.PatchPod(context.TODO(), c.Client, new, func(in *core.Pod) *core.Pod {
+		in.Labels[api.LabelRole] = api.RolePrimary
+		return in
+	}, metav1.PatchOptions{}); err != nil {
+		return err
+	}
+
+	// restrict the primary service to the promoted pod
+	service, err := c.Client.CoreV1().Services(px.Namespace).Get(context.TODO(), px.ServiceName(), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	selector := px.OffshootSelectors()
+	selector[api.LabelRole] = api.RolePrimary
+	if !px.UsesAsyncReplication() {
+		// an SST donor keeps the primary role but drops out of the write
+		// endpoints until it reports synced again
+		selector[wsrepLocalStateLabel] = "synced"
+	}
+	if _, _, err := core_util.CreateOrPatchService(context.TODO(), c.Client, service.ObjectMeta, func(in *core.Service) *core.Service {
+		in.Spec.Selector = selector
+		return in
+	}, metav1.PatchOptions{}); err != nil {
+		return err
+	}
+
+	// an async promotion additionally detaches the new source from its old
+	// one and repoints the surviving replicas; a Galera node needs no such
+	// rewiring
+	if px.UsesAsyncReplication() {
+		if err := c.promoteAsyncPrimary(px, new); err != nil {
+			return err
+		}
+	}
+
+	per, err := util.UpdatePerconaXtraDBStatus(context.TODO(), c.DBClient.KubedbV1alpha2(), px.ObjectMeta, func(in *api.PerconaXtraDBStatus) *api.PerconaXtraDBStatus {
+		in.Conditions = kmapi.SetCondition(in.Conditions, kmapi.NewCondition(
+			api.DatabaseFailoverPerformed,
+			fmt.Sprintf("Pod %s promoted to primary. Reason: %s", new.Name, reason),
+			px.Generation))
+		return in
+	}, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+	px.Status = per.Status
+
+	// reflect the promotion in status.primary right away instead of waiting
+	// for the next health check pass
+	if err := c.syncPrimaryStatus(px); err != nil {
+		log.Errorln(err)
+	}
+
+	c.Recorder.Eventf(
+		px,
+		core.EventTypeNormal,
+		eventer.EventReasonSuccessful,
+		"Successfully promoted pod %v to primary of PerconaXtraDB %v/%v",
+		new.Name, px.Namespace, px.Name,
+	)
+	return nil
+}
+
+// failoverThreshold returns how long the primary may stay unreachable before a
+// secondary is promoted, honoring the per-database annotation override.
+func (c *Controller) failoverThreshold(px *api.PerconaXtraDB) time.Duration {
+	if raw, ok := px.Annotations[failoverThresholdAnnotation]; ok {
+		if d, err := time.ParseDuration(raw); err == nil && d > 0 {
+			return d
+		}
+		log.Infof("ignoring invalid %s annotation %q on PerconaXtraDB %v/%v", failoverThresholdAnnotation, raw, px.Namespace, px.Name)
+	}
+	return defaultFailoverThreshold
+}
+
+// podReplicationPosition returns how far a node has applied transactions, in
+// a form comparable between the nodes of one database: wsrep_last_committed
+// for Galera, the size of the executed GTID set for async replication.
+func (c *Controller) podReplicationPosition(px *api.PerconaXtraDB, podIP string) (int64, error) {
+	if px.UsesAsyncReplication() {
+		return c.podExecutedGTIDs(px, podIP)
+	}
+	return c.podLastCommitted(px, podIP)
+}
+
+// podLastCommitted returns wsrep_last_committed of a single node, i.e. the
+// seqno of the last transaction the node has applied.
+func (c *Controller) podLastCommitted(px *api.PerconaXtraDB, podIP string) (int64, error) {
+	secret, err := c.Client.CoreV1().Secrets(px.Namespace).Get(context.TODO(), px.GetDatabaseSecretName(), metav1.GetOptions{})
+	if err != nil {
+		return 0, err
+	}
+
+	en, err := sql.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s:%d)/%s",
+		string(secret.Data[core.BasicAuthUsernameKey]),
+		string(secret.Data[core.BasicAuthPasswordKey]),
+		podIP, px.SQLPort(),
+		c.dbDSNParams()))
+	if err != nil {
+		return 0, err
+	}
+	defer en.Close()
+
+	var name, value string
+	if err := en.QueryRow(`SHOW STATUS LIKE 'wsrep_last_committed'`).Scan(&name, &value); err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
@@ -0,0 +1,125 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+	"kubedb.dev/apimachinery/pkg/eventer"
+
+	"github.com/appscode/go/log"
+	"github.com/pkg/errors"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	appcat "kmodules.xyz/custom-resources/apis/appcatalog/v1alpha1"
+	"stash.appscode.dev/apimachinery/apis/stash"
+	stash_v1beta1 "stash.appscode.dev/apimachinery/apis/stash/v1beta1"
+)
+
+// finalBackupSessionName returns the name of the BackupSession used for the
+// final backup before deletion.
+func finalBackupSessionName(px *api.PerconaXtraDB) string {
+	return px.OffshootName() + "-final-backup"
+}
+
+// ensureFinalBackup triggers one last Stash backup session before the database
+// is wiped out, and blocks the deletion until the session has succeeded.
+// Returning an error requeues the terminate call, so the operator keeps
+// polling the session instead of blocking here. The skip-final-backup
+// annotation bypasses the whole mechanism in emergencies.
+func (c *Controller) ensureFinalBackup(px *api.PerconaXtraDB) error {
+	if px.Annotations[api.PerconaXtraDBSkipFinalBackupAnnotation] == "true" {
+		log.Infof("Skipping final backup of PerconaXtraDB %v/%v on user request", px.Namespace, px.Name)
+		return nil
+	}
+
+	cfg, err := c.findBackupConfiguration(px)
+	if err != nil {
+		return err
+	}
+	if cfg == nil {
+		c.Recorder.Eventf(
+			px,
+			core.EventTypeWarning,
+			eventer.EventReasonFailedToDelete,
+			"Deletion is blocked: no BackupConfiguration targets PerconaXtraDB %v/%v for the final backup. Set the %q annotation to skip it",
+			px.Namespace, px.Name, api.PerconaXtraDBSkipFinalBackupAnnotation,
+		)
+		return errors.Errorf("no BackupConfiguration found for the final backup of PerconaXtraDB %v/%v", px.Namespace, px.Name)
+	}
+
+	session, err := c.Initializers.Stash.StashClient.StashV1beta1().BackupSessions(px.Namespace).Get(context.TODO(), finalBackupSessionName(px), metav1.GetOptions{})
+	if err != nil {
+		if !kerr.IsNotFound(err) {
+			return err
+		}
+		session = &stash_v1beta1.BackupSession{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      finalBackupSessionName(px),
+				Namespace: px.Namespace,
+				Labels:    px.OffshootLabels(),
+			},
+			Spec: stash_v1beta1.BackupSessionSpec{
+				Invoker: stash_v1beta1.BackupInvokerRef{
+					APIGroup: stash.GroupName,
+					Kind:     stash_v1beta1.ResourceKindBackupConfiguration,
+					Name:     cfg.Name,
+				},
+			},
+		}
+		if _, err := c.Initializers.Stash.StashClient.StashV1beta1().BackupSessions(px.Namespace).Create(context.TODO(), session, metav1.CreateOptions{}); err != nil {
+			return err
+		}
+		return errors.Errorf("final backup of PerconaXtraDB %v/%v has been triggered, waiting for it to complete", px.Namespace, px.Name)
+	}
+
+	switch session.Status.Phase {
+	case stash_v1beta1.BackupSessionSucceeded:
+		return nil
+	case stash_v1beta1.BackupSessionFailed:
+		c.Recorder.Eventf(
+			px,
+			core.EventTypeWarning,
+			eventer.EventReasonFailedToDelete,
+			"Deletion is blocked: the final backup of PerconaXtraDB %v/%v failed. Delete BackupSession %v to retry or set the %q annotation to skip it",
+			px.Namespace, px.Name, session.Name, api.PerconaXtraDBSkipFinalBackupAnnotation,
+		)
+		return errors.Errorf("final backup of PerconaXtraDB %v/%v failed", px.Namespace, px.Name)
+	default:
+		return errors.Errorf("final backup of PerconaXtraDB %v/%v has not completed yet", px.Namespace, px.Name)
+	}
+}
+
+// findBackupConfiguration returns the BackupConfiguration targeting the
+// AppBinding of this database, if any.
+func (c *Controller) findBackupConfiguration(px *api.PerconaXtraDB) (*stash_v1beta1.BackupConfiguration, error) {
+	cfgs, err := c.Initializers.Stash.StashClient.StashV1beta1().BackupConfigurations(px.Namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for i := range cfgs.Items {
+		cfg := &cfgs.Items[i]
+		if cfg.Spec.Target != nil &&
+			cfg.Spec.Target.Ref.Kind == appcat.ResourceKindApp &&
+			cfg.Spec.Target.Ref.Name == px.AppBindingMeta().Name() {
+			return cfg, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,373 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+	"kubedb.dev/apimachinery/client/clientset/versioned/typed/kubedb/v1alpha2/util"
+	"kubedb.dev/apimachinery/pkg/eventer"
+
+	"github.com/appscode/go/log"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	kmapi "kmodules.xyz/client-go/api/v1"
+)
+
+// healthCheckTick is the granularity of the health check loop. How often an
+// individual database is actually probed is governed by spec.healthChecker,
+// defaulting to every 30 seconds.
+const healthCheckTick = 10 * time.Second
+
+// RunClusterHealthChecker periodically probes the health of every managed
+// database: the Galera quorum for clusters, reflected in the ClusterQuorum
+// condition, and a plain connection check for standalone servers. It runs
+// independent of the reconcile loop, so failures are detected even while no
+// spec change is being processed.
+func (c *Controller) RunClusterHealthChecker(stopCh <-chan struct{}) {
+	go wait.Until(c.checkClusterHealth, healthCheckTick, stopCh)
+}
+
+func (c *Controller) checkClusterHealth() {
+	dbs, err := c.pxLister.PerconaXtraDBs(core.NamespaceAll).List(labels.Everything())
+	if err != nil {
+		log.Errorf("failed to list PerconaXtraDBs for health check. Reason: %v", err)
+		return
+	}
+	for _, px := range dbs {
+		if px.Spec.Halted ||
+			px.Status.Phase == "" || px.Status.Phase == api.DatabasePhaseProvisioning {
+			continue
+		}
+		if !c.shouldCheckHealth(px) {
+			continue
+		}
+		if px.UsesAsyncReplication() {
+			if err := c.checkAsyncReplication(px.DeepCopy()); err != nil {
+				log.Errorf("failed to check async replication of PerconaXtraDB %v/%v. Reason: %v", px.Namespace, px.Name, err)
+			}
+		} else if px.IsCluster() {
+			if err := c.checkClusterQuorum(px.DeepCopy()); err != nil {
+				log.Errorf("failed to check quorum of PerconaXtraDB %v/%v. Reason: %v", px.Namespace, px.Name, err)
+			}
+		} else {
+			c.checkStandaloneHealth(px.DeepCopy())
+		}
+		// a canary rollout only advances after the updated pods passed the
+		// checks above and report ready
+		if err := c.reconcileCanaryRollout(px.DeepCopy()); err != nil {
+			log.Errorf("failed to reconcile canary rollout of PerconaXtraDB %v/%v. Reason: %v", px.Namespace, px.Name, err)
+		}
+	}
+}
+
+// shouldCheckHealth gates the per-database probe on spec.healthChecker's
+// period.
+func (c *Controller) shouldCheckHealth(px *api.PerconaXtraDB) bool {
+	key := px.Namespace + "/" + px.Name
+
+	c.healthMutex.Lock()
+	defer c.healthMutex.Unlock()
+	if last, ok := c.lastHealthCheck[key]; ok && time.Since(last) < px.HealthCheckPeriod() {
+		return false
+	}
+	c.lastHealthCheck[key] = time.Now()
+	return true
+}
+
+// recordHealthCheckResult counts consecutive failures and reports whether the
+// failure threshold from spec.healthChecker has been crossed.
+func (c *Controller) recordHealthCheckResult(px *api.PerconaXtraDB, healthy bool) bool {
+	key := px.Namespace + "/" + px.Name
+
+	c.healthMutex.Lock()
+	defer c.healthMutex.Unlock()
+	if healthy {
+		delete(c.healthFailures, key)
+		return false
+	}
+	c.healthFailures[key]++
+	return c.healthFailures[key] >= px.HealthCheckFailureThreshold()
+}
+
+// checkStandaloneHealth verifies that a standalone server accepts connections
+// and answers a trivial query. Crossing the failure threshold flips the phase
+// to NotReady; a successful probe flips it back.
+func (c *Controller) checkStandaloneHealth(px *api.PerconaXtraDB) {
+	err := c.pingDatabase(px)
+	if !c.recordHealthCheckResult(px, err == nil) {
+		if err != nil {
+			log.Warningf("health check of PerconaXtraDB %v/%v failed. Reason: %v", px.Namespace, px.Name, err)
+		} else {
+			if px.Status.Phase == api.DatabasePhaseNotReady {
+				if serr := c.setHealthPhase(px, api.DatabasePhaseReady); serr != nil {
+					log.Errorln(serr)
+				}
+			}
+			if serr := c.syncReplicaStatus(px, 1, 1); serr != nil {
+				log.Errorln(serr)
+			}
+			if serr := c.enforceReadOnlyMode(px); serr != nil {
+				log.Errorln(serr)
+			}
+		}
+		return
+	}
+
+	c.Recorder.Eventf(
+		px,
+		core.EventTypeWarning,
+		eventer.EventReasonFailedToStart,
+		"PerconaXtraDB %v/%v repeatedly failed its health check. Reason: %v",
+		px.Namespace, px.Name, err,
+	)
+	if px.Status.Phase != api.DatabasePhaseNotReady {
+		if serr := c.setHealthPhase(px, api.DatabasePhaseNotReady); serr != nil {
+			log.Errorln(serr)
+		}
+	}
+	if serr := c.syncReplicaStatus(px, 1, 0); serr != nil {
+		log.Errorln(serr)
+	}
+}
+
+func (c *Controller) setHealthPhase(px *api.PerconaXtraDB, phase api.DatabasePhase) error {
+	per, err := util.UpdatePerconaXtraDBStatus(context.TODO(), c.DBClient.KubedbV1alpha2(), px.ObjectMeta, func(in *api.PerconaXtraDBStatus) *api.PerconaXtraDBStatus {
+		in.Phase = phase
+		return in
+	}, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+	px.Status = per.Status
+	return nil
+}
+
+// syncReplicaStatus records the observed cluster size and the number of synced
+// nodes in the status, skipping the update when nothing changed.
+func (c *Controller) syncReplicaStatus(px *api.PerconaXtraDB, replicas, synced int32) error {
+	if px.Status.Replicas == replicas && px.Status.SyncedReplicas == synced {
+		return nil
+	}
+	per, err := util.UpdatePerconaXtraDBStatus(context.TODO(), c.DBClient.KubedbV1alpha2(), px.ObjectMeta, func(in *api.PerconaXtraDBStatus) *api.PerconaXtraDBStatus {
+		in.Replicas = replicas
+		in.SyncedReplicas = synced
+		return in
+	}, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+	px.Status = per.Status
+	return nil
+}
+
+func (c *Controller) pingDatabase(px *api.PerconaXtraDB) error {
+	secret, err := c.Client.CoreV1().Secrets(px.Namespace).Get(context.TODO(), px.GetDatabaseSecretName(), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	en, err := sql.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s.%s.svc:%d)/%s",
+		string(secret.Data[core.BasicAuthUsernameKey]),
+		string(secret.Data[core.BasicAuthPasswordKey]),
+		px.ServiceName(), px.Namespace, px.SQLPort(),
+		c.healthCheckDSNParams(px)))
+	if err != nil {
+		return err
+	}
+	defer en.Close()
+
+	var one int
+	return markTransientIfTimeout(en.QueryRow("SELECT 1").Scan(&one))
+}
+
+// healthCheckDSNParams applies spec.healthChecker's timeout to a probe
+// connection, falling back to the operator-wide query timeout when the spec
+// does not set one.
+func (c *Controller) healthCheckDSNParams(px *api.PerconaXtraDB) string {
+	if timeout := px.HealthCheckTimeout(); timeout > 0 {
+		return fmt.Sprintf("?timeout=%s&readTimeout=%s", timeout, timeout)
+	}
+	return c.dbDSNParams()
+}
+
+// checkClusterQuorum queries the wsrep status of every running cluster pod and
+// sets the ClusterQuorum condition depending on whether a primary component
+// exists. Losing quorum also moves the phase to NotReady and emits a warning
+// event.
+func (c *Controller) checkClusterQuorum(px *api.PerconaXtraDB) error {
+	pods, err := c.Client.CoreV1().Pods(px.Namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(px.OffshootSelectors()).String(),
+	})
+	if err != nil {
+		return err
+	}
+
+	// keep the rendered gcomm list in sync with the current pod IPs, so a
+	// restarting node joins via addresses that are still valid
+	if usesPodIPAddressStrategy(px) {
+		if err := c.ensureClusterAddressConfig(px); err != nil {
+			log.Errorln(err)
+		}
+	}
+
+	hasPrimary := false
+	reachable := 0
+	synced := 0
+	var states []string
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Status.PodIP == "" {
+			continue
+		}
+		status, ready, state, localState, err := c.podQuorumState(px, pod.Status.PodIP)
+		if err != nil {
+			states = append(states, fmt.Sprintf("%s: unreachable", pod.Name))
+			continue
+		}
+		reachable++
+		observeWsrepState(px, pod.Name, localState)
+		// remember the node's seqno while it is reachable; after a full
+		// outage it decides which node may bootstrap
+		if seqno, err := c.podLastCommitted(px, pod.Status.PodIP); err == nil {
+			c.recordSeqno(px, pod.Name, seqno)
+		}
+		states = append(states, fmt.Sprintf("%s: status=%s, ready=%s, state=%s", pod.Name, status, ready, state))
+		// an SST donor may report wsrep_ready OFF while it feeds a joiner;
+		// that is a healthy transition, not a failed node
+		if status == galeraClusterStatusPrimary && (ready == "ON" || isDonorState(state)) {
+			hasPrimary = true
+		}
+		if state == "Synced" {
+			synced++
+		}
+	}
+
+	// surface the cluster's own view of its size next to the number of synced
+	// nodes, so `kubectl get` shows how much of the cluster is usable
+	size := 0
+	if hasPrimary {
+		if _, s, serr := c.galeraClusterStatus(px); serr != nil {
+			log.Errorln(serr)
+		} else {
+			size = s
+		}
+	}
+	if serr := c.syncReplicaStatus(px, int32(size), int32(synced)); serr != nil {
+		log.Errorln(serr)
+	}
+	if serr := c.syncPrimaryStatus(px); serr != nil {
+		log.Errorln(serr)
+	}
+
+	if hasPrimary {
+		c.recordHealthCheckResult(px, true)
+		if err := c.clearBootstrapRecovery(px); err != nil {
+			log.Errorln(err)
+		}
+		if err := c.enforceReadOnlyMode(px); err != nil {
+			log.Errorln(err)
+		}
+		return c.setQuorumCondition(px, true, fmt.Sprintf("Cluster has a primary component. %s", strings.Join(states, "; ")))
+	}
+
+	// only flip the condition once the failure threshold from
+	// spec.healthChecker has been crossed
+	if !c.recordHealthCheckResult(px, false) {
+		log.Warningf("PerconaXtraDB %v/%v has no primary component yet. %s", px.Namespace, px.Name, strings.Join(states, "; "))
+		return nil
+	}
+
+	// every node is down: pick a bootstrap node, so the cluster can recover
+	// from the full outage
+	if reachable == 0 && len(pods.Items) > 0 {
+		if err := c.armBootstrapRecovery(px); err != nil {
+			return err
+		}
+		if err := c.recreateStalePods(px, pods); err != nil {
+			return err
+		}
+	}
+
+	c.Recorder.Eventf(
+		px,
+		core.EventTypeWarning,
+		eventer.EventReasonFailedToStart,
+		"PerconaXtraDB %v/%v lost cluster quorum. %s",
+		px.Namespace, px.Name, strings.Join(states, "; "),
+	)
+	return c.setQuorumCondition(px, false, fmt.Sprintf("Cluster has no primary component. %s", strings.Join(states, "; ")))
+}
+
+func (c *Controller) setQuorumCondition(px *api.PerconaXtraDB, hasQuorum bool, msg string) error {
+	per, err := util.UpdatePerconaXtraDBStatus(context.TODO(), c.DBClient.KubedbV1alpha2(), px.ObjectMeta, func(in *api.PerconaXtraDBStatus) *api.PerconaXtraDBStatus {
+		in.Conditions = kmapi.SetCondition(in.Conditions, kmapi.NewCondition(api.DatabaseClusterQuorum, msg, px.Generation, hasQuorum))
+		if !hasQuorum {
+			in.Phase = api.DatabasePhaseNotReady
+		} else if in.Phase == api.DatabasePhaseNotReady {
+			in.Phase = api.DatabasePhaseReady
+		}
+		return in
+	}, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+	px.Status = per.Status
+	return nil
+}
+
+// podQuorumState returns wsrep_cluster_status, wsrep_ready,
+// wsrep_local_state_comment and the numeric wsrep_local_state of a single
+// node.
+func (c *Controller) podQuorumState(px *api.PerconaXtraDB, podIP string) (string, string, string, string, error) {
+	secret, err := c.Client.CoreV1().Secrets(px.Namespace).Get(context.TODO(), px.GetDatabaseSecretName(), metav1.GetOptions{})
+	if err != nil {
+		return "", "", "", "", err
+	}
+
+	en, err := sql.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s:%d)/%s",
+		string(secret.Data[core.BasicAuthUsernameKey]),
+		string(secret.Data[core.BasicAuthPasswordKey]),
+		podIP, px.SQLPort(),
+		c.healthCheckDSNParams(px)))
+	if err != nil {
+		return "", "", "", "", err
+	}
+	defer en.Close()
+
+	var name, status, ready, state, localState string
+	if err := en.QueryRow(`SHOW STATUS LIKE 'wsrep_cluster_status'`).Scan(&name, &status); err != nil {
+		return "", "", "", "", err
+	}
+	if err := en.QueryRow(`SHOW STATUS LIKE 'wsrep_ready'`).Scan(&name, &ready); err != nil {
+		return "", "", "", "", err
+	}
+	if err := en.QueryRow(`SHOW STATUS LIKE 'wsrep_local_state_comment'`).Scan(&name, &state); err != nil {
+		return "", "", "", "", err
+	}
+	if err := en.QueryRow(`SHOW STATUS LIKE 'wsrep_local_state'`).Scan(&name, &localState); err != nil {
+		return "", "", "", "", err
+	}
+	return status, ready, state, localState, nil
+}
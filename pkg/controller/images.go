@@ -0,0 +1,51 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+)
+
+// The helper container images normally come from the version catalog. A
+// spec.auxiliaryImages override wins, so air-gapped clusters can pull every
+// container from a local registry without patching the catalog or the
+// StatefulSet.
+
+// exporterImage returns the metrics exporter sidecar image.
+func exporterImage(px *api.PerconaXtraDB, catalogImage string) string {
+	if px.Spec.AuxiliaryImages != nil && px.Spec.AuxiliaryImages.Exporter != "" {
+		return px.Spec.AuxiliaryImages.Exporter
+	}
+	return catalogImage
+}
+
+// coordinatorImage returns the image the coordinator sidecar runs.
+func coordinatorImage(px *api.PerconaXtraDB, catalogImage string) string {
+	if px.Spec.AuxiliaryImages != nil && px.Spec.AuxiliaryImages.Coordinator != "" {
+		return px.Spec.AuxiliaryImages.Coordinator
+	}
+	return catalogImage
+}
+
+// initHelperImage returns the helper init container image the operator uses
+// for datadir preparation, init script staging and SST related jobs.
+func initHelperImage(px *api.PerconaXtraDB, catalogImage string) string {
+	if px.Spec.AuxiliaryImages != nil && px.Spec.AuxiliaryImages.Init != "" {
+		return px.Spec.AuxiliaryImages.Init
+	}
+	return catalogImage
+}
@@ -0,0 +1,66 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"strings"
+
+	core "k8s.io/api/core/v1"
+)
+
+// mergeExecHook combines a user-provided lifecycle hook with an
+// operator-managed shell step, so both run instead of the user hook replacing
+// the operator's. operatorFirst fixes the ordering: the upgrade step runs
+// before the user's postStart, while the shutdown runs after the user's
+// preStop, since nothing can talk to the server once it is down. Only exec
+// hooks can be combined; admission rejects other handler types.
+func mergeExecHook(user *core.Handler, operatorCmd string, operatorFirst bool) *core.Handler {
+	userScript := userHookScript(user)
+	if userScript == "" {
+		return execHook(operatorCmd)
+	}
+	if operatorFirst {
+		return execHook(operatorCmd + "\n" + userScript)
+	}
+	return execHook(userScript + "\n" + operatorCmd)
+}
+
+func execHook(script string) *core.Handler {
+	return &core.Handler{
+		Exec: &core.ExecAction{
+			Command: []string{"bash", "-c", script},
+		},
+	}
+}
+
+// userHookScript turns the exec command of a user hook into a shell fragment.
+// A plain "sh -c"/"bash -c" wrapper is unwrapped; any other argv is quoted
+// verbatim.
+func userHookScript(user *core.Handler) string {
+	if user == nil || user.Exec == nil || len(user.Exec.Command) == 0 {
+		return ""
+	}
+	cmd := user.Exec.Command
+	if len(cmd) == 3 && (cmd[0] == "bash" || cmd[0] == "sh" || cmd[0] == "/bin/bash" || cmd[0] == "/bin/sh") && cmd[1] == "-c" {
+		return cmd[2]
+	}
+	quoted := make([]string, 0, len(cmd))
+	for _, arg := range cmd {
+		quoted = append(quoted, "'"+strings.ReplaceAll(arg, "'", `'\''`)+"'")
+	}
+	return strings.Join(quoted, " ")
+}
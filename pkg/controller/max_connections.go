@@ -0,0 +1,145 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+
+	"github.com/appscode/go/log"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	core_util "kmodules.xyz/client-go/core/v1"
+)
+
+const (
+	maxConnectionsConfigFileName = "max-connections.cnf"
+	maxConnectionsAnnotation     = api.PerconaXtraDBKey + "/max-connections"
+
+	// the per-connection memory the automatic mode budgets for sort, join and
+	// read buffers; a deliberately conservative figure so the limit errs
+	// toward refusing connections over getting the container OOM killed
+	maxConnectionsMemoryPerConnection = 12 << 20
+
+	// the automatic mode never computes a limit below the server default of
+	// 151, so a small memory limit does not lock the database down
+	maxConnectionsFloor = 151
+)
+
+func (c *Controller) maxConnectionsConfigName(px *api.PerconaXtraDB) string {
+	return px.OffshootName() + "-max-connections-config"
+}
+
+// computeMaxConnections returns the max_connections to enforce: the explicit
+// spec.maxConnections.value, or in automatic mode a value derived from the
+// container memory left after the buffer pool share. 0 means the server
+// default is kept, either because nothing is configured or because automatic
+// mode has no memory limit to work from.
+func computeMaxConnections(px *api.PerconaXtraDB) int64 {
+	if px.Spec.MaxConnections == nil {
+		return 0
+	}
+	if px.Spec.MaxConnections.Value != nil {
+		return int64(*px.Spec.MaxConnections.Value)
+	}
+	if !px.Spec.MaxConnections.Auto {
+		return 0
+	}
+	limit, found := px.Spec.PodTemplate.Spec.Resources.Limits[core.ResourceMemory]
+	if !found || limit.IsZero() {
+		return 0
+	}
+	available := limit.Value()
+	if px.Spec.AutoTuneBufferPool != nil {
+		available -= computeBufferPoolSize(px)
+	}
+	n := available / maxConnectionsMemoryPerConnection
+	if n < maxConnectionsFloor {
+		n = maxConnectionsFloor
+	}
+	return n
+}
+
+// maxConnectionsConfig renders the my.cnf snippet with the connection limit.
+func maxConnectionsConfig(limit int64) string {
+	return fmt.Sprintf(`[mysqld]
+max_connections=%d
+`, limit)
+}
+
+// ensureMaxConnectionsConfig creates a ConfigMap holding the my.cnf snippet
+// with the connection limit, so the setting survives server restarts.
+func (c *Controller) ensureMaxConnectionsConfig(px *api.PerconaXtraDB, limit int64) error {
+	owner := metav1.NewControllerRef(px, api.SchemeGroupVersion.WithKind(api.ResourceKindPerconaXtraDB))
+
+	cnf := maxConnectionsConfig(limit)
+
+	meta := metav1.ObjectMeta{
+		Name:      c.maxConnectionsConfigName(px),
+		Namespace: px.Namespace,
+	}
+
+	_, _, err := core_util.CreateOrPatchConfigMap(context.TODO(), c.Client, meta, func(in *core.ConfigMap) *core.ConfigMap {
+		core_util.EnsureOwnerReference(&in.ObjectMeta, owner)
+		in.Labels = px.OffshootLabels()
+		in.Data = map[string]string{
+			maxConnectionsConfigFileName: cnf,
+		}
+		return in
+	}, metav1.PatchOptions{})
+	return err
+}
+
+// applyMaxConnections pushes a raised connection limit to the running servers
+// via SET GLOBAL; max_connections is a dynamic variable, so no restart is
+// needed and the generated config file carries the value across restarts. A
+// lowered limit is deliberately not applied live, since MySQL would not cut
+// connections above the new limit anyway and the running count could exceed
+// it; it takes effect on the next server restart instead.
+func (c *Controller) applyMaxConnections(px *api.PerconaXtraDB) error {
+	sts, err := c.Client.AppsV1().StatefulSets(px.Namespace).Get(context.TODO(), px.OffshootName(), metav1.GetOptions{})
+	if err != nil {
+		if kerr.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	running := sts.Spec.Template.Annotations[maxConnectionsAnnotation]
+	desired := px.Spec.PodTemplate.Annotations[maxConnectionsAnnotation]
+	if running == desired || desired == "" {
+		return nil
+	}
+
+	limit, err := strconv.ParseInt(desired, 10, 64)
+	if err != nil {
+		return err
+	}
+	if running != "" {
+		current, err := strconv.ParseInt(running, 10, 64)
+		if err == nil && limit < current {
+			log.Infof("PerconaXtraDB %v/%v lowers max_connections from %d to %d; the new limit takes effect on the next server restart", px.Namespace, px.Name, current, limit)
+			return nil
+		}
+	}
+	return c.applyDynamicConfig(px, map[string]string{
+		"max_connections": strconv.FormatInt(limit, 10),
+	})
+}
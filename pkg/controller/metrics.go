@@ -0,0 +1,131 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metrics "k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+// The operator serves these metrics on the same /metrics endpoint the
+// webhook server already exposes via the apiserver legacy registry.
+var (
+	reconcileDuration = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Namespace: "kubedb",
+			Subsystem: "percona_xtradb",
+			Name:      "reconcile_duration_seconds",
+			Help:      "Time taken by one reconcile pass of a PerconaXtraDB object, labeled by the resulting phase.",
+			Buckets:   metrics.ExponentialBuckets(0.1, 2, 12),
+		},
+		[]string{"namespace", "name", "phase"},
+	)
+	reconcileErrors = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace: "kubedb",
+			Subsystem: "percona_xtradb",
+			Name:      "reconcile_errors_total",
+			Help:      "Number of failed reconcile passes of a PerconaXtraDB object, labeled by error category.",
+		},
+		[]string{"namespace", "name", "category"},
+	)
+	wsrepLocalState = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace: "kubedb",
+			Subsystem: "percona_xtradb",
+			Name:      "wsrep_local_state",
+			Help:      "Numeric wsrep_local_state of a cluster node as seen by the operator health check (4 means Synced).",
+		},
+		[]string{"namespace", "name", "pod"},
+	)
+	wsrepStateTransitions = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace: "kubedb",
+			Subsystem: "percona_xtradb",
+			Name:      "wsrep_local_state_transitions_total",
+			Help:      "Number of wsrep_local_state changes of a cluster node observed between health checks.",
+		},
+		[]string{"namespace", "name", "pod"},
+	)
+)
+
+func init() {
+	legacyregistry.MustRegister(reconcileDuration)
+	legacyregistry.MustRegister(reconcileErrors)
+	legacyregistry.MustRegister(wsrepLocalState)
+	legacyregistry.MustRegister(wsrepStateTransitions)
+}
+
+// lastWsrepState remembers the state last exported per node, so the transition
+// counter only moves when the state actually changes between health checks.
+var (
+	wsrepStateMutex sync.Mutex
+	lastWsrepState  = map[string]float64{}
+)
+
+// observeWsrepState exports the wsrep_local_state of one cluster node and
+// counts the transition if it differs from the previously observed state.
+// Values that do not parse as a number are ignored.
+func observeWsrepState(px *api.PerconaXtraDB, podName, localState string) {
+	state, err := strconv.ParseFloat(localState, 64)
+	if err != nil {
+		return
+	}
+	wsrepLocalState.WithLabelValues(px.Namespace, px.Name, podName).Set(state)
+
+	key := px.Namespace + "/" + px.Name + "/" + podName
+	wsrepStateMutex.Lock()
+	defer wsrepStateMutex.Unlock()
+	if last, ok := lastWsrepState[key]; ok && last != state {
+		wsrepStateTransitions.WithLabelValues(px.Namespace, px.Name, podName).Inc()
+	}
+	lastWsrepState[key] = state
+}
+
+// observeReconcile records the duration of one reconcile pass and counts the
+// error, if any.
+func observeReconcile(px *api.PerconaXtraDB, start time.Time, err error) {
+	reconcileDuration.WithLabelValues(px.Namespace, px.Name, string(px.Status.Phase)).Observe(time.Since(start).Seconds())
+	if err != nil {
+		reconcileErrors.WithLabelValues(px.Namespace, px.Name, errorCategory(err)).Inc()
+	}
+}
+
+// errorCategory maps an error to a coarse category usable as a metric label.
+func errorCategory(err error) string {
+	switch {
+	case kerr.IsNotFound(err):
+		return "not_found"
+	case kerr.IsConflict(err):
+		return "conflict"
+	case kerr.IsInvalid(err) || kerr.IsBadRequest(err):
+		return "invalid"
+	case kerr.IsForbidden(err) || kerr.IsUnauthorized(err):
+		return "forbidden"
+	case kerr.IsTimeout(err) || kerr.IsServerTimeout(err):
+		return "timeout"
+	default:
+		return "internal"
+	}
+}
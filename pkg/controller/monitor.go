@@ -40,7 +40,11 @@ func (c *Controller) newMonitorController(px *api.PerconaXtraDB) (mona.Agent, er
 	}
 
 	if monitorSpec.Prometheus != nil {
-		return agents.New(monitorSpec.Agent, c.Client, c.promClient), nil
+		agent := agents.New(monitorSpec.Agent, c.Client, c.promClient)
+		if agent == nil {
+			return nil, fmt.Errorf("unsupported monitoring agent %q for PerconaXtraDB %v/%v", monitorSpec.Agent, px.Namespace, px.Name)
+		}
+		return agent, nil
 	}
 
 	return nil, fmt.Errorf("monitoring controller not found for PerconaXtraDB %v/%v in %v", px.Namespace, px.Name, monitorSpec)
@@ -88,6 +92,29 @@ func (c *Controller) setNewAgent(px *api.PerconaXtraDB) error {
 
 func (c *Controller) manageMonitor(px *api.PerconaXtraDB) error {
 	oldAgent := c.getOldAgent(px)
+
+	// paused monitoring keeps the stats service and the monitor spec, but
+	// removes the ServiceMonitor; the exporter sidecar is dropped from the pod
+	// template separately. Clearing the flag restores everything below.
+	if px.Spec.Monitor != nil && px.Spec.Monitor.Paused {
+		if oldAgent != nil {
+			vt, err := oldAgent.Delete(px.StatsService())
+			if err != nil {
+				log.Errorf("error in deleting Prometheus agent. Reason: %s", err)
+			}
+			if vt == kutil.VerbDeleted {
+				c.Recorder.Eventf(
+					px,
+					core.EventTypeNormal,
+					"MonitoringPaused",
+					"Monitoring of PerconaXtraDB %v/%v is paused; the monitor spec is retained",
+					px.Namespace, px.Name,
+				)
+			}
+		}
+		return nil
+	}
+
 	if px.Spec.Monitor != nil {
 		if oldAgent != nil &&
 			oldAgent.GetType() != px.Spec.Monitor.Agent {
@@ -98,6 +125,14 @@ func (c *Controller) manageMonitor(px *api.PerconaXtraDB) error {
 		if _, err := c.addOrUpdateMonitor(px); err != nil {
 			return err
 		}
+		// the https flip only applies to the ServiceMonitor written by the
+		// operator agent; the builtin agent's scrape annotations carry the
+		// scheme via StatsService().Scheme() already
+		if exporterTLSEnabled(px) && px.Spec.Monitor.Agent == mona.AgentPrometheusOperator {
+			if err := c.ensureServiceMonitorTLS(px); err != nil {
+				return err
+			}
+		}
 		return c.setNewAgent(px)
 	} else if oldAgent != nil {
 		if _, err := oldAgent.Delete(px.StatsService()); err != nil {
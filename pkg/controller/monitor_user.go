@@ -0,0 +1,147 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+
+	"github.com/pkg/errors"
+	passgen "gomodules.xyz/password-generator"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	mona "kmodules.xyz/monitoring-agent-api/api/v1"
+)
+
+// monitorUsername is the database user the exporter sidecar authenticates
+// with when the operator provisions it.
+const monitorUsername = "kubedb-monitor"
+
+// exporterSecretName returns the secret holding the exporter credentials: the
+// user supplied secret when auto-creation is disabled, the generated
+// "-monitor" secret otherwise.
+func exporterSecretName(px *api.PerconaXtraDB) string {
+	if px.Spec.MonitorUser != nil && px.Spec.MonitorUser.DisableAutoCreation {
+		return px.Spec.MonitorUser.SecretName
+	}
+	return px.OffshootName() + "-monitor"
+}
+
+// monitorUserAutoCreated reports whether the operator manages the monitoring
+// user and its secret itself.
+func monitorUserAutoCreated(px *api.PerconaXtraDB) bool {
+	return px.Spec.MonitorUser == nil || !px.Spec.MonitorUser.DisableAutoCreation
+}
+
+// monitorEnabled reports whether a Prometheus exporter sidecar is part of the
+// pod template.
+func monitorEnabled(px *api.PerconaXtraDB) bool {
+	return px.Spec.Monitor != nil && px.Spec.Monitor.Agent.Vendor() == mona.VendorPrometheus
+}
+
+// ensureMonitorUserSecret generates the credentials of the dedicated
+// monitoring user. It runs before the StatefulSet is created, since the
+// exporter sidecar reads its DSN from this secret.
+func (c *Controller) ensureMonitorUserSecret(px *api.PerconaXtraDB) error {
+	if !monitorEnabled(px) || !monitorUserAutoCreated(px) {
+		return nil
+	}
+
+	secretName := exporterSecretName(px)
+	sc, err := c.checkSecret(secretName, px)
+	if err != nil {
+		return err
+	}
+	if sc == nil {
+		secret := &core.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   secretName,
+				Labels: px.OffshootLabels(),
+			},
+			Type: core.SecretTypeOpaque,
+			StringData: map[string]string{
+				core.BasicAuthUsernameKey: monitorUsername,
+				core.BasicAuthPasswordKey: passgen.Generate(api.DefaultPasswordLength),
+			},
+		}
+
+		if _, err := c.Client.CoreV1().Secrets(px.Namespace).Create(context.TODO(), secret, metav1.CreateOptions{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncMonitorUser provisions the monitoring user on the running database with
+// the minimal grants the enabled collectors need. When auto-creation is
+// disabled the user supplied credentials are used as-is and nothing is
+// provisioned.
+func (c *Controller) syncMonitorUser(px *api.PerconaXtraDB) error {
+	if !monitorEnabled(px) || !monitorUserAutoCreated(px) {
+		return nil
+	}
+
+	secret, err := c.Client.CoreV1().Secrets(px.Namespace).Get(context.TODO(), exporterSecretName(px), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	password := string(secret.Data[core.BasicAuthPasswordKey])
+	if password == "" {
+		return errors.Errorf(`secret "%v/%v" is missing key %q`, px.Namespace, secret.Name, core.BasicAuthPasswordKey)
+	}
+
+	en, err := c.connectToPrimary(px)
+	if err != nil {
+		return err
+	}
+	defer en.Close()
+
+	if _, err := en.Exec(fmt.Sprintf("CREATE USER IF NOT EXISTS '%s'@'%%' IDENTIFIED BY %s", monitorUsername, quoteStringLiteral(password))); err != nil {
+		return errors.Wrapf(err, "failed to create user %q", monitorUsername)
+	}
+	// keep the password in sync if the generated secret has been rotated
+	if _, err := en.Exec(fmt.Sprintf("ALTER USER '%s'@'%%' IDENTIFIED BY %s", monitorUsername, quoteStringLiteral(password))); err != nil {
+		return errors.Wrapf(err, "failed to update password of user %q", monitorUsername)
+	}
+	for _, grant := range monitorUserGrants(px) {
+		if _, err := en.Exec(fmt.Sprintf("GRANT %s TO '%s'@'%%'", grant, monitorUsername)); err != nil {
+			return errors.Wrapf(err, "failed to apply grant %q to user %q", grant, monitorUsername)
+		}
+	}
+	if _, err := en.Exec("FLUSH PRIVILEGES"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// monitorUserGrants limits the monitoring user to what the enabled collectors
+// read: the status and replication collectors need PROCESS and REPLICATION
+// CLIENT, and only the perf_schema collectors read actual table data, all of
+// it under performance_schema.
+func monitorUserGrants(px *api.PerconaXtraDB) []string {
+	grants := []string{"PROCESS, REPLICATION CLIENT ON *.*"}
+	for _, collector := range px.Spec.Monitor.Prometheus.Exporter.Collectors {
+		if strings.HasPrefix(collector, "perf_schema.") {
+			grants = append(grants, "SELECT ON performance_schema.*")
+			break
+		}
+	}
+	return grants
+}
@@ -0,0 +1,93 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+
+	networking "k8s.io/api/networking/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	core_util "kmodules.xyz/client-go/core/v1"
+)
+
+// ensureNetworkPolicy enforces spec.allowedSchemas with a NetworkPolicy
+// selecting the database pods. The database's own namespace is always
+// admitted, so replication, sidecars and the operator keep working; consumers
+// from other namespaces have to match the declared selectors. Without
+// spec.allowedSchemas any previously created policy is removed again.
+func (c *Controller) ensureNetworkPolicy(px *api.PerconaXtraDB) error {
+	if px.Spec.AllowedSchemas == nil {
+		err := c.Client.NetworkingV1().NetworkPolicies(px.Namespace).Delete(context.TODO(), px.OffshootName(), metav1.DeleteOptions{})
+		if err != nil && !kerr.IsNotFound(err) {
+			return err
+		}
+		return nil
+	}
+
+	owner := metav1.NewControllerRef(px, api.SchemeGroupVersion.WithKind(api.ResourceKindPerconaXtraDB))
+
+	peers := []networking.NetworkPolicyPeer{
+		{
+			// every pod of the database's own namespace
+			PodSelector: &metav1.LabelSelector{},
+		},
+		{
+			NamespaceSelector: px.Spec.AllowedSchemas.NamespaceSelector,
+			PodSelector:       px.Spec.AllowedSchemas.Selector,
+		},
+	}
+
+	policy := &networking.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      px.OffshootName(),
+			Namespace: px.Namespace,
+			Labels:    px.OffshootLabels(),
+		},
+		Spec: networking.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: px.OffshootSelectors(),
+			},
+			PolicyTypes: []networking.PolicyType{
+				networking.PolicyTypeIngress,
+			},
+			Ingress: []networking.NetworkPolicyIngressRule{
+				{
+					From: peers,
+				},
+			},
+		},
+	}
+	core_util.EnsureOwnerReference(&policy.ObjectMeta, owner)
+
+	existing, err := c.Client.NetworkingV1().NetworkPolicies(px.Namespace).Get(context.TODO(), policy.Name, metav1.GetOptions{})
+	if err != nil {
+		if !kerr.IsNotFound(err) {
+			return err
+		}
+		_, err = c.Client.NetworkingV1().NetworkPolicies(px.Namespace).Create(context.TODO(), policy, metav1.CreateOptions{})
+		return err
+	}
+
+	existing.Labels = policy.Labels
+	existing.OwnerReferences = policy.OwnerReferences
+	existing.Spec = policy.Spec
+	_, err = c.Client.NetworkingV1().NetworkPolicies(px.Namespace).Update(context.TODO(), existing, metav1.UpdateOptions{})
+	return err
+}
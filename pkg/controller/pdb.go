@@ -0,0 +1,78 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+	"kubedb.dev/apimachinery/pkg/eventer"
+
+	core "k8s.io/api/core/v1"
+	policy "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	kutil "kmodules.xyz/client-go"
+	core_util "kmodules.xyz/client-go/core/v1"
+	policy_util "kmodules.xyz/client-go/policy/v1beta1"
+)
+
+// ensurePodDisruptionBudget creates a PodDisruptionBudget for cluster mode, so
+// that node drains can not take down enough pods to break quorum. Standalone
+// databases are skipped.
+func (c *Controller) ensurePodDisruptionBudget(px *api.PerconaXtraDB) (kutil.VerbType, error) {
+	if !px.IsCluster() {
+		return kutil.VerbUnchanged, nil
+	}
+
+	owner := metav1.NewControllerRef(px, api.SchemeGroupVersion.WithKind(api.ResourceKindPerconaXtraDB))
+
+	meta := metav1.ObjectMeta{
+		Name:      px.OffshootName(),
+		Namespace: px.Namespace,
+	}
+
+	_, vt, err := policy_util.CreateOrPatchPodDisruptionBudget(context.TODO(), c.Client, meta, func(in *policy.PodDisruptionBudget) *policy.PodDisruptionBudget {
+		core_util.EnsureOwnerReference(&in.ObjectMeta, owner)
+		in.Labels = px.OffshootLabels()
+
+		in.Spec.Selector = &metav1.LabelSelector{
+			MatchLabels: px.OffshootSelectors(),
+		}
+		if px.Spec.PodDisruptionBudget != nil && px.Spec.PodDisruptionBudget.MinAvailable != nil {
+			in.Spec.MinAvailable = px.Spec.PodDisruptionBudget.MinAvailable
+			in.Spec.MaxUnavailable = nil
+		} else {
+			maxUnavailable := intstr.FromInt(1)
+			in.Spec.MaxUnavailable = &maxUnavailable
+			in.Spec.MinAvailable = nil
+		}
+		return in
+	}, metav1.PatchOptions{})
+	if err != nil {
+		return kutil.VerbUnchanged, err
+	} else if vt != kutil.VerbUnchanged {
+		c.Recorder.Eventf(
+			px,
+			core.EventTypeNormal,
+			eventer.EventReasonSuccessful,
+			"Successfully %s PodDisruptionBudget",
+			vt,
+		)
+	}
+	return vt, nil
+}
@@ -19,6 +19,7 @@ package controller
 import (
 	"context"
 	"fmt"
+	"time"
 
 	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
 	"kubedb.dev/apimachinery/client/clientset/versioned/typed/kubedb/v1alpha2/util"
@@ -35,8 +36,16 @@ import (
 	dynamic_util "kmodules.xyz/client-go/dynamic"
 )
 
-func (c *Controller) create(px *api.PerconaXtraDB) error {
-	if err := validator.ValidatePerconaXtraDB(c.Client, c.DBClient, px, true); err != nil {
+func (c *Controller) create(px *api.PerconaXtraDB) (err error) {
+	start := time.Now()
+	defer func() {
+		observeReconcile(px, start, err)
+	}()
+
+	trace := newReconcileTracer(px)
+	trace.Tracef("starting create/patch reconcile")
+
+	if err := validator.ValidatePerconaXtraDB(c.Client, c.DBClient, px, true, false); err != nil {
 		c.Recorder.Event(
 			px,
 			core.EventTypeWarning,
@@ -59,6 +68,15 @@ func (c *Controller) create(px *api.PerconaXtraDB) error {
 		px.Status = perconaxtradb.Status
 	}
 
+	// coming back from spec.halted: ensurePerconaXtraDB scales the
+	// StatefulSet up again below, but a Galera cluster first needs its
+	// bootstrap node chosen from the grastate.dat files the halt preserved
+	if px.Status.Phase == api.DatabasePhaseHalted {
+		if err := c.armUnhaltBootstrap(px); err != nil {
+			return err
+		}
+	}
+
 	// For Percona XtraDB Cluster (px.spec.replicas > 1), Stash restores the data into some PVCs.
 	// Then, KubeDB should create the StatefulSet using those PVCs. So, for clustering mode, we are going to
 	// wait for restore process to complete before creating the StatefulSet.
@@ -68,6 +86,9 @@ func (c *Controller) create(px *api.PerconaXtraDB) error {
 		// For initial restore, "Provisioned" condition won't exist and "DataRestored" condition either won't exist or will be "False".
 		if !kmapi.HasCondition(px.Status.Conditions, api.DatabaseProvisioned) &&
 			!kmapi.IsConditionTrue(px.Status.Conditions, api.DatabaseDataRestored) {
+			if err := c.checkRestoreTimeout(px); err != nil {
+				return err
+			}
 			// write log indicating that the database is waiting for the data to be restored by external initializer
 			log.Infof("Database %s %s/%s is waiting for data to be restored by external initializer",
 				px.Kind,
@@ -96,16 +117,67 @@ func (c *Controller) create(px *api.PerconaXtraDB) error {
 	if err != nil {
 		return err
 	}
+	trace.Tracef("database service ensured (%v)", vt1)
+
+	// gate which consumers can reach the database behind the AppBinding
+	if err := c.ensureNetworkPolicy(px); err != nil {
+		return err
+	}
 
 	if err := c.ensureDatabaseSecret(px); err != nil {
 		return err
 	}
 
+	// the exporter sidecar reads its DSN credentials from this secret, so it
+	// has to exist before the StatefulSet references it
+	if err := c.ensureMonitorUserSecret(px); err != nil {
+		return err
+	}
+
+	// replicas of an async source-replica cluster authenticate with this
+	// dedicated user instead of the root credentials
+	if err := c.ensureReplicationUserSecret(px); err != nil {
+		return err
+	}
+
+	// the keyring_vault plugin config has to exist before the StatefulSet
+	// mounts it
+	if err := c.ensureKeyringVaultConfig(px); err != nil {
+		return err
+	}
+
+	if px.Spec.ProxySQL != nil {
+		if err := c.ensureProxySQLSecret(px); err != nil {
+			return err
+		}
+		if err := c.ensureProxySQLConfig(px); err != nil {
+			return err
+		}
+	}
+
+	// expand existing PVCs before the StatefulSet template picks up a grown
+	// spec.storage request
+	if err := c.expandStorage(px); err != nil {
+		return err
+	}
+
 	// ensure database StatefulSet
 	vt2, err := c.ensurePerconaXtraDB(px)
 	if err != nil {
 		return err
 	}
+	trace.Tracef("StatefulSet ensured (%v)", vt2)
+
+	// ensure PodDisruptionBudget for cluster mode
+	if _, err := c.ensurePodDisruptionBudget(px); err != nil {
+		return err
+	}
+
+	// surface pods the scheduler cannot place, e.g. because the resource
+	// requests exceed every node, instead of silently staying NotReady
+	if err := c.syncUnschedulableCondition(px); err != nil {
+		log.Errorln(err)
+	}
 
 	if vt1 == kutil.VerbCreated && vt2 == kutil.VerbCreated {
 		c.Recorder.Event(
@@ -137,6 +209,9 @@ func (c *Controller) create(px *api.PerconaXtraDB) error {
 		// For initial restore, "Provisioned" condition won't exist and "DataRestored" condition either won't exist or will be "False".
 		if !kmapi.HasCondition(px.Status.Conditions, api.DatabaseProvisioned) &&
 			!kmapi.IsConditionTrue(px.Status.Conditions, api.DatabaseDataRestored) {
+			if err := c.checkRestoreTimeout(px); err != nil {
+				return err
+			}
 			// write log indicating that the database is waiting for the data to be restored by external initializer
 			log.Infof("Database %s %s/%s is waiting for data to be restored by external initializer",
 				px.Kind,
@@ -148,6 +223,17 @@ func (c *Controller) create(px *api.PerconaXtraDB) error {
 		}
 	}
 
+	// hold the Ready phase back while a replica is missing too many
+	// transactions from the primary's GTID executed set
+	caughtUp, err := c.checkReplicationLag(px)
+	if err != nil {
+		return err
+	}
+	if !caughtUp {
+		log.Infof("PerconaXtraDB %v/%v is waiting for its replicas to catch up before becoming Ready", px.Namespace, px.Name)
+		return nil
+	}
+
 	per, err := util.UpdatePerconaXtraDBStatus(context.TODO(), c.DBClient.KubedbV1alpha2(), px.ObjectMeta, func(in *api.PerconaXtraDBStatus) *api.PerconaXtraDBStatus {
 		in.Phase = api.DatabasePhaseReady
 		in.ObservedGeneration = px.Generation
@@ -158,6 +244,34 @@ func (c *Controller) create(px *api.PerconaXtraDB) error {
 	}
 	px.Status = per.Status
 
+	// keep the role and wsrep state labels on the pods fresh, so that the read
+	// service only targets synced secondaries
+	if err := c.labelClusterPods(px); err != nil {
+		log.Errorln(err)
+	}
+
+	// provision the users declared in spec.users now that the database is ready
+	c.reconcileUsers(px)
+
+	// likewise the schemas declared in spec.databases
+	c.reconcileDatabases(px)
+
+	// the dedicated monitoring user can only be granted on a running server
+	if err := c.syncMonitorUser(px); err != nil {
+		log.Errorln(err)
+	}
+
+	// tie the Stash backup lifecycle to the database now that it is ready
+	if err := c.ensureBackupConfiguration(px); err != nil {
+		log.Errorln(err)
+	}
+
+	// apply spec.readOnly right away instead of waiting for the next health
+	// check pass to pick it up
+	if err := c.enforceReadOnlyMode(px); err != nil {
+		log.Errorln(err)
+	}
+
 	// ensure StatsService for desired monitoring
 	if _, err := c.ensureStatsService(px); err != nil {
 		c.Recorder.Eventf(
@@ -186,7 +300,48 @@ func (c *Controller) create(px *api.PerconaXtraDB) error {
 	return nil
 }
 
-func (c *Controller) halt(db *api.PerconaXtraDB) error {
+// checkRestoreTimeout raises a RestoreTimedOut condition and a warning event
+// once the initial restore has been pending longer than the window from
+// spec.init. The operator keeps waiting either way, so a restore that
+// eventually succeeds is still picked up.
+func (c *Controller) checkRestoreTimeout(px *api.PerconaXtraDB) error {
+	timeout := px.InitialRestoreTimeout()
+	if timeout == 0 || time.Since(px.CreationTimestamp.Time) < timeout {
+		return nil
+	}
+	log.Warningf("Initial restore of PerconaXtraDB %v/%v did not complete within %v. Check the restore session of the external initializer, or remove 'spec.init.waitForInitialRestore' to provision without the restored data",
+		px.Namespace, px.Name, timeout)
+	if kmapi.HasCondition(px.Status.Conditions, api.DatabaseRestoreTimedOut) {
+		return nil
+	}
+
+	c.Recorder.Eventf(
+		px,
+		core.EventTypeWarning,
+		api.DatabaseRestoreTimedOut,
+		"Initial restore of PerconaXtraDB %v/%v did not complete within %v",
+		px.Namespace, px.Name, timeout,
+	)
+	per, err := util.UpdatePerconaXtraDBStatus(context.TODO(), c.DBClient.KubedbV1alpha2(), px.ObjectMeta, func(in *api.PerconaXtraDBStatus) *api.PerconaXtraDBStatus {
+		in.Conditions = kmapi.SetCondition(in.Conditions, kmapi.NewCondition(api.DatabaseRestoreTimedOut,
+			fmt.Sprintf("The DataRestored condition did not become true within %v", timeout), px.Generation))
+		return in
+	}, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+	px.Status = per.Status
+	return nil
+}
+
+func (c *Controller) halt(db *api.PerconaXtraDB) (err error) {
+	start := time.Now()
+	defer func() {
+		observeReconcile(db, start, err)
+	}()
+
+	trace := newReconcileTracer(db)
+
 	if db.Spec.Halted && db.Spec.TerminationPolicy != api.TerminationPolicyHalt {
 		return errors.New("can't halt db. 'spec.terminationPolicy' is not 'Halt'")
 	}
@@ -194,6 +349,7 @@ func (c *Controller) halt(db *api.PerconaXtraDB) error {
 	if err := c.haltDatabase(db); err != nil {
 		return err
 	}
+	trace.Tracef("workloads deleted, waiting for pods to terminate")
 	if err := c.waitUntilPaused(db); err != nil {
 		return err
 	}
@@ -208,20 +364,40 @@ func (c *Controller) halt(db *api.PerconaXtraDB) error {
 	return nil
 }
 
-func (c *Controller) terminate(px *api.PerconaXtraDB) error {
-	// If TerminationPolicy is "halt", keep PVCs and Secrets intact.
-	// TerminationPolicyPause is deprecated and will be removed in future.
-	if px.Spec.TerminationPolicy == api.TerminationPolicyHalt {
+func (c *Controller) terminate(px *api.PerconaXtraDB) (err error) {
+	start := time.Now()
+	defer func() {
+		observeReconcile(px, start, err)
+	}()
+
+	trace := newReconcileTracer(px)
+	trace.Tracef("terminating with policy %v", px.Spec.TerminationPolicy)
+
+	// the operator-created BackupConfiguration follows the database for every
+	// termination policy; a halted database must not keep scheduling backups
+	if err := c.deleteBackupConfiguration(px); err != nil {
+		return err
+	}
+
+	if keepPVCs, _ := terminationRetention(px.Spec.TerminationPolicy); keepPVCs {
+		// "Halt" keeps the PVCs and secrets intact for a later restart
 		if err := c.removeOwnerReferenceFromOffshoots(px); err != nil {
 			return err
 		}
 	} else {
-		// If TerminationPolicy is "wipeOut", delete everything (ie, PVCs,Secrets,Snapshots).
-		// If TerminationPolicy is "delete", delete PVCs and keep snapshots,secrets intact.
-		// In both these cases, don't create dormantdatabase
+		// "Delete" and "WipeOut" let the PVCs follow the database; whether the
+		// secrets follow too is decided in setOwnerReferenceToOffshoots
 		if err := c.setOwnerReferenceToOffshoots(px); err != nil {
 			return err
 		}
+		// a fast delete can leave Stash sessions and their temporary
+		// resources behind; wait for them to be cleaned up before the
+		// finalizer is removed
+		if px.Spec.TerminationPolicy == api.TerminationPolicyWipeOut {
+			if err := c.cleanupStashResources(px); err != nil {
+				return err
+			}
+		}
 	}
 
 	if px.Spec.Monitor != nil {
@@ -233,13 +409,30 @@ func (c *Controller) terminate(px *api.PerconaXtraDB) error {
 	return nil
 }
 
+// terminationRetention reports which offshoot resources survive the given
+// termination policy: Halt keeps both the PVCs and the secrets, Delete removes
+// the PVCs but keeps the secrets, and WipeOut removes both.
+func terminationRetention(policy api.TerminationPolicy) (keepPVCs, keepSecrets bool) {
+	switch policy {
+	case api.TerminationPolicyHalt:
+		return true, true
+	case api.TerminationPolicyWipeOut:
+		return false, false
+	default:
+		return false, true
+	}
+}
+
 func (c *Controller) setOwnerReferenceToOffshoots(px *api.PerconaXtraDB) error {
 	owner := metav1.NewControllerRef(px, api.SchemeGroupVersion.WithKind(api.ResourceKindPerconaXtraDB))
 	selector := labels.SelectorFromSet(px.OffshootSelectors())
 
-	// If TerminationPolicy is "wipeOut", delete snapshots and secrets,
-	// else, keep it intact.
-	if px.Spec.TerminationPolicy == api.TerminationPolicyWipeOut {
+	if _, keepSecrets := terminationRetention(px.Spec.TerminationPolicy); !keepSecrets {
+		if px.Spec.BackupBeforeDeletion {
+			if err := c.ensureFinalBackup(px); err != nil {
+				return err
+			}
+		}
 		if err := c.wipeOutDatabase(px.ObjectMeta, px.Spec.GetPersistentSecrets(), owner); err != nil {
 			return errors.Wrap(err, "error in wiping out database.")
 		}
@@ -255,6 +448,10 @@ func (c *Controller) setOwnerReferenceToOffshoots(px *api.PerconaXtraDB) error {
 			return err
 		}
 	}
+	// ephemeral storage never spawns PVCs, so there is nothing to adopt
+	if px.Spec.StorageType == api.StorageTypeEphemeral {
+		return nil
+	}
 	// delete PVC for both "wipeOut" and "delete" TerminationPolicy.
 	return dynamic_util.EnsureOwnerReferenceForSelector(
 		context.TODO(),
@@ -0,0 +1,42 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+)
+
+func TestTerminationRetention(t *testing.T) {
+	cases := []struct {
+		policy      api.TerminationPolicy
+		keepPVCs    bool
+		keepSecrets bool
+	}{
+		{api.TerminationPolicyHalt, true, true},
+		{api.TerminationPolicyDelete, false, true},
+		{api.TerminationPolicyWipeOut, false, false},
+	}
+	for _, c := range cases {
+		keepPVCs, keepSecrets := terminationRetention(c.policy)
+		if keepPVCs != c.keepPVCs || keepSecrets != c.keepSecrets {
+			t.Errorf("terminationRetention(%q) = (%v, %v), want (%v, %v)",
+				c.policy, keepPVCs, keepSecrets, c.keepPVCs, c.keepSecrets)
+		}
+	}
+}
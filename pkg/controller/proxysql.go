@@ -0,0 +1,177 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	kutil "kmodules.xyz/client-go"
+	core_util "kmodules.xyz/client-go/core/v1"
+)
+
+const proxysqlConfigFileName = "proxysql.cnf"
+
+// writer and reader hostgroups the sidecar routes statements to
+const (
+	proxysqlWriterHostgroup = 10
+	proxysqlReaderHostgroup = 20
+)
+
+// proxySQLConfigName returns the name of the ConfigMap holding the generated
+// ProxySQL configuration.
+func (c *Controller) proxySQLConfigName(px *api.PerconaXtraDB) string {
+	return px.OffshootName() + "-proxysql-config"
+}
+
+// ensureProxySQLConfig reconciles the generated ProxySQL configuration. Writes
+// go to the primary service, reads to the read service, so the routing follows
+// the role labels the operator keeps on the pods.
+func (c *Controller) ensureProxySQLConfig(px *api.PerconaXtraDB) error {
+	authSecret, err := c.Client.CoreV1().Secrets(px.Namespace).Get(context.TODO(), px.GetDatabaseSecretName(), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	monitorSecret, err := c.Client.CoreV1().Secrets(px.Namespace).Get(context.TODO(), px.ProxySQLSecretName(), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	readHost := px.ServiceName()
+	if px.IsCluster() {
+		readHost = px.ReadServiceName()
+	}
+
+	config := fmt.Sprintf(`datadir="/var/lib/proxysql"
+admin_variables=
+{
+    mysql_ifaces="127.0.0.1:%d"
+}
+mysql_variables=
+{
+    interfaces="0.0.0.0:%d"
+    monitor_username="%s"
+    monitor_password="%s"
+}
+mysql_servers=
+(
+    { address="%s", port=%d, hostgroup=%d },
+    { address="%s", port=%d, hostgroup=%d }
+)
+mysql_users=
+(
+    { username="%s", password="%s", default_hostgroup=%d, active=1 }
+)
+mysql_query_rules=
+(
+    { rule_id=1, active=1, match_digest="^SELECT.*FOR UPDATE", destination_hostgroup=%d, apply=1 },
+    { rule_id=2, active=1, match_digest="^SELECT", destination_hostgroup=%d, apply=1 }
+)
+`,
+		api.ProxySQLAdminPort,
+		api.ProxySQLMySQLNodePort,
+		monitorSecret.Data[core.BasicAuthUsernameKey],
+		monitorSecret.Data[core.BasicAuthPasswordKey],
+		px.ServiceName(), px.SQLPort(), proxysqlWriterHostgroup,
+		readHost, px.SQLPort(), proxysqlReaderHostgroup,
+		authSecret.Data[core.BasicAuthUsernameKey],
+		authSecret.Data[core.BasicAuthPasswordKey],
+		proxysqlWriterHostgroup,
+		proxysqlWriterHostgroup,
+		proxysqlReaderHostgroup,
+	)
+
+	owner := metav1.NewControllerRef(px, api.SchemeGroupVersion.WithKind(api.ResourceKindPerconaXtraDB))
+	meta := metav1.ObjectMeta{
+		Name:      c.proxySQLConfigName(px),
+		Namespace: px.Namespace,
+	}
+	_, _, err = core_util.CreateOrPatchConfigMap(context.TODO(), c.Client, meta, func(in *core.ConfigMap) *core.ConfigMap {
+		core_util.EnsureOwnerReference(&in.ObjectMeta, owner)
+		in.Labels = px.OffshootLabels()
+		in.Data = map[string]string{
+			proxysqlConfigFileName: config,
+		}
+		return in
+	}, metav1.PatchOptions{})
+	return err
+}
+
+// proxySQLContainer returns the sidecar container routing client connections.
+func (c *Controller) proxySQLContainer(px *api.PerconaXtraDB) *core.Container {
+	return &core.Container{
+		Name:            "proxysql",
+		Image:           px.Spec.ProxySQL.Image,
+		ImagePullPolicy: core.PullIfNotPresent,
+		Args: []string{
+			"-f",
+			"-c", "/etc/proxysql/" + proxysqlConfigFileName,
+		},
+		Ports: []core.ContainerPort{
+			{
+				Name:          "sql",
+				ContainerPort: api.ProxySQLMySQLNodePort,
+				Protocol:      core.ProtocolTCP,
+			},
+			{
+				Name:          api.ProxySQLAdminPortName,
+				ContainerPort: api.ProxySQLAdminPort,
+				Protocol:      core.ProtocolTCP,
+			},
+		},
+		VolumeMounts: []core.VolumeMount{
+			{
+				Name:      "proxysql-config",
+				MountPath: "/etc/proxysql",
+			},
+		},
+		Resources: px.Spec.ProxySQL.Resources,
+	}
+}
+
+// createProxySQLService creates the service clients use to reach the ProxySQL
+// sidecars.
+func (c *Controller) createProxySQLService(px *api.PerconaXtraDB) (kutil.VerbType, error) {
+	meta := metav1.ObjectMeta{
+		Name:      px.ProxySQLServiceName(),
+		Namespace: px.Namespace,
+	}
+
+	owner := metav1.NewControllerRef(px, api.SchemeGroupVersion.WithKind(api.ResourceKindPerconaXtraDB))
+
+	_, ok, err := core_util.CreateOrPatchService(context.TODO(), c.Client, meta, func(in *core.Service) *core.Service {
+		core_util.EnsureOwnerReference(&in.ObjectMeta, owner)
+		in.Labels = px.OffshootLabels()
+
+		in.Spec.Selector = px.OffshootSelectors()
+		in.Spec.Ports = core_util.MergeServicePorts(in.Spec.Ports, []core.ServicePort{
+			{
+				Name:       "sql",
+				Protocol:   core.ProtocolTCP,
+				Port:       api.ProxySQLMySQLNodePort,
+				TargetPort: intstr.FromInt(api.ProxySQLMySQLNodePort),
+			},
+		})
+		return in
+	}, metav1.PatchOptions{})
+	return ok, err
+}
@@ -18,6 +18,7 @@ package controller
 
 import (
 	"context"
+	"fmt"
 
 	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
 
@@ -44,6 +45,11 @@ func (c *Controller) createServiceAccount(db *api.PerconaXtraDB, saName string)
 		func(in *core.ServiceAccount) *core.ServiceAccount {
 			core_util.EnsureOwnerReference(&in.ObjectMeta, owner)
 			in.Labels = db.OffshootLabels()
+			// the pull secrets also live on the ServiceAccount, so sidecar and
+			// exporter images from a private registry pull as well
+			for _, ref := range db.Spec.PodTemplate.Spec.ImagePullSecrets {
+				in.ImagePullSecrets = upsertImagePullSecret(in.ImagePullSecrets, ref)
+			}
 			return in
 		},
 		metav1.PatchOptions{},
@@ -51,6 +57,15 @@ func (c *Controller) createServiceAccount(db *api.PerconaXtraDB, saName string)
 	return err
 }
 
+func upsertImagePullSecret(refs []core.LocalObjectReference, ref core.LocalObjectReference) []core.LocalObjectReference {
+	for _, existing := range refs {
+		if existing.Name == ref.Name {
+			return refs
+		}
+	}
+	return append(refs, ref)
+}
+
 func (c *Controller) ensureRole(db *api.PerconaXtraDB, name string, pspName string) error {
 	owner := metav1.NewControllerRef(db, api.SchemeGroupVersion.WithKind(api.ResourceKindPerconaXtraDB))
 
@@ -75,6 +90,14 @@ func (c *Controller) ensureRole(db *api.PerconaXtraDB, name string, pspName stri
 				}
 				in.Rules = append(in.Rules, pspRule)
 			}
+			// the coordinator sidecar labels its own pod as primary/replica
+			if db.Spec.Coordinator != nil {
+				in.Rules = append(in.Rules, rbac.PolicyRule{
+					APIGroups: []string{core.GroupName},
+					Resources: []string{"pods"},
+					Verbs:     []string{"get", "patch"},
+				})
+			}
 			return in
 		},
 		metav1.PatchOptions{},
@@ -82,7 +105,7 @@ func (c *Controller) ensureRole(db *api.PerconaXtraDB, name string, pspName stri
 	return err
 }
 
-func (c *Controller) createRoleBinding(db *api.PerconaXtraDB, name string) error {
+func (c *Controller) createRoleBinding(db *api.PerconaXtraDB, name, saName string) error {
 	owner := metav1.NewControllerRef(db, api.SchemeGroupVersion.WithKind(api.ResourceKindPerconaXtraDB))
 
 	// Ensure new RoleBindings for ElasticSearch and it's Snapshot
@@ -104,7 +127,7 @@ func (c *Controller) createRoleBinding(db *api.PerconaXtraDB, name string) error
 			in.Subjects = []rbac.Subject{
 				{
 					Kind:      rbac.ServiceAccountKind,
-					Name:      name,
+					Name:      saName,
 					Namespace: db.Namespace,
 				},
 			}
@@ -131,9 +154,23 @@ func (c *Controller) ensureRBACStuff(px *api.PerconaXtraDB) error {
 		return err
 	}
 
-	// Create New ServiceAccount
-	if err := c.createServiceAccount(px, px.OffshootName()); err != nil {
-		if !kerr.IsAlreadyExists(err) {
+	// a ServiceAccount named in spec.podTemplate.spec.serviceAccountName is
+	// pre-created by the user, e.g. with workload identity bindings the
+	// operator must not touch; it only has to exist. Otherwise the operator
+	// creates and owns the account.
+	saName := px.Spec.PodTemplate.Spec.ServiceAccountName
+	if saName == "" || saName == px.OffshootName() {
+		saName = px.OffshootName()
+		if err := c.createServiceAccount(px, saName); err != nil {
+			if !kerr.IsAlreadyExists(err) {
+				return err
+			}
+		}
+	} else {
+		if _, err := c.Client.CoreV1().ServiceAccounts(px.Namespace).Get(context.TODO(), saName, metav1.GetOptions{}); err != nil {
+			if kerr.IsNotFound(err) {
+				return fmt.Errorf(`service account "%v/%v" referenced in 'spec.podTemplate.spec.serviceAccountName' not found`, px.Namespace, saName)
+			}
 			return err
 		}
 	}
@@ -144,7 +181,7 @@ func (c *Controller) ensureRBACStuff(px *api.PerconaXtraDB) error {
 	}
 
 	// Create New RoleBinding
-	if err := c.createRoleBinding(px, px.OffshootName()); err != nil {
+	if err := c.createRoleBinding(px, px.OffshootName(), saName); err != nil {
 		return err
 	}
 
@@ -0,0 +1,105 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+	"kubedb.dev/apimachinery/client/clientset/versioned/typed/kubedb/v1alpha2/util"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	kmapi "kmodules.xyz/client-go/api/v1"
+)
+
+// enforceReadOnlyMode reconciles spec.readOnly against the running nodes:
+// every reachable node gets read_only/super_read_only set accordingly, so the
+// database keeps serving reads during maintenance while write clients are
+// rejected by the server. The mode transition is reflected in the ReadOnly
+// condition and recorded as an event. Applying the variables is idempotent and
+// repeated on every pass, so nodes restarted in between are caught up.
+func (c *Controller) enforceReadOnlyMode(px *api.PerconaXtraDB) error {
+	pods, err := c.Client.CoreV1().Pods(px.Namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(px.OffshootSelectors()).String(),
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Status.PodIP == "" {
+			continue
+		}
+		if err := c.setReadOnly(px, pod.Status.PodIP, px.Spec.ReadOnly); err != nil {
+			return fmt.Errorf("failed to apply read-only mode %v to pod %v/%v: %v", px.Spec.ReadOnly, pod.Namespace, pod.Name, err)
+		}
+	}
+
+	if kmapi.IsConditionTrue(px.Status.Conditions, api.DatabaseReadOnly) == px.Spec.ReadOnly {
+		return nil
+	}
+
+	msg := "All nodes accept writes again"
+	reason := "ReadOnlyDisabled"
+	if px.Spec.ReadOnly {
+		msg = "All nodes are in read-only mode as requested by 'spec.readOnly'"
+		reason = "ReadOnlyEnabled"
+	}
+	c.Recorder.Event(px, core.EventTypeNormal, reason, msg)
+
+	per, err := util.UpdatePerconaXtraDBStatus(context.TODO(), c.DBClient.KubedbV1alpha2(), px.ObjectMeta, func(in *api.PerconaXtraDBStatus) *api.PerconaXtraDBStatus {
+		in.Conditions = kmapi.SetCondition(in.Conditions, kmapi.NewCondition(api.DatabaseReadOnly, msg, px.Generation, px.Spec.ReadOnly))
+		return in
+	}, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+	px.Status = per.Status
+	return nil
+}
+
+// setReadOnly applies the read-only mode on a single node. super_read_only
+// also shields the data from users with the SUPER privilege; it is lifted
+// first on the way back, since disabling read_only alone would not clear it.
+func (c *Controller) setReadOnly(px *api.PerconaXtraDB, podIP string, readOnly bool) error {
+	en, err := c.connectToPod(px, podIP)
+	if err != nil {
+		return err
+	}
+	defer en.Close()
+
+	stmts := []string{
+		"SET GLOBAL super_read_only = 0",
+		"SET GLOBAL read_only = 0",
+	}
+	if readOnly {
+		stmts = []string{
+			"SET GLOBAL read_only = 1",
+			"SET GLOBAL super_read_only = 1",
+		}
+	}
+	for _, stmt := range stmts {
+		if _, err := en.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+)
+
+// RenderedConfig is one generated my.cnf snippet the operator would mount
+// into the database pods, together with where its values come from.
+type RenderedConfig struct {
+	// FileName is the name the snippet is mounted under in the custom config
+	// directory.
+	FileName string
+	// Source states whether the values are operator defaults or derived from
+	// user input, and from which spec fields.
+	Source string
+	// Content is the rendered my.cnf fragment.
+	Content string
+}
+
+// RenderConfig renders every my.cnf snippet the reconcile loop would generate
+// for the given spec, in mount order, without touching a cluster. The spec is
+// expected to be defaulted already. Values that only exist at runtime, like
+// pod IPs and the generated SST credentials, are rendered as the fallbacks or
+// placeholders the reconcile loop starts from.
+func RenderConfig(px *api.PerconaXtraDB) []RenderedConfig {
+	var out []RenderedConfig
+
+	if px.IsCluster() && !px.UsesAsyncReplication() && px.Spec.TLS != nil && px.Spec.TLS.IssuerRef != nil {
+		out = append(out, RenderedConfig{
+			FileName: replicationTLSConfigFileName,
+			Source:   "operator default certificate paths for 'spec.tls'; wsrep_provider_options merges user input from 'spec.wsrepProviderOptions' and 'spec.replicationPort'",
+			Content:  replicationTLSConfig(px),
+		})
+	}
+
+	if px.Spec.AutoTuneBufferPool != nil {
+		if size := computeBufferPoolSize(px); size > 0 {
+			out = append(out, RenderedConfig{
+				FileName: autoTuneConfigFileName,
+				Source:   "derived from the container memory limit and 'spec.autoTuneBufferPool'",
+				Content:  autoTuneConfig(size),
+			})
+		}
+	}
+
+	if seconds := px.BinlogExpireSeconds(); seconds > 0 {
+		out = append(out, RenderedConfig{
+			FileName: binlogConfigFileName,
+			Source:   "user input from 'spec.binlogRetention'",
+			Content:  binlogConfig(px, seconds),
+		})
+	}
+
+	if limit := computeMaxConnections(px); limit > 0 {
+		source := "user input from 'spec.maxConnections.value'"
+		if px.Spec.MaxConnections.Value == nil {
+			source = "derived from the container memory limit and 'spec.maxConnections.auto'"
+		}
+		out = append(out, RenderedConfig{
+			FileName: maxConnectionsConfigFileName,
+			Source:   source,
+			Content:  maxConnectionsConfig(limit),
+		})
+	}
+
+	if px.Spec.AuditLog != nil {
+		out = append(out, RenderedConfig{
+			FileName: auditConfigFileName,
+			Source:   "operator defaults for 'spec.auditLog'; the record format is user input",
+			Content:  auditConfig(px),
+		})
+	}
+
+	if px.IsCluster() && galeraProviderOptions(px) != "" {
+		if !(px.Spec.TLS != nil && px.Spec.TLS.IssuerRef != nil) {
+			out = append(out, RenderedConfig{
+				FileName: wsrepConfigFileName,
+				Source:   "user input from 'spec.wsrepProviderOptions' and 'spec.replicationPort'",
+				Content:  wsrepConfig(px),
+			})
+		}
+	}
+
+	if px.IsCluster() && px.Spec.SSTMethod != "" {
+		out = append(out, RenderedConfig{
+			FileName: sstConfigFileName,
+			Source:   "user input from 'spec.sstMethod'; the SST credentials are generated at runtime",
+			Content:  sstConfig(px, "<"+sstUsernameKey+">", "<"+sstPasswordKey+">"),
+		})
+	}
+
+	if px.UsesAsyncReplication() {
+		out = append(out, RenderedConfig{
+			FileName: asyncReplicationConfigFileName,
+			Source:   "operator defaults for 'spec.replicationMode: asyncSourceReplica'; the per-node server_id is set at runtime",
+			Content:  asyncReplicationConfig(),
+		})
+	}
+
+	if usesPodIPAddressStrategy(px) {
+		out = append(out, RenderedConfig{
+			FileName: clusterAddressConfigFileName,
+			Source:   "derived from 'spec.clusterAddressStrategy: PodIP'; pod IPs replace the DNS names at runtime",
+			Content:  clusterAddressConfig(peerGcommAddress(px)),
+		})
+	}
+
+	return out
+}
@@ -0,0 +1,186 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+	"kubedb.dev/apimachinery/client/clientset/versioned/typed/kubedb/v1alpha2/util"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	kmapi "kmodules.xyz/client-go/api/v1"
+)
+
+// checkReplicationLag compares the GTID executed set of every replica pod
+// against the primary and reports whether all replicas are within
+// spec.healthChecker.maxReplicationLag transactions. The measured lag is
+// exposed through the ReplicationLag condition: it turns true while at least
+// one replica exceeds the threshold. Without a threshold, or for standalone
+// servers, the check is a no-op.
+func (c *Controller) checkReplicationLag(px *api.PerconaXtraDB) (bool, error) {
+	threshold := px.MaxReplicationLag()
+	if threshold == 0 || !px.IsCluster() {
+		return true, nil
+	}
+
+	pods, err := c.Client.CoreV1().Pods(px.Namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(px.OffshootSelectors()).String(),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	// the failover checker moves the primary role label between pods; fall
+	// back to the first ordinal only while no pod carries the role yet
+	primaryName := px.OffshootName() + "-0"
+	for i := range pods.Items {
+		if pods.Items[i].Labels[api.LabelRole] == api.RolePrimary {
+			primaryName = pods.Items[i].Name
+			break
+		}
+	}
+	var primaryIP string
+	for i := range pods.Items {
+		if pods.Items[i].Name == primaryName {
+			primaryIP = pods.Items[i].Status.PodIP
+		}
+	}
+	if primaryIP == "" {
+		return false, markTransient(fmt.Errorf("primary pod %v/%v is not running", px.Namespace, primaryName))
+	}
+
+	primarySet, err := c.podGTIDExecuted(px, primaryIP)
+	if err != nil {
+		return false, markTransient(err)
+	}
+
+	var maxLag int64
+	var report []string
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Name == primaryName || pod.Status.PodIP == "" {
+			continue
+		}
+		missing, err := c.replicaMissingGTIDs(px, pod.Status.PodIP, primarySet)
+		if err != nil {
+			report = append(report, fmt.Sprintf("%s: unreachable", pod.Name))
+			continue
+		}
+		lag, err := gtidSetSize(missing)
+		if err != nil {
+			return false, err
+		}
+		if lag > maxLag {
+			maxLag = lag
+		}
+		report = append(report, fmt.Sprintf("%s: %d transactions behind", pod.Name, lag))
+	}
+
+	within := maxLag <= threshold
+	msg := fmt.Sprintf("Replication lag is %d of at most %d transactions. %s", maxLag, threshold, strings.Join(report, "; "))
+	per, err := util.UpdatePerconaXtraDBStatus(context.TODO(), c.DBClient.KubedbV1alpha2(), px.ObjectMeta, func(in *api.PerconaXtraDBStatus) *api.PerconaXtraDBStatus {
+		in.Conditions = kmapi.SetCondition(in.Conditions, kmapi.NewCondition(api.DatabaseReplicationLag, msg, px.Generation, !within))
+		return in
+	}, metav1.UpdateOptions{})
+	if err != nil {
+		return false, err
+	}
+	px.Status = per.Status
+	return within, nil
+}
+
+// podGTIDExecuted returns the GTID executed set of a single node.
+func (c *Controller) podGTIDExecuted(px *api.PerconaXtraDB, podIP string) (string, error) {
+	en, err := c.connectToPod(px, podIP)
+	if err != nil {
+		return "", err
+	}
+	defer en.Close()
+
+	var set string
+	if err := en.QueryRow(`SELECT @@global.gtid_executed`).Scan(&set); err != nil {
+		return "", err
+	}
+	return set, nil
+}
+
+// replicaMissingGTIDs asks a replica which part of the primary's GTID executed
+// set it has not applied yet.
+func (c *Controller) replicaMissingGTIDs(px *api.PerconaXtraDB, podIP, primarySet string) (string, error) {
+	en, err := c.connectToPod(px, podIP)
+	if err != nil {
+		return "", err
+	}
+	defer en.Close()
+
+	var missing string
+	if err := en.QueryRow(`SELECT GTID_SUBTRACT(?, @@global.gtid_executed)`, primarySet).Scan(&missing); err != nil {
+		return "", err
+	}
+	return missing, nil
+}
+
+func (c *Controller) connectToPod(px *api.PerconaXtraDB, podIP string) (*sql.DB, error) {
+	secret, err := c.Client.CoreV1().Secrets(px.Namespace).Get(context.TODO(), px.GetDatabaseSecretName(), metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return sql.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s:%d)/%s",
+		string(secret.Data[core.BasicAuthUsernameKey]),
+		string(secret.Data[core.BasicAuthPasswordKey]),
+		podIP, px.SQLPort(),
+		c.healthCheckDSNParams(px)))
+}
+
+// gtidSetSize counts the transactions in a GTID set like
+// "uuid:1-5:7,uuid2:1-3". An empty set counts zero.
+func gtidSetSize(set string) (int64, error) {
+	set = strings.TrimSpace(set)
+	if set == "" {
+		return 0, nil
+	}
+	var size int64
+	for _, entry := range strings.Split(set, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), ":")
+		if len(parts) < 2 {
+			return 0, fmt.Errorf("invalid GTID set entry %q", entry)
+		}
+		for _, interval := range parts[1:] {
+			bounds := strings.SplitN(interval, "-", 2)
+			from, err := strconv.ParseInt(bounds[0], 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid GTID interval %q", interval)
+			}
+			to := from
+			if len(bounds) == 2 {
+				to, err = strconv.ParseInt(bounds[1], 10, 64)
+				if err != nil {
+					return 0, fmt.Errorf("invalid GTID interval %q", interval)
+				}
+			}
+			size += to - from + 1
+		}
+	}
+	return size, nil
+}
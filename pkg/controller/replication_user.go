@@ -0,0 +1,135 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+
+	"github.com/pkg/errors"
+	passgen "gomodules.xyz/password-generator"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	core_util "kmodules.xyz/client-go/core/v1"
+)
+
+// replicationUsername is the database user the replicas of an async
+// source-replica cluster authenticate with, instead of the root credentials.
+const replicationUsername = "repl"
+
+// replicationUserSecretName returns the generated secret holding the
+// replication user credentials.
+func replicationUserSecretName(px *api.PerconaXtraDB) string {
+	return px.OffshootName() + "-replication"
+}
+
+// ensureReplicationUserSecret generates the credentials of the dedicated
+// replication user of an async source-replica cluster.
+func (c *Controller) ensureReplicationUserSecret(px *api.PerconaXtraDB) error {
+	if !px.UsesAsyncReplication() {
+		return nil
+	}
+
+	secretName := replicationUserSecretName(px)
+	sc, err := c.checkSecret(secretName, px)
+	if err != nil {
+		return err
+	}
+	if sc == nil {
+		secret := &core.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   secretName,
+				Labels: px.OffshootLabels(),
+			},
+			Type: core.SecretTypeOpaque,
+			StringData: map[string]string{
+				core.BasicAuthUsernameKey: replicationUsername,
+				core.BasicAuthPasswordKey: passgen.Generate(api.DefaultPasswordLength),
+			},
+		}
+
+		if _, err := c.Client.CoreV1().Secrets(px.Namespace).Create(context.TODO(), secret, metav1.CreateOptions{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncReplicationUser provisions the replication user on the source with the
+// REPLICATION SLAVE grant the replicas need, keeping the password in sync with
+// the generated secret.
+func (c *Controller) syncReplicationUser(px *api.PerconaXtraDB) error {
+	if !px.UsesAsyncReplication() {
+		return nil
+	}
+
+	secret, err := c.Client.CoreV1().Secrets(px.Namespace).Get(context.TODO(), replicationUserSecretName(px), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	password := string(secret.Data[core.BasicAuthPasswordKey])
+	if password == "" {
+		return errors.Errorf(`secret "%v/%v" is missing key %q`, px.Namespace, secret.Name, core.BasicAuthPasswordKey)
+	}
+
+	en, err := c.connectToPrimary(px)
+	if err != nil {
+		return err
+	}
+	defer en.Close()
+
+	if _, err := en.Exec(fmt.Sprintf("CREATE USER IF NOT EXISTS '%s'@'%%' IDENTIFIED BY %s", replicationUsername, quoteStringLiteral(password))); err != nil {
+		return errors.Wrapf(err, "failed to create user %q", replicationUsername)
+	}
+	// keep the password in sync if the generated secret has been rotated
+	if _, err := en.Exec(fmt.Sprintf("ALTER USER '%s'@'%%' IDENTIFIED BY %s", replicationUsername, quoteStringLiteral(password))); err != nil {
+		return errors.Wrapf(err, "failed to update password of user %q", replicationUsername)
+	}
+	if _, err := en.Exec(fmt.Sprintf("GRANT REPLICATION SLAVE ON *.* TO '%s'@'%%'", replicationUsername)); err != nil {
+		return errors.Wrapf(err, "failed to apply grant to user %q", replicationUsername)
+	}
+	if _, err := en.Exec("FLUSH PRIVILEGES"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// replicationPasswordRotated reports whether the replication password differs
+// from the one stamped as applied, i.e. the replicas still replicate with a
+// stale credential and have to re-run CHANGE MASTER TO.
+func replicationPasswordRotated(secret *core.Secret) bool {
+	return string(secret.Data[core.BasicAuthPasswordKey]) != string(secret.Data[appliedPasswordKey])
+}
+
+// stampAppliedReplicationPassword records the replication password every
+// replica has been repointed with, so the rotation is not replayed on each
+// health check tick.
+func (c *Controller) stampAppliedReplicationPassword(px *api.PerconaXtraDB, password string) error {
+	meta := metav1.ObjectMeta{
+		Name:      replicationUserSecretName(px),
+		Namespace: px.Namespace,
+	}
+	_, _, err := core_util.CreateOrPatchSecret(context.TODO(), c.Client, meta, func(in *core.Secret) *core.Secret {
+		in.StringData = map[string]string{
+			appliedPasswordKey: password,
+		}
+		return in
+	}, metav1.PatchOptions{})
+	return err
+}
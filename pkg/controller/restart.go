@@ -0,0 +1,81 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+	"kubedb.dev/apimachinery/client/clientset/versioned/typed/kubedb/v1alpha2/util"
+
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kmapi "kmodules.xyz/client-go/api/v1"
+)
+
+// isRestartPending reports whether the user has bumped the restart annotation
+// on the database object since the StatefulSet pod template last picked it up.
+// Changing the annotation value, i.e. incrementing a counter or writing a
+// timestamp, requests one rolling restart.
+func (c *Controller) isRestartPending(px *api.PerconaXtraDB) (bool, error) {
+	requested := px.Annotations[api.PerconaXtraDBRestartAnnotation]
+	if requested == "" {
+		return false, nil
+	}
+	sts, err := c.Client.AppsV1().StatefulSets(px.Namespace).Get(context.TODO(), px.OffshootName(), metav1.GetOptions{})
+	if err != nil {
+		if kerr.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return sts.Spec.Template.Annotations[api.PerconaXtraDBRestartAnnotation] != requested, nil
+}
+
+// prepareRestart stamps the requested restart value on the pod template, so the
+// StatefulSet rolls the pods one at a time. The readiness probe keeps a cluster
+// node out of rotation until it has rejoined and synced with the group, so the
+// rolling update never takes down more than one member at a time.
+func (c *Controller) prepareRestart(px *api.PerconaXtraDB) error {
+	if px.Spec.PodTemplate.Annotations == nil {
+		px.Spec.PodTemplate.Annotations = map[string]string{}
+	}
+	px.Spec.PodTemplate.Annotations[api.PerconaXtraDBRestartAnnotation] = px.Annotations[api.PerconaXtraDBRestartAnnotation]
+
+	per, err := util.UpdatePerconaXtraDBStatus(context.TODO(), c.DBClient.KubedbV1alpha2(), px.ObjectMeta, func(in *api.PerconaXtraDBStatus) *api.PerconaXtraDBStatus {
+		in.Conditions = kmapi.SetCondition(in.Conditions, kmapi.NewCondition(api.DatabaseRestarting, "Database pods are being restarted on user request", px.Generation))
+		return in
+	}, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+	px.Status = per.Status
+	return nil
+}
+
+// finishRestart drops the Restarting condition once all pods run again.
+func (c *Controller) finishRestart(px *api.PerconaXtraDB) error {
+	per, err := util.UpdatePerconaXtraDBStatus(context.TODO(), c.DBClient.KubedbV1alpha2(), px.ObjectMeta, func(in *api.PerconaXtraDBStatus) *api.PerconaXtraDBStatus {
+		in.Conditions = kmapi.RemoveCondition(in.Conditions, api.DatabaseRestarting)
+		return in
+	}, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+	px.Status = per.Status
+	return nil
+}
@@ -0,0 +1,125 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+	"kubedb.dev/apimachinery/client/clientset/versioned/typed/kubedb/v1alpha2/util"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	kmapi "kmodules.xyz/client-go/api/v1"
+)
+
+// syncUnschedulableCondition surfaces pods that the scheduler cannot place as
+// an Unschedulable condition on the database, so a request no node can satisfy
+// does not just look like a database that never becomes ready. The scheduler's
+// own message is carried over, and when the requests exceed the largest node
+// allocatable, that likely cause is spelled out. The condition is dropped
+// again once every pod has been scheduled.
+func (c *Controller) syncUnschedulableCondition(px *api.PerconaXtraDB) error {
+	pods, err := c.Client.CoreV1().Pods(px.Namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(px.OffshootSelectors()).String(),
+	})
+	if err != nil {
+		return err
+	}
+
+	var stuck []string
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Status.Phase != core.PodPending {
+			continue
+		}
+		for _, cond := range pod.Status.Conditions {
+			if cond.Type != core.PodScheduled || cond.Status != core.ConditionFalse || cond.Reason != core.PodReasonUnschedulable {
+				continue
+			}
+			msg := cond.Message
+			if hint := c.capacityHint(px); hint != "" {
+				msg = msg + "; " + hint
+			}
+			stuck = append(stuck, fmt.Sprintf("pod %s: %s", pod.Name, msg))
+		}
+	}
+
+	if len(stuck) == 0 {
+		if !kmapi.HasCondition(px.Status.Conditions, api.DatabaseUnschedulable) {
+			return nil
+		}
+		per, err := util.UpdatePerconaXtraDBStatus(context.TODO(), c.DBClient.KubedbV1alpha2(), px.ObjectMeta, func(in *api.PerconaXtraDBStatus) *api.PerconaXtraDBStatus {
+			in.Conditions = kmapi.RemoveCondition(in.Conditions, api.DatabaseUnschedulable)
+			return in
+		}, metav1.UpdateOptions{})
+		if err != nil {
+			return err
+		}
+		px.Status = per.Status
+		return nil
+	}
+
+	per, err := util.UpdatePerconaXtraDBStatus(context.TODO(), c.DBClient.KubedbV1alpha2(), px.ObjectMeta, func(in *api.PerconaXtraDBStatus) *api.PerconaXtraDBStatus {
+		in.Conditions = kmapi.SetCondition(in.Conditions, kmapi.NewCondition(
+			api.DatabaseUnschedulable,
+			strings.Join(stuck, "; "),
+			px.Generation))
+		return in
+	}, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+	px.Status = per.Status
+	return nil
+}
+
+// capacityHint compares the database container requests against the largest
+// node allocatable and spells out when no node in the cluster can ever fit
+// the pod, which a generic scheduler message does not make obvious.
+func (c *Controller) capacityHint(px *api.PerconaXtraDB) string {
+	requests := px.Spec.PodTemplate.Spec.Resources.Requests
+	if len(requests) == 0 {
+		return ""
+	}
+
+	nodes, err := c.Client.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+	if err != nil || len(nodes.Items) == 0 {
+		return ""
+	}
+
+	for _, resource := range []core.ResourceName{core.ResourceMemory, core.ResourceCPU} {
+		request, found := requests[resource]
+		if !found || request.IsZero() {
+			continue
+		}
+		largest := nodes.Items[0].Status.Allocatable[resource]
+		for _, node := range nodes.Items[1:] {
+			if alloc := node.Status.Allocatable[resource]; alloc.Cmp(largest) > 0 {
+				largest = alloc
+			}
+		}
+		if request.Cmp(largest) > 0 {
+			return fmt.Sprintf("the %s request %s exceeds the largest node allocatable %s, so no node can fit the pod; lower 'spec.podTemplate.spec.resources.requests' or add larger nodes",
+				resource, request.String(), largest.String())
+		}
+	}
+	return ""
+}
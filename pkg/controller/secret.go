@@ -18,15 +18,20 @@ package controller
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 
 	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
 	"kubedb.dev/apimachinery/client/clientset/versioned/typed/kubedb/v1alpha2/util"
 
+	"github.com/appscode/go/log"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
 	passgen "gomodules.xyz/password-generator"
 	core "k8s.io/api/core/v1"
 	kerr "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kmapi "kmodules.xyz/client-go/api/v1"
 	core_util "kmodules.xyz/client-go/core/v1"
 )
 
@@ -49,9 +54,227 @@ func (c *Controller) ensureDatabaseSecret(px *api.PerconaXtraDB) error {
 			return err
 		}
 		px.Spec.DatabaseSecret = per.Spec.DatabaseSecret
+	} else {
+		missing, err := c.syncAuthSecretMissing(px)
+		if err != nil {
+			return err
+		}
+		if missing {
+			// the running database still uses the deleted credentials;
+			// generating a replacement password would not match it, so wait
+			// for the user to restore the secret
+			return nil
+		}
+		if err := c.upgradeDatabaseSecret(px); err != nil {
+			return err
+		}
+		if err := c.rotateAuthSecret(px); err != nil {
+			return err
+		}
+	}
+
+	// the xtrabackup SST method authenticates against the donor, so it needs
+	// dedicated credentials alongside the root user
+	if px.IsCluster() && px.Spec.SSTMethod == api.PerconaXtraDBSSTMethodXtrabackupV2 {
+		return c.ensureSSTCredentials(px)
+	}
+	return nil
+}
+
+// syncAuthSecretMissing reports whether the previously recorded auth secret
+// has been deleted out from under the database. The running servers still use
+// the old password, so regenerating one would only lock the operator out for
+// good; instead an AuthSecretMissing condition and a Warning event point to
+// the recovery path: recreate the secret with the credentials still in use.
+// The condition is dropped again once the secret is back.
+func (c *Controller) syncAuthSecretMissing(px *api.PerconaXtraDB) (bool, error) {
+	_, err := c.Client.CoreV1().Secrets(px.Namespace).Get(context.TODO(), px.GetDatabaseSecretName(), metav1.GetOptions{})
+	if err == nil {
+		if !kmapi.HasCondition(px.Status.Conditions, api.DatabaseAuthSecretMissing) {
+			return false, nil
+		}
+		per, err := util.UpdatePerconaXtraDBStatus(context.TODO(), c.DBClient.KubedbV1alpha2(), px.ObjectMeta, func(in *api.PerconaXtraDBStatus) *api.PerconaXtraDBStatus {
+			in.Conditions = kmapi.RemoveCondition(in.Conditions, api.DatabaseAuthSecretMissing)
+			return in
+		}, metav1.UpdateOptions{})
+		if err != nil {
+			return false, err
+		}
+		px.Status = per.Status
+		c.Recorder.Eventf(
+			px,
+			core.EventTypeNormal,
+			"AuthSecretRestored",
+			"Auth secret %v is back; resuming reconciliation",
+			px.GetDatabaseSecretName(),
+		)
+		return false, nil
+	}
+	if !kerr.IsNotFound(err) {
+		return false, err
+	}
+
+	if !kmapi.HasCondition(px.Status.Conditions, api.DatabaseAuthSecretMissing) {
+		per, err := util.UpdatePerconaXtraDBStatus(context.TODO(), c.DBClient.KubedbV1alpha2(), px.ObjectMeta, func(in *api.PerconaXtraDBStatus) *api.PerconaXtraDBStatus {
+			in.Conditions = kmapi.SetCondition(in.Conditions, kmapi.NewCondition(
+				api.DatabaseAuthSecretMissing,
+				fmt.Sprintf("Auth secret %s has been deleted while the database still uses its credentials", px.GetDatabaseSecretName()),
+				px.Generation))
+			return in
+		}, metav1.UpdateOptions{})
+		if err != nil {
+			return false, err
+		}
+		px.Status = per.Status
+	}
+	c.Recorder.Eventf(
+		px,
+		core.EventTypeWarning,
+		"AuthSecretMissing",
+		`Auth secret %v not found, but the database still uses its credentials. Recreate the secret with the "username" and "password" keys holding the credentials in use; the operator will not generate a replacement password, since the running database would not match it`,
+		px.GetDatabaseSecretName(),
+	)
+	return true, nil
+}
+
+// appliedPasswordKey holds the password that has actually been applied to the
+// running database. It trails core.BasicAuthPasswordKey while a rotation is in
+// flight, so a failed ALTER USER never leaves the secret and the database out
+// of sync.
+const appliedPasswordKey = "password.last-applied"
+
+// rotateAuthSecret applies a changed root password from the auth secret to the
+// running database with ALTER USER. The old credentials keep working until the
+// rotation has completed, at which point the applied marker catches up and
+// dependent secrets are refreshed.
+func (c *Controller) rotateAuthSecret(px *api.PerconaXtraDB) error {
+	secret, err := c.Client.CoreV1().Secrets(px.Namespace).Get(context.TODO(), px.GetDatabaseSecretName(), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	current := string(secret.Data[core.BasicAuthPasswordKey])
+	applied := string(secret.Data[appliedPasswordKey])
+	if applied == "" {
+		// first reconcile of this secret; record the password in use without
+		// touching the database
+		return c.stampAppliedPassword(px, current)
+	}
+	if applied == current {
 		return nil
 	}
-	return c.upgradeDatabaseSecret(px)
+
+	// don't attempt the rotation before the database is running; the secret
+	// keeps both passwords until then
+	if px.Status.Phase != api.DatabasePhaseReady {
+		log.Infof("Deferring auth secret rotation of %v/%v until the database is ready", px.Namespace, px.Name)
+		return nil
+	}
+
+	username := string(secret.Data[core.BasicAuthUsernameKey])
+	en, err := c.connectWithPassword(px, username, applied)
+	if err != nil {
+		// a previous attempt may have applied the new password before the
+		// marker could be updated; verify before giving up
+		if en2, err2 := c.connectWithPassword(px, username, current); err2 == nil {
+			en2.Close()
+			return c.finishAuthSecretRotation(px, current)
+		}
+		return errors.Wrapf(err, "failed to connect to %v/%v with the applied credentials", px.Namespace, px.Name)
+	}
+	defer en.Close()
+
+	if _, err := en.Exec(fmt.Sprintf("ALTER USER '%s'@'%%' IDENTIFIED BY %s", username, quoteStringLiteral(current))); err != nil {
+		return errors.Wrapf(err, "failed to rotate password of user %q", username)
+	}
+	// the entrypoint also provisions the root user for localhost; keep it in
+	// step on a best effort basis
+	if _, err := en.Exec(fmt.Sprintf("ALTER USER IF EXISTS '%s'@'localhost' IDENTIFIED BY %s", username, quoteStringLiteral(current))); err != nil {
+		log.Errorln(err)
+	}
+	if _, err := en.Exec("FLUSH PRIVILEGES"); err != nil {
+		return err
+	}
+
+	return c.finishAuthSecretRotation(px, current)
+}
+
+// finishAuthSecretRotation refreshes the secrets derived from the auth secret
+// and records the rotation. The exporter authenticates with its own
+// monitoring user, so only generated configuration needs a refresh.
+func (c *Controller) finishAuthSecretRotation(px *api.PerconaXtraDB, password string) error {
+	if px.Spec.ProxySQL != nil {
+		if err := c.ensureProxySQLConfig(px); err != nil {
+			return err
+		}
+	}
+	if err := c.stampAppliedPassword(px, password); err != nil {
+		return err
+	}
+	c.Recorder.Event(
+		px,
+		core.EventTypeNormal,
+		"AuthSecretRotated",
+		"Successfully applied the rotated root password to the database",
+	)
+	return nil
+}
+
+func (c *Controller) stampAppliedPassword(px *api.PerconaXtraDB, password string) error {
+	meta := metav1.ObjectMeta{
+		Name:      px.GetDatabaseSecretName(),
+		Namespace: px.Namespace,
+	}
+	_, _, err := core_util.CreateOrPatchSecret(context.TODO(), c.Client, meta, func(in *core.Secret) *core.Secret {
+		in.StringData = map[string]string{
+			appliedPasswordKey: password,
+		}
+		return in
+	}, metav1.PatchOptions{})
+	return err
+}
+
+func (c *Controller) connectWithPassword(px *api.PerconaXtraDB, username, password string) (*sql.DB, error) {
+	en, err := sql.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s.%s.svc:%d)/%s",
+		username, password, px.ServiceName(), px.Namespace, px.SQLPort(),
+		c.dbDSNParams()))
+	if err != nil {
+		return nil, err
+	}
+	if err := en.Ping(); err != nil {
+		en.Close()
+		return nil, markTransientIfTimeout(err)
+	}
+	return en, nil
+}
+
+// ensureProxySQLSecret creates the credentials of the ProxySQL monitor user
+// when a built-in ProxySQL sidecar is requested.
+func (c *Controller) ensureProxySQLSecret(px *api.PerconaXtraDB) error {
+	secretName := px.ProxySQLSecretName()
+
+	sc, err := c.checkSecret(secretName, px)
+	if err != nil {
+		return err
+	}
+	if sc == nil {
+		secret := &core.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   secretName,
+				Labels: px.OffshootLabels(),
+			},
+			Type: core.SecretTypeOpaque,
+			StringData: map[string]string{
+				core.BasicAuthUsernameKey: "proxysql-monitor",
+				core.BasicAuthPasswordKey: passgen.Generate(api.DefaultPasswordLength),
+			},
+		}
+
+		if _, err := c.Client.CoreV1().Secrets(px.Namespace).Create(context.TODO(), secret, metav1.CreateOptions{}); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (c *Controller) createDatabaseSecret(px *api.PerconaXtraDB) (*core.SecretVolumeSource, error) {
@@ -21,12 +21,14 @@ import (
 	"fmt"
 
 	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+	"kubedb.dev/apimachinery/client/clientset/versioned/typed/kubedb/v1alpha2/util"
 	"kubedb.dev/apimachinery/pkg/eventer"
 
 	"github.com/appscode/go/log"
 	core "k8s.io/api/core/v1"
 	kerr "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	kutil "kmodules.xyz/client-go"
 	core_util "kmodules.xyz/client-go/core/v1"
@@ -34,24 +36,32 @@ import (
 	ofst "kmodules.xyz/offshoot-api/api/v1"
 )
 
-var defaultDBPort = core.ServicePort{
-	Name:       "db",
-	Protocol:   core.ProtocolTCP,
-	Port:       api.MySQLNodePort,
-	TargetPort: intstr.FromInt(api.MySQLNodePort),
+// dbServicePort returns the "db" port of the generated services, following
+// spec.port when set.
+func dbServicePort(px *api.PerconaXtraDB) core.ServicePort {
+	return core.ServicePort{
+		Name:       "db",
+		Protocol:   core.ProtocolTCP,
+		Port:       px.SQLPort(),
+		TargetPort: intstr.FromInt(int(px.SQLPort())),
+	}
 }
 
 func (c *Controller) ensureService(px *api.PerconaXtraDB) (kutil.VerbType, error) {
+	trace := newReconcileTracer(px)
+
 	// Check if service name exists
 	if err := c.checkService(px, px.ServiceName()); err != nil {
 		return kutil.VerbUnchanged, err
 	}
 
 	// create database Service
-	vt, err := c.createService(px)
+	service, vt, err := c.createService(px)
 	if err != nil {
 		return kutil.VerbUnchanged, err
-	} else if vt != kutil.VerbUnchanged {
+	}
+	trace.Tracef("primary service %v %v (type %v)", service.Name, vt, service.Spec.Type)
+	if vt != kutil.VerbUnchanged {
 		c.Recorder.Eventf(
 			px,
 			core.EventTypeNormal,
@@ -60,9 +70,77 @@ func (c *Controller) ensureService(px *api.PerconaXtraDB) (kutil.VerbType, error
 			vt,
 		)
 	}
+	if err := c.updateServiceStatus(px, service); err != nil {
+		return kutil.VerbUnchanged, err
+	}
+
+	// create an extra Service for read traffic in cluster mode
+	if px.IsCluster() {
+		if err := c.checkService(px, px.ReadServiceName()); err != nil {
+			return kutil.VerbUnchanged, err
+		}
+		vtRead, err := c.createReadService(px)
+		if err != nil {
+			return kutil.VerbUnchanged, err
+		}
+		trace.Tracef("read service %v %v", px.ReadServiceName(), vtRead)
+		if vtRead != kutil.VerbUnchanged {
+			c.Recorder.Eventf(
+				px,
+				core.EventTypeNormal,
+				eventer.EventReasonSuccessful,
+				"Successfully %s read Service",
+				vtRead,
+			)
+		}
+	}
+
+	// create a Service in front of the ProxySQL sidecars when requested
+	if px.Spec.ProxySQL != nil {
+		if err := c.checkService(px, px.ProxySQLServiceName()); err != nil {
+			return kutil.VerbUnchanged, err
+		}
+		vtProxy, err := c.createProxySQLService(px)
+		if err != nil {
+			return kutil.VerbUnchanged, err
+		} else if vtProxy != kutil.VerbUnchanged {
+			c.Recorder.Eventf(
+				px,
+				core.EventTypeNormal,
+				eventer.EventReasonSuccessful,
+				"Successfully %s ProxySQL Service",
+				vtProxy,
+			)
+		}
+	}
 	return vt, nil
 }
 
+// createReadService creates the "-read" Service that targets only pods which
+// are synced secondaries, so that read traffic stays off the primary.
+func (c *Controller) createReadService(px *api.PerconaXtraDB) (kutil.VerbType, error) {
+	meta := metav1.ObjectMeta{
+		Name:      px.ReadServiceName(),
+		Namespace: px.Namespace,
+	}
+
+	owner := metav1.NewControllerRef(px, api.SchemeGroupVersion.WithKind(api.ResourceKindPerconaXtraDB))
+
+	selector := px.OffshootSelectors()
+	selector[api.LabelRole] = api.RoleReplica
+	selector[wsrepLocalStateLabel] = "synced"
+
+	_, ok, err := core_util.CreateOrPatchService(context.TODO(), c.Client, meta, func(in *core.Service) *core.Service {
+		core_util.EnsureOwnerReference(&in.ObjectMeta, owner)
+		in.Labels = px.OffshootLabels()
+
+		in.Spec.Selector = selector
+		in.Spec.Ports = core_util.MergeServicePorts(in.Spec.Ports, []core.ServicePort{dbServicePort(px)})
+		return in
+	}, metav1.PatchOptions{})
+	return ok, err
+}
+
 func (c *Controller) checkService(px *api.PerconaXtraDB, serviceName string) error {
 	service, err := c.Client.CoreV1().Services(px.Namespace).Get(context.TODO(), serviceName, metav1.GetOptions{})
 	if err != nil {
@@ -80,7 +158,7 @@ func (c *Controller) checkService(px *api.PerconaXtraDB, serviceName string) err
 	return nil
 }
 
-func (c *Controller) createService(px *api.PerconaXtraDB) (kutil.VerbType, error) {
+func (c *Controller) createService(px *api.PerconaXtraDB) (*core.Service, kutil.VerbType, error) {
 	meta := metav1.ObjectMeta{
 		Name:      px.OffshootName(),
 		Namespace: px.Namespace,
@@ -88,33 +166,75 @@ func (c *Controller) createService(px *api.PerconaXtraDB) (kutil.VerbType, error
 
 	owner := metav1.NewControllerRef(px, api.SchemeGroupVersion.WithKind(api.ResourceKindPerconaXtraDB))
 
-	_, ok, err := core_util.CreateOrPatchService(context.TODO(), c.Client, meta, func(in *core.Service) *core.Service {
+	svcTemplate := px.ServiceTemplateFor(api.PerconaXtraDBPrimaryServiceAlias)
+
+	// clusters scope the primary service to the pod carrying the primary role,
+	// the same selector promotePrimary and syncPrimaryStatus write; rendering
+	// plain offshoot selectors here would undo a promotion on the next
+	// reconcile. Standalone pods carry no role labels and keep the plain
+	// selector.
+	selector := px.OffshootSelectors()
+	if px.IsCluster() {
+		selector[api.LabelRole] = api.RolePrimary
+		if !px.UsesAsyncReplication() {
+			selector[wsrepLocalStateLabel] = "synced"
+		}
+	}
+
+	service, ok, err := core_util.CreateOrPatchService(context.TODO(), c.Client, meta, func(in *core.Service) *core.Service {
 		core_util.EnsureOwnerReference(&in.ObjectMeta, owner)
 		in.Labels = px.OffshootLabels()
-		in.Annotations = px.Spec.ServiceTemplate.Annotations
+		in.Annotations = svcTemplate.Annotations
 
-		in.Spec.Selector = px.OffshootSelectors()
+		in.Spec.Selector = selector
 		in.Spec.Ports = ofst.MergeServicePorts(
-			core_util.MergeServicePorts(in.Spec.Ports, []core.ServicePort{defaultDBPort}),
-			px.Spec.ServiceTemplate.Spec.Ports,
+			core_util.MergeServicePorts(in.Spec.Ports, []core.ServicePort{dbServicePort(px)}),
+			svcTemplate.Spec.Ports,
 		)
 
-		if px.Spec.ServiceTemplate.Spec.ClusterIP != "" {
-			in.Spec.ClusterIP = px.Spec.ServiceTemplate.Spec.ClusterIP
+		if svcTemplate.Spec.ClusterIP != "" {
+			in.Spec.ClusterIP = svcTemplate.Spec.ClusterIP
 		}
-		if px.Spec.ServiceTemplate.Spec.Type != "" {
-			in.Spec.Type = px.Spec.ServiceTemplate.Spec.Type
+		if svcTemplate.Spec.Type != "" {
+			in.Spec.Type = svcTemplate.Spec.Type
 		}
-		in.Spec.ExternalIPs = px.Spec.ServiceTemplate.Spec.ExternalIPs
-		in.Spec.LoadBalancerIP = px.Spec.ServiceTemplate.Spec.LoadBalancerIP
-		in.Spec.LoadBalancerSourceRanges = px.Spec.ServiceTemplate.Spec.LoadBalancerSourceRanges
-		in.Spec.ExternalTrafficPolicy = px.Spec.ServiceTemplate.Spec.ExternalTrafficPolicy
-		if px.Spec.ServiceTemplate.Spec.HealthCheckNodePort > 0 {
-			in.Spec.HealthCheckNodePort = px.Spec.ServiceTemplate.Spec.HealthCheckNodePort
+		in.Spec.ExternalIPs = svcTemplate.Spec.ExternalIPs
+		in.Spec.LoadBalancerIP = svcTemplate.Spec.LoadBalancerIP
+		in.Spec.LoadBalancerSourceRanges = svcTemplate.Spec.LoadBalancerSourceRanges
+		in.Spec.ExternalTrafficPolicy = svcTemplate.Spec.ExternalTrafficPolicy
+		if svcTemplate.Spec.HealthCheckNodePort > 0 {
+			in.Spec.HealthCheckNodePort = svcTemplate.Spec.HealthCheckNodePort
 		}
 		return in
 	}, metav1.PatchOptions{})
-	return ok, err
+	return service, ok, err
+}
+
+// updateServiceStatus reports the node port assigned to the primary service in
+// the database status, so external clients can discover it without inspecting
+// the Service. A ClusterIP service clears the field.
+func (c *Controller) updateServiceStatus(px *api.PerconaXtraDB, service *core.Service) error {
+	var nodePort int32
+	if service.Spec.Type == core.ServiceTypeNodePort || service.Spec.Type == core.ServiceTypeLoadBalancer {
+		for _, port := range service.Spec.Ports {
+			if port.Name == dbServicePort(px).Name {
+				nodePort = port.NodePort
+				break
+			}
+		}
+	}
+	if px.Status.NodePort == nodePort {
+		return nil
+	}
+	per, err := util.UpdatePerconaXtraDBStatus(context.TODO(), c.DBClient.KubedbV1alpha2(), px.ObjectMeta, func(in *api.PerconaXtraDBStatus) *api.PerconaXtraDBStatus {
+		in.NodePort = nodePort
+		return in
+	}, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+	px.Status = per.Status
+	return nil
 }
 
 func (c *Controller) ensureStatsService(px *api.PerconaXtraDB) (kutil.VerbType, error) {
@@ -131,6 +251,8 @@ func (c *Controller) ensureStatsService(px *api.PerconaXtraDB) (kutil.VerbType,
 
 	owner := metav1.NewControllerRef(px, api.SchemeGroupVersion.WithKind(api.ResourceKindPerconaXtraDB))
 
+	svcTemplate := px.ServiceTemplateFor(api.PerconaXtraDBStatsServiceAlias)
+
 	// reconcile stats Service
 	meta := metav1.ObjectMeta{
 		Name:      px.StatsService().ServiceName(),
@@ -139,6 +261,7 @@ func (c *Controller) ensureStatsService(px *api.PerconaXtraDB) (kutil.VerbType,
 	_, vt, err := core_util.CreateOrPatchService(context.TODO(), c.Client, meta, func(in *core.Service) *core.Service {
 		core_util.EnsureOwnerReference(&in.ObjectMeta, owner)
 		in.Labels = px.StatsServiceLabels()
+		in.Annotations = svcTemplate.Annotations
 		in.Spec.Selector = px.OffshootSelectors()
 		in.Spec.Ports = core_util.MergeServicePorts(in.Spec.Ports, []core.ServicePort{
 			{
@@ -148,6 +271,11 @@ func (c *Controller) ensureStatsService(px *api.PerconaXtraDB) (kutil.VerbType,
 				TargetPort: intstr.FromString(mona.PrometheusExporterPortName),
 			},
 		})
+		if svcTemplate.Spec.Type != "" {
+			in.Spec.Type = svcTemplate.Spec.Type
+		}
+		in.Spec.LoadBalancerIP = svcTemplate.Spec.LoadBalancerIP
+		in.Spec.LoadBalancerSourceRanges = svcTemplate.Spec.LoadBalancerSourceRanges
 		return in
 	}, metav1.PatchOptions{})
 	if err != nil {
@@ -165,18 +293,38 @@ func (c *Controller) ensureStatsService(px *api.PerconaXtraDB) (kutil.VerbType,
 }
 
 func (c *Controller) createPerconaXtraDBGoverningService(px *api.PerconaXtraDB) (string, error) {
+	// a user referenced governing service is reused instead of created. The
+	// validating webhook already vets the reference, but the service can
+	// change after admission, so it is re-checked here.
+	if px.Spec.GoverningService != "" {
+		svc, err := c.Client.CoreV1().Services(px.Namespace).Get(context.TODO(), px.Spec.GoverningService, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		if err := checkGoverningService(svc, px); err != nil {
+			return "", err
+		}
+		return svc.Name, nil
+	}
+
 	owner := metav1.NewControllerRef(px, api.SchemeGroupVersion.WithKind(api.ResourceKindPerconaXtraDB))
 
+	// user supplied annotations are applied first, so that the required
+	// 'tolerate-unready-endpoints' annotation can never be overridden. The
+	// selector and the headless clusterIP are not templated at all.
+	svcTemplate := px.ServiceTemplateFor(api.PerconaXtraDBGoverningServiceAlias)
+	annotations := core_util.UpsertMap(svcTemplate.Annotations, map[string]string{
+		// 'tolerate-unready-endpoints' annotation is deprecated.
+		// owner: https://github.com/kubernetes/kubernetes/pull/63742
+		"service.alpha.kubernetes.io/tolerate-unready-endpoints": "true",
+	})
+
 	service := &core.Service{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      px.GoverningServiceName(),
-			Namespace: px.Namespace,
-			Labels:    px.OffshootLabels(),
-			// 'tolerate-unready-endpoints' annotation is deprecated.
-			// owner: https://github.com/kubernetes/kubernetes/pull/63742
-			Annotations: map[string]string{
-				"service.alpha.kubernetes.io/tolerate-unready-endpoints": "true",
-			},
+			Name:        px.GoverningServiceName(),
+			Namespace:   px.Namespace,
+			Labels:      px.OffshootLabels(),
+			Annotations: annotations,
 		},
 		Spec: core.ServiceSpec{
 			Type:                     core.ServiceTypeClusterIP,
@@ -185,7 +333,7 @@ func (c *Controller) createPerconaXtraDBGoverningService(px *api.PerconaXtraDB)
 			Ports: []core.ServicePort{
 				{
 					Name: "db",
-					Port: api.MySQLNodePort,
+					Port: px.SQLPort(),
 				},
 			},
 			Selector: px.OffshootSelectors(),
@@ -199,3 +347,16 @@ func (c *Controller) createPerconaXtraDBGoverningService(px *api.PerconaXtraDB)
 	}
 	return service.Name, nil
 }
+
+// checkGoverningService verifies that an externally managed service is usable
+// as the governing service: headless, and selecting the database pods.
+func checkGoverningService(svc *core.Service, px *api.PerconaXtraDB) error {
+	if svc.Spec.ClusterIP != core.ClusterIPNone {
+		return fmt.Errorf(`service "%v/%v" referenced by 'spec.governingService' is not headless`, svc.Namespace, svc.Name)
+	}
+	if len(svc.Spec.Selector) == 0 || !labels.SelectorFromSet(svc.Spec.Selector).Matches(labels.Set(px.OffshootSelectors())) {
+		return fmt.Errorf(`service "%v/%v" referenced by 'spec.governingService' does not select the pods of PerconaXtraDB %v/%v`,
+			svc.Namespace, svc.Name, px.Namespace, px.Name)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+
+	passgen "gomodules.xyz/password-generator"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	core_util "kmodules.xyz/client-go/core/v1"
+)
+
+const (
+	sstConfigFileName = "sst.cnf"
+
+	// keys of the SST user credentials in the auth secret; the xtrabackup SST
+	// script authenticates against the donor with these
+	sstUsernameKey = "sst-username"
+	sstPasswordKey = "sst-password"
+
+	sstUser = "sst"
+)
+
+func (c *Controller) sstConfigName(px *api.PerconaXtraDB) string {
+	return px.OffshootName() + "-sst-config"
+}
+
+// ensureSSTCredentials adds the SST user credentials to the auth secret when
+// the xtrabackup method is selected. Existing credentials are left untouched.
+func (c *Controller) ensureSSTCredentials(px *api.PerconaXtraDB) error {
+	meta := metav1.ObjectMeta{
+		Name:      px.GetDatabaseSecretName(),
+		Namespace: px.Namespace,
+	}
+	_, _, err := core_util.CreateOrPatchSecret(context.TODO(), c.Client, meta, func(in *core.Secret) *core.Secret {
+		if _, ok := in.Data[sstPasswordKey]; !ok {
+			in.StringData = map[string]string{
+				sstUsernameKey: sstUser,
+				sstPasswordKey: passgen.Generate(api.DefaultPasswordLength),
+			}
+		}
+		return in
+	}, metav1.PatchOptions{})
+	return err
+}
+
+// sstConfig renders the my.cnf snippet that selects spec.sstMethod. The
+// xtrabackup method additionally carries the SST user credentials in
+// wsrep_sst_auth.
+func sstConfig(px *api.PerconaXtraDB, username, password string) string {
+	cnf := fmt.Sprintf(`[mysqld]
+wsrep_sst_method=%v
+`, px.Spec.SSTMethod)
+
+	if px.Spec.SSTMethod == api.PerconaXtraDBSSTMethodXtrabackupV2 {
+		cnf += fmt.Sprintf(`wsrep_sst_auth="%s:%s"
+
+[sst]
+streamfmt=xbstream
+`, username, password)
+	}
+	return cnf
+}
+
+// ensureSSTConfig creates a Secret holding the my.cnf snippet that selects
+// spec.sstMethod. It is a Secret rather than a ConfigMap because the
+// xtrabackup method carries the SST user credentials in wsrep_sst_auth.
+func (c *Controller) ensureSSTConfig(px *api.PerconaXtraDB) error {
+	owner := metav1.NewControllerRef(px, api.SchemeGroupVersion.WithKind(api.ResourceKindPerconaXtraDB))
+
+	var username, password string
+	if px.Spec.SSTMethod == api.PerconaXtraDBSSTMethodXtrabackupV2 {
+		secret, err := c.Client.CoreV1().Secrets(px.Namespace).Get(context.TODO(), px.GetDatabaseSecretName(), metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		username = string(secret.Data[sstUsernameKey])
+		password = string(secret.Data[sstPasswordKey])
+	}
+	cnf := sstConfig(px, username, password)
+
+	meta := metav1.ObjectMeta{
+		Name:      c.sstConfigName(px),
+		Namespace: px.Namespace,
+	}
+
+	_, _, err := core_util.CreateOrPatchSecret(context.TODO(), c.Client, meta, func(in *core.Secret) *core.Secret {
+		core_util.EnsureOwnerReference(&in.ObjectMeta, owner)
+		in.Labels = px.OffshootLabels()
+		in.StringData = map[string]string{
+			sstConfigFileName: cnf,
+		}
+		return in
+	}, metav1.PatchOptions{})
+	return err
+}
@@ -0,0 +1,181 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+	"kubedb.dev/apimachinery/pkg/eventer"
+
+	"github.com/appscode/go/log"
+	"github.com/pkg/errors"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	appcat "kmodules.xyz/custom-resources/apis/appcatalog/v1alpha1"
+	"stash.appscode.dev/apimachinery/apis"
+	stash_v1beta1 "stash.appscode.dev/apimachinery/apis/stash/v1beta1"
+)
+
+// stashCleanupTimeout bounds how long a WipeOut deletion waits for Stash to
+// tear down its sessions, jobs and temporary PVCs. After the timeout the
+// finalizer is removed anyway, so a wedged Stash installation cannot block the
+// deletion forever.
+const stashCleanupTimeout = 5 * time.Minute
+
+// cleanupStashResources makes sure no Stash backup or restore session of this
+// database, nor any of the jobs and temporary PVCs they spawned, survives a
+// WipeOut deletion. Returning an error requeues the terminate call, so the
+// operator keeps polling until everything is gone; once the deletion has been
+// pending longer than stashCleanupTimeout, the leftovers are reported and the
+// deletion proceeds.
+func (c *Controller) cleanupStashResources(px *api.PerconaXtraDB) error {
+	leftovers, err := c.deleteStashResources(px)
+	if err != nil {
+		return err
+	}
+	if len(leftovers) == 0 {
+		return nil
+	}
+
+	if px.DeletionTimestamp != nil && time.Since(px.DeletionTimestamp.Time) > stashCleanupTimeout {
+		c.Recorder.Eventf(
+			px,
+			core.EventTypeWarning,
+			eventer.EventReasonFailedToDelete,
+			"Gave up waiting for Stash cleanup of PerconaXtraDB %v/%v after %v; these resources may be leaked: %v",
+			px.Namespace, px.Name, stashCleanupTimeout, leftovers,
+		)
+		return nil
+	}
+
+	c.Recorder.Eventf(
+		px,
+		core.EventTypeNormal,
+		eventer.EventReasonWipingOut,
+		"Deletion of PerconaXtraDB %v/%v is waiting for %d Stash resources to be cleaned up: %v",
+		px.Namespace, px.Name, len(leftovers), leftovers,
+	)
+	return errors.Errorf("waiting for Stash cleanup of PerconaXtraDB %v/%v: %v", px.Namespace, px.Name, leftovers)
+}
+
+// deleteStashResources issues deletes for the Stash sessions of this database
+// and their offshoots, and returns what still exists. Stash removes the jobs
+// and temporary PVCs of a session through its own finalizer, so most of the
+// time deleting the sessions is enough; jobs and PVCs are swept explicitly to
+// also catch leftovers of sessions that are already gone.
+func (c *Controller) deleteStashResources(px *api.PerconaXtraDB) ([]string, error) {
+	var leftovers []string
+
+	cfg, err := c.findBackupConfiguration(px)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := c.Initializers.Stash.StashClient.StashV1beta1().BackupSessions(px.Namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var matching []*stash_v1beta1.BackupSession
+	for i := range sessions.Items {
+		session := &sessions.Items[i]
+		if (cfg != nil && session.Spec.Invoker.Name == cfg.Name) || session.Name == finalBackupSessionName(px) {
+			matching = append(matching, session)
+		}
+	}
+	for _, session := range matching {
+		// the final backup session must outlive the other sessions: deleting
+		// it while ensureFinalBackup can still run would just recreate it
+		if session.Name == finalBackupSessionName(px) && len(matching) > 1 {
+			continue
+		}
+		if session.DeletionTimestamp == nil {
+			if err := c.Initializers.Stash.StashClient.StashV1beta1().BackupSessions(px.Namespace).Delete(context.TODO(), session.Name, metav1.DeleteOptions{}); err != nil && !kerr.IsNotFound(err) {
+				return nil, err
+			}
+			log.Infof("Deleted BackupSession %v/%v of PerconaXtraDB %v", px.Namespace, session.Name, px.Name)
+		}
+		leftovers = append(leftovers, fmt.Sprintf("BackupSession/%s", session.Name))
+	}
+
+	restores, err := c.Initializers.Stash.StashClient.StashV1beta1().RestoreSessions(px.Namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for i := range restores.Items {
+		restore := &restores.Items[i]
+		if restore.Spec.Target == nil ||
+			restore.Spec.Target.Ref.Kind != appcat.ResourceKindApp ||
+			restore.Spec.Target.Ref.Name != px.AppBindingMeta().Name() {
+			continue
+		}
+		if restore.DeletionTimestamp == nil {
+			if err := c.Initializers.Stash.StashClient.StashV1beta1().RestoreSessions(px.Namespace).Delete(context.TODO(), restore.Name, metav1.DeleteOptions{}); err != nil && !kerr.IsNotFound(err) {
+				return nil, err
+			}
+			log.Infof("Deleted RestoreSession %v/%v of PerconaXtraDB %v", px.Namespace, restore.Name, px.Name)
+		}
+		leftovers = append(leftovers, fmt.Sprintf("RestoreSession/%s", restore.Name))
+	}
+
+	if cfg == nil {
+		return leftovers, nil
+	}
+
+	// jobs and temporary PVCs carry the invoker labels Stash stamps on
+	// everything it creates for a session
+	selector := labels.SelectorFromSet(map[string]string{
+		apis.LabelInvokerName: cfg.Name,
+	}).String()
+
+	jobs, err := c.Client.BatchV1().Jobs(px.Namespace).List(context.TODO(), metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	for i := range jobs.Items {
+		job := &jobs.Items[i]
+		if job.DeletionTimestamp == nil {
+			policy := metav1.DeletePropagationBackground
+			if err := c.Client.BatchV1().Jobs(px.Namespace).Delete(context.TODO(), job.Name, metav1.DeleteOptions{PropagationPolicy: &policy}); err != nil && !kerr.IsNotFound(err) {
+				return nil, err
+			}
+			log.Infof("Deleted backup Job %v/%v of PerconaXtraDB %v", px.Namespace, job.Name, px.Name)
+		}
+		leftovers = append(leftovers, fmt.Sprintf("Job/%s", job.Name))
+	}
+
+	pvcs, err := c.Client.CoreV1().PersistentVolumeClaims(px.Namespace).List(context.TODO(), metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	for i := range pvcs.Items {
+		pvc := &pvcs.Items[i]
+		if pvc.DeletionTimestamp == nil {
+			if err := c.Client.CoreV1().PersistentVolumeClaims(px.Namespace).Delete(context.TODO(), pvc.Name, metav1.DeleteOptions{}); err != nil && !kerr.IsNotFound(err) {
+				return nil, err
+			}
+			log.Infof("Deleted temporary PVC %v/%v of PerconaXtraDB %v", px.Namespace, pvc.Name, px.Name)
+		}
+		leftovers = append(leftovers, fmt.Sprintf("PersistentVolumeClaim/%s", pvc.Name))
+	}
+
+	return leftovers, nil
+}
@@ -19,7 +19,11 @@ package controller
 import (
 	"context"
 	"fmt"
+	"hash/fnv"
+	"reflect"
+	"strconv"
 	"strings"
+	"time"
 
 	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
 	"kubedb.dev/apimachinery/pkg/eventer"
@@ -32,12 +36,23 @@ import (
 	kerr "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kutil "kmodules.xyz/client-go"
+	kmapi "kmodules.xyz/client-go/api/v1"
 	app_util "kmodules.xyz/client-go/apps/v1"
 	core_util "kmodules.xyz/client-go/core/v1"
+	meta_util "kmodules.xyz/client-go/meta"
 	mona "kmodules.xyz/monitoring-agent-api/api/v1"
 	ofst "kmodules.xyz/offshoot-api/api/v1"
 )
 
+const (
+	customConfigHashAnnotation = api.PerconaXtraDBKey + "/config-hash"
+	envHashAnnotation          = api.PerconaXtraDBKey + "/env-hash"
+)
+
+// defaultTerminationGracePeriodSeconds leaves enough room for mysqladmin
+// shutdown to flush and for a cluster node to leave the group cleanly.
+const defaultTerminationGracePeriodSeconds = int64(300)
+
 type workloadOptions struct {
 	// App level options
 	stsName   string
@@ -57,6 +72,15 @@ type workloadOptions struct {
 	// monitor container
 	monitorContainer *core.Container
 
+	// proxysql sidecar container
+	proxysqlContainer *core.Container
+
+	// coordinator sidecar container
+	coordinatorContainer *core.Container
+
+	// audit log forwarder sidecar container
+	auditContainer *core.Container
+
 	// pod Template level options
 	replicas       *int32
 	gvrSvcName     string
@@ -64,6 +88,7 @@ type workloadOptions struct {
 	pvcSpec        *core.PersistentVolumeClaimSpec
 	initContainers []core.Container
 	volume         []core.Volume // volumes to mount on stsPodTemplate
+	updateStrategy apps.StatefulSetUpdateStrategy
 }
 
 func (c *Controller) ensurePerconaXtraDB(px *api.PerconaXtraDB) (kutil.VerbType, error) {
@@ -75,7 +100,7 @@ func (c *Controller) ensurePerconaXtraDB(px *api.PerconaXtraDB) (kutil.VerbType,
 	initContainers := []core.Container{
 		{
 			Name:            "remove-lost-found",
-			Image:           pxVersion.Spec.InitContainer.Image,
+			Image:           initHelperImage(px, pxVersion.Spec.InitContainer.Image),
 			ImagePullPolicy: core.PullIfNotPresent,
 			Command: []string{
 				"rm",
@@ -92,11 +117,44 @@ func (c *Controller) ensurePerconaXtraDB(px *api.PerconaXtraDB) (kutil.VerbType,
 		},
 	}
 
+	// mysqld reads the server certificate files from the mounted cert secret
+	// when TLS is configured.
+	var tlsArgs []string
+	if px.Spec.TLS != nil {
+		tlsArgs = []string{
+			fmt.Sprintf("--ssl-ca=%s/ca.crt", api.PerconaXtraDBCertMountPath),
+			fmt.Sprintf("--ssl-cert=%s/tls.crt", api.PerconaXtraDBCertMountPath),
+			fmt.Sprintf("--ssl-key=%s/tls.key", api.PerconaXtraDBCertMountPath),
+		}
+	}
+
+	// mysqld follows spec.port when set; the generated services and the
+	// exporter DSN are derived from the same helper
+	if px.Spec.Port != nil {
+		tlsArgs = append(tlsArgs, fmt.Sprintf("--port=%d", px.SQLPort()))
+	}
+
+	// the keyring plugin has to be loaded before InnoDB initializes, so it is
+	// wired up through early-plugin-load instead of a runtime plugin install
+	if px.Spec.Encryption != nil {
+		if px.Spec.Encryption.Mode == api.KeyringVault {
+			tlsArgs = append(tlsArgs,
+				"--early-plugin-load=keyring_vault.so",
+				fmt.Sprintf("--keyring_vault_config=%s/%s", api.PerconaXtraDBKeyringVaultConfigMountPath, keyringVaultConfigFileName),
+			)
+		} else {
+			tlsArgs = append(tlsArgs,
+				"--early-plugin-load=keyring_file.so",
+				fmt.Sprintf("--keyring_file_data=%s", api.PerconaXtraDBKeyringFileDataPath),
+			)
+		}
+	}
+
 	var cmds, args []string
 	var ports = []core.ContainerPort{
 		{
 			Name:          "mysql",
-			ContainerPort: api.MySQLNodePort,
+			ContainerPort: px.SQLPort(),
 			Protocol:      core.ProtocolTCP,
 		},
 	}
@@ -104,7 +162,7 @@ func (c *Controller) ensurePerconaXtraDB(px *api.PerconaXtraDB) (kutil.VerbType,
 		cmds = []string{
 			"peer-finder",
 		}
-		userProvidedArgs := strings.Join(px.Spec.PodTemplate.Spec.Args, " ")
+		userProvidedArgs := strings.Join(append(px.Spec.PodTemplate.Spec.Args, tlsArgs...), " ")
 		args = []string{
 			fmt.Sprintf("-service=%s", c.GoverningService),
 			fmt.Sprintf("-on-start=/on-start.sh %s", userProvidedArgs),
@@ -112,40 +170,302 @@ func (c *Controller) ensurePerconaXtraDB(px *api.PerconaXtraDB) (kutil.VerbType,
 		ports = append(ports, []core.ContainerPort{
 			{
 				Name:          "sst",
-				ContainerPort: 4567,
+				ContainerPort: px.GaleraReplicationPort(),
 			},
 			{
 				Name:          "replication",
-				ContainerPort: 4568,
+				ContainerPort: px.GaleraReplicationPort() + 1,
 			},
 		}...)
+	} else {
+		args = tlsArgs
 	}
 
 	var volumes []core.Volume
 	var volumeMounts []core.VolumeMount
 
-	if !px.IsCluster() && px.Spec.Init != nil && px.Spec.Init.Script != nil {
+	// A pre-start script wraps the container command: it has to succeed on
+	// every container start before the server (or peer-finder in cluster mode)
+	// is exec'ed, so a failing pre-flight check fails pod startup instead of
+	// starting mysqld anyway.
+	if px.Spec.PreStartScript != nil {
+		script := api.PerconaXtraDBPreStartScriptMountPath + "/" + px.Spec.PreStartScript.ScriptPath
+		inner := strings.TrimSpace(strings.Join(append(append([]string{}, cmds...), args...), " "))
+		if !px.IsCluster() {
+			// standalone relies on the image entrypoint; spell it out so it
+			// can be exec'ed behind the script
+			inner = strings.TrimSpace("/docker-entrypoint.sh mysqld " + inner)
+		}
+		cmds = []string{"/bin/bash", "-c"}
+		args = []string{fmt.Sprintf("set -e; /bin/bash %s; exec %s", script, inner)}
+		volumes = append(volumes, core.Volume{
+			Name:         "pre-start-script",
+			VolumeSource: px.Spec.PreStartScript.VolumeSource,
+		})
+		volumeMounts = append(volumeMounts, core.VolumeMount{
+			Name:      "pre-start-script",
+			MountPath: api.PerconaXtraDBPreStartScriptMountPath,
+		})
+	}
+
+	// the keyring_vault plugin reads its connection settings, including the
+	// Vault token, from the rendered config secret
+	if px.Spec.Encryption != nil && px.Spec.Encryption.Mode == api.KeyringVault {
+		volumes = append(volumes, core.Volume{
+			Name: "keyring-vault-config",
+			VolumeSource: core.VolumeSource{
+				Secret: &core.SecretVolumeSource{
+					SecretName: c.keyringVaultConfigSecretName(px),
+				},
+			},
+		})
+		volumeMounts = append(volumeMounts, core.VolumeMount{
+			Name:      "keyring-vault-config",
+			MountPath: api.PerconaXtraDBKeyringVaultConfigMountPath,
+		})
+	}
+
+	// The init script only applies to the very first boot. Once the database
+	// has been provisioned, the mount is dropped so the script can not re-run
+	// on subsequent restarts.
+	if px.Spec.Init != nil && px.Spec.Init.Script != nil &&
+		!kmapi.IsConditionTrue(px.Status.Conditions, api.DatabaseProvisioned) {
 		volumes = append(volumes, core.Volume{
 			Name:         "initial-script",
 			VolumeSource: px.Spec.Init.Script.VolumeSource,
 		})
+		if px.IsCluster() {
+			// In cluster mode only the bootstrap node may run the script; the
+			// joiners receive its effect through SST. An init container stages
+			// the script into the entrypoint directory on pod -0 only.
+			volumes = append(volumes, core.Volume{
+				Name: "initial-script-staged",
+				VolumeSource: core.VolumeSource{
+					EmptyDir: &core.EmptyDirVolumeSource{},
+				},
+			})
+			initContainers = append(initContainers, core.Container{
+				Name:            "stage-init-script",
+				Image:           initHelperImage(px, pxVersion.Spec.InitContainer.Image),
+				ImagePullPolicy: core.PullIfNotPresent,
+				Command: []string{
+					"sh",
+					"-c",
+					`case "$(hostname)" in (*-0) cp /init-script/* /staged/ ;; esac`,
+				},
+				VolumeMounts: []core.VolumeMount{
+					{
+						Name:      "initial-script",
+						MountPath: "/init-script",
+					},
+					{
+						Name:      "initial-script-staged",
+						MountPath: "/staged",
+					},
+				},
+			})
+			volumeMounts = append(volumeMounts, core.VolumeMount{
+				Name:      "initial-script-staged",
+				MountPath: api.PerconaXtraDBInitDBMountPath,
+			})
+		} else {
+			volumeMounts = append(volumeMounts, core.VolumeMount{
+				Name:      "initial-script",
+				MountPath: api.PerconaXtraDBInitDBMountPath,
+			})
+		}
+	}
+
+	// while a full-outage recovery is armed, the chosen bootstrap node gets
+	// safe_to_bootstrap flipped in its grastate.dat before mysqld starts. The
+	// annotation is cleared once the cluster has regained quorum, which drops
+	// the container again.
+	if bootstrapPod := px.Annotations[bootstrapPodAnnotation]; px.IsCluster() && bootstrapPod != "" {
+		initContainers = append(initContainers, core.Container{
+			Name:            "mark-safe-to-bootstrap",
+			Image:           initHelperImage(px, pxVersion.Spec.InitContainer.Image),
+			ImagePullPolicy: core.PullIfNotPresent,
+			Command: []string{
+				"sh",
+				"-c",
+				fmt.Sprintf(`case "$(hostname)" in (%[1]s) if [ -f %[2]s/grastate.dat ]; then sed -i 's/^safe_to_bootstrap: 0/safe_to_bootstrap: 1/' %[2]s/grastate.dat; fi ;; esac`,
+					bootstrapPod, api.PerconaXtraDBDataMountPath),
+			},
+			VolumeMounts: []core.VolumeMount{
+				{
+					Name:      "data",
+					MountPath: api.PerconaXtraDBDataMountPath,
+				},
+			},
+		})
+	}
+
+	// mount the issued server certificates so that mysqld can serve TLS connections.
+	// For cluster mode, the StatefulSet distributes the same cert bundle to every pod.
+	if px.Spec.TLS != nil {
+		volumes = append(volumes, core.Volume{
+			Name: "tls-server-certs",
+			VolumeSource: core.VolumeSource{
+				Secret: &core.SecretVolumeSource{
+					SecretName: px.MustCertSecretName(api.PerconaXtraDBServerCert),
+				},
+			},
+		})
+		volumeMounts = append(volumeMounts, core.VolumeMount{
+			Name:      "tls-server-certs",
+			MountPath: api.PerconaXtraDBCertMountPath,
+		})
+	}
+
+	// for Galera clusters, encrypt the SST and replication traffic between
+	// the nodes using a separate replication certificate set.
+	if px.IsCluster() && !px.UsesAsyncReplication() && px.Spec.TLS != nil && px.Spec.TLS.IssuerRef != nil {
+		if err := c.ensureReplicationTLSConfig(px); err != nil {
+			return kutil.VerbUnchanged, err
+		}
+		volumes = append(volumes, core.Volume{
+			Name: "tls-replication-certs",
+			VolumeSource: core.VolumeSource{
+				Secret: &core.SecretVolumeSource{
+					SecretName: px.MustCertSecretName(api.PerconaXtraDBReplicationCert),
+				},
+			},
+		}, core.Volume{
+			Name: "replication-tls-config",
+			VolumeSource: core.VolumeSource{
+				ConfigMap: &core.ConfigMapVolumeSource{
+					LocalObjectReference: core.LocalObjectReference{
+						Name: c.replicationTLSConfigName(px),
+					},
+				},
+			},
+		})
 		volumeMounts = append(volumeMounts, core.VolumeMount{
-			Name:      "initial-script",
-			MountPath: api.PerconaXtraDBInitDBMountPath,
+			Name:      "tls-replication-certs",
+			MountPath: api.PerconaXtraDBReplicationCertMountPath,
+		}, core.VolumeMount{
+			Name:      "replication-tls-config",
+			MountPath: api.PerconaXtraDBClusterCustomConfigMountPath + replicationTLSConfigFileName,
+			SubPath:   replicationTLSConfigFileName,
 		})
+
+		// rotating the issued certs changes this annotation, which triggers a
+		// controlled rolling restart instead of leaving stale certs mounted.
+		certHash, err := c.tlsCertHash(px, api.PerconaXtraDBServerCert, api.PerconaXtraDBReplicationCert)
+		if err != nil {
+			return kutil.VerbUnchanged, err
+		}
+		if px.Spec.PodTemplate.Annotations == nil {
+			px.Spec.PodTemplate.Annotations = map[string]string{}
+		}
+		px.Spec.PodTemplate.Annotations[tlsCertHashAnnotation] = certHash
+	}
+	// a user-provided ServiceAccount, e.g. one carrying workload identity
+	// bindings, is used as-is; otherwise the pods run under the operator-created
+	// account
+	if px.Spec.PodTemplate.Spec.ServiceAccountName == "" {
+		px.Spec.PodTemplate.Spec.ServiceAccountName = px.OffshootName()
+	}
+
+	// spread cluster nodes evenly across zones unless the user declared their
+	// own constraints. Standalone databases have nothing to spread.
+	if px.IsCluster() && len(px.Spec.PodTemplate.Spec.TopologySpreadConstraints) == 0 {
+		px.Spec.PodTemplate.Spec.TopologySpreadConstraints = []core.TopologySpreadConstraint{
+			{
+				MaxSkew:           1,
+				TopologyKey:       core.LabelZoneFailureDomainStable,
+				WhenUnsatisfiable: core.ScheduleAnyway,
+				LabelSelector: &metav1.LabelSelector{
+					MatchLabels: px.OffshootSelectors(),
+				},
+			},
+		}
+	}
+
+	// keep cluster nodes on separate hosts where possible. A user-declared
+	// affinity replaces the generated one entirely.
+	if px.Spec.PodTemplate.Spec.Affinity == nil {
+		px.Spec.PodTemplate.Spec.Affinity = defaultAffinity(px)
 	}
-	px.Spec.PodTemplate.Spec.ServiceAccountName = px.OffshootName()
 
 	envList := []core.EnvVar{}
-	if px.IsCluster() {
+	// CLUSTER_NAME makes the image entrypoint join the Galera cluster; async
+	// source-replica pods start as standalone servers and are wired together
+	// by the operator instead
+	if px.IsCluster() && !px.UsesAsyncReplication() {
 		envList = append(envList, core.EnvVar{
 			Name:  "CLUSTER_NAME",
 			Value: px.OffshootName(),
 		})
 	}
 
+	// trust a user supplied CA bundle, i.e for restores from an S3 endpoint
+	// with a private CA. SSL_CERT_FILE is honored by the mysql client and the
+	// Stash binaries alike.
+	if px.Spec.Init != nil && px.Spec.Init.CABundleConfigMapRef != nil {
+		volumes = append(volumes, core.Volume{
+			Name: "custom-ca",
+			VolumeSource: core.VolumeSource{
+				ConfigMap: &core.ConfigMapVolumeSource{
+					LocalObjectReference: *px.Spec.Init.CABundleConfigMapRef,
+				},
+			},
+		})
+		caMount := core.VolumeMount{
+			Name:      "custom-ca",
+			MountPath: api.PerconaXtraDBCustomCAMountPath,
+		}
+		caEnv := core.EnvVar{
+			Name:  "SSL_CERT_FILE",
+			Value: api.PerconaXtraDBCustomCAMountPath + "/ca.crt",
+		}
+		volumeMounts = append(volumeMounts, caMount)
+		envList = append(envList, caEnv)
+		for i := range initContainers {
+			initContainers[i].VolumeMounts = core_util.UpsertVolumeMount(initContainers[i].VolumeMounts, caMount)
+			initContainers[i].Env = core_util.UpsertEnvVars(initContainers[i].Env, caEnv)
+		}
+	}
+
 	var monitorContainer core.Container
-	if px.Spec.Monitor != nil && px.Spec.Monitor.Agent.Vendor() == mona.VendorPrometheus {
+	if px.Spec.Monitor != nil && !px.Spec.Monitor.Paused && px.Spec.Monitor.Agent.Vendor() == mona.VendorPrometheus {
+		// user supplied args come first, so collector flags derived from
+		// spec.monitor.prometheus.exporter.collectors take precedence
+		exporterArgs := append(px.Spec.Monitor.Prometheus.Exporter.Args, collectorArgs(px.Spec.Monitor.Prometheus.Exporter.Collectors)...)
+		var exporterMounts []core.VolumeMount
+		if exporterTLSEnabled(px) {
+			if err := c.ensureExporterWebConfig(px); err != nil {
+				return kutil.VerbUnchanged, err
+			}
+			exporterArgs = append(exporterArgs, fmt.Sprintf("--web.config.file=%s/%s", exporterWebConfigMountPath, exporterWebConfigFileName))
+			volumes = append(volumes, core.Volume{
+				Name: "exporter-certs",
+				VolumeSource: core.VolumeSource{
+					Secret: &core.SecretVolumeSource{
+						SecretName: exporterTLSSecretName(px),
+					},
+				},
+			}, core.Volume{
+				Name: "exporter-web-config",
+				VolumeSource: core.VolumeSource{
+					ConfigMap: &core.ConfigMapVolumeSource{
+						LocalObjectReference: core.LocalObjectReference{
+							Name: c.exporterWebConfigName(px),
+						},
+					},
+				},
+			})
+			exporterMounts = []core.VolumeMount{
+				{
+					Name:      "exporter-certs",
+					MountPath: exporterCertMountPath,
+				},
+				{
+					Name:      "exporter-web-config",
+					MountPath: exporterWebConfigMountPath,
+				},
+			}
+		}
 		monitorContainer = core.Container{
 			Name: "exporter",
 			Command: []string{
@@ -155,11 +475,11 @@ func (c *Controller) ensurePerconaXtraDB(px *api.PerconaXtraDB) (kutil.VerbType,
 				"-c",
 				// DATA_SOURCE_NAME=user:password@tcp(localhost:5555)/dbname
 				// ref: https://github.com/prometheus/mysqld_exporter#setting-the-mysql-servers-data-source-name
-				fmt.Sprintf(`export DATA_SOURCE_NAME="${MYSQL_ROOT_USERNAME:-}:${MYSQL_ROOT_PASSWORD:-}@(127.0.0.1:3306)/"
+				fmt.Sprintf(`export DATA_SOURCE_NAME="${MONITOR_USERNAME:-}:${MONITOR_PASSWORD:-}@(127.0.0.1:%v)/"
 						/bin/mysqld_exporter --web.listen-address=:%v --web.telemetry-path=%v %v`,
-					px.Spec.Monitor.Prometheus.Exporter.Port, px.StatsService().Path(), strings.Join(px.Spec.Monitor.Prometheus.Exporter.Args, " ")),
+					px.SQLPort(), px.Spec.Monitor.Prometheus.Exporter.Port, px.StatsService().Path(), strings.Join(exporterArgs, " ")),
 			},
-			Image: pxVersion.Spec.Exporter.Image,
+			Image: exporterImage(px, pxVersion.Spec.Exporter.Image),
 			Ports: []core.ContainerPort{
 				{
 					Name:          mona.PrometheusExporterPortName,
@@ -170,31 +490,582 @@ func (c *Controller) ensurePerconaXtraDB(px *api.PerconaXtraDB) (kutil.VerbType,
 			Env:             px.Spec.Monitor.Prometheus.Exporter.Env,
 			Resources:       px.Spec.Monitor.Prometheus.Exporter.Resources,
 			SecurityContext: px.Spec.Monitor.Prometheus.Exporter.SecurityContext,
+			VolumeMounts:    exporterMounts,
+		}
+	}
+
+	// the coordinator sidecar and the database container share an emptyDir,
+	// through which the readiness file is handed over
+	var coordContainer *core.Container
+	if px.IsCluster() && px.Spec.Coordinator != nil {
+		coordContainer = coordinatorContainer(px, coordinatorImage(px, pxVersion.Spec.DB.Image))
+		volumes = append(volumes, core.Volume{
+			Name: "coordinator",
+			VolumeSource: core.VolumeSource{
+				EmptyDir: &core.EmptyDirVolumeSource{},
+			},
+		})
+		volumeMounts = append(volumeMounts, core.VolumeMount{
+			Name:      "coordinator",
+			MountPath: coordinatorDir,
+		})
+	}
+
+	var proxysqlContainer *core.Container
+	if px.Spec.ProxySQL != nil {
+		proxysqlContainer = c.proxySQLContainer(px)
+		volumes = append(volumes, core.Volume{
+			Name: "proxysql-config",
+			VolumeSource: core.VolumeSource{
+				ConfigMap: &core.ConfigMapVolumeSource{
+					LocalObjectReference: core.LocalObjectReference{
+						Name: c.proxySQLConfigName(px),
+					},
+				},
+			},
+		})
+	}
+
+	// derive innodb_buffer_pool_size from the container memory limit and ship
+	// it as a generated config file next to the user config
+	if px.Spec.AutoTuneBufferPool != nil {
+		if size := computeBufferPoolSize(px); size > 0 {
+			if err := c.ensureAutoTuneConfig(px, size); err != nil {
+				return kutil.VerbUnchanged, err
+			}
+			configMountPath := api.PerconaXtraDBCustomConfigMountPath
+			if px.IsCluster() {
+				configMountPath = api.PerconaXtraDBClusterCustomConfigMountPath
+			}
+			volumes = append(volumes, core.Volume{
+				Name: "auto-tune-config",
+				VolumeSource: core.VolumeSource{
+					ConfigMap: &core.ConfigMapVolumeSource{
+						LocalObjectReference: core.LocalObjectReference{
+							Name: c.autoTuneConfigName(px),
+						},
+					},
+				},
+			})
+			volumeMounts = append(volumeMounts, core.VolumeMount{
+				Name:      "auto-tune-config",
+				MountPath: configMountPath + autoTuneConfigFileName,
+				SubPath:   autoTuneConfigFileName,
+			})
+			if px.Spec.PodTemplate.Annotations == nil {
+				px.Spec.PodTemplate.Annotations = map[string]string{}
+			}
+			px.Spec.PodTemplate.Annotations[bufferPoolSizeAnnotation] = strconv.FormatInt(size, 10)
+		} else {
+			log.Warningf("PerconaXtraDB %v/%v has no memory limit; keeping the server default innodb_buffer_pool_size", px.Namespace, px.Name)
+		}
+	}
+
+	// persist spec.binlogRetention as the server's binlog expiry variable in a
+	// generated config file; running servers pick a changed value up live via
+	// SET GLOBAL below, so no restart is needed
+	if seconds := px.BinlogExpireSeconds(); seconds > 0 {
+		if err := c.ensureBinlogConfig(px, seconds); err != nil {
+			return kutil.VerbUnchanged, err
+		}
+		binlogConfigMountPath := api.PerconaXtraDBCustomConfigMountPath
+		if px.IsCluster() {
+			binlogConfigMountPath = api.PerconaXtraDBClusterCustomConfigMountPath
+		}
+		volumes = append(volumes, core.Volume{
+			Name: "binlog-config",
+			VolumeSource: core.VolumeSource{
+				ConfigMap: &core.ConfigMapVolumeSource{
+					LocalObjectReference: core.LocalObjectReference{
+						Name: c.binlogConfigName(px),
+					},
+				},
+			},
+		})
+		volumeMounts = append(volumeMounts, core.VolumeMount{
+			Name:      "binlog-config",
+			MountPath: binlogConfigMountPath + binlogConfigFileName,
+			SubPath:   binlogConfigFileName,
+		})
+		if px.Spec.PodTemplate.Annotations == nil {
+			px.Spec.PodTemplate.Annotations = map[string]string{}
+		}
+		px.Spec.PodTemplate.Annotations[binlogRetentionAnnotation] = strconv.FormatInt(seconds, 10)
+	}
+
+	// persist spec.maxConnections as max_connections in a generated config
+	// file; running servers pick a raised limit up live via SET GLOBAL below
+	if limit := computeMaxConnections(px); limit > 0 {
+		if err := c.ensureMaxConnectionsConfig(px, limit); err != nil {
+			return kutil.VerbUnchanged, err
+		}
+		maxConnConfigMountPath := api.PerconaXtraDBCustomConfigMountPath
+		if px.IsCluster() {
+			maxConnConfigMountPath = api.PerconaXtraDBClusterCustomConfigMountPath
+		}
+		volumes = append(volumes, core.Volume{
+			Name: "max-connections-config",
+			VolumeSource: core.VolumeSource{
+				ConfigMap: &core.ConfigMapVolumeSource{
+					LocalObjectReference: core.LocalObjectReference{
+						Name: c.maxConnectionsConfigName(px),
+					},
+				},
+			},
+		})
+		volumeMounts = append(volumeMounts, core.VolumeMount{
+			Name:      "max-connections-config",
+			MountPath: maxConnConfigMountPath + maxConnectionsConfigFileName,
+			SubPath:   maxConnectionsConfigFileName,
+		})
+		if px.Spec.PodTemplate.Annotations == nil {
+			px.Spec.PodTemplate.Annotations = map[string]string{}
+		}
+		px.Spec.PodTemplate.Annotations[maxConnectionsAnnotation] = strconv.FormatInt(limit, 10)
+	} else if px.Spec.MaxConnections != nil && px.Spec.MaxConnections.Auto {
+		log.Warningf("PerconaXtraDB %v/%v has no memory limit; keeping the server default max_connections", px.Namespace, px.Name)
+	}
+
+	// load the audit_log plugin and tail its file with a forwarder sidecar
+	// when spec.auditLog is enabled
+	var auditContainer *core.Container
+	if px.Spec.AuditLog != nil {
+		if err := c.ensureAuditConfig(px); err != nil {
+			return kutil.VerbUnchanged, err
+		}
+		auditConfigMountPath := api.PerconaXtraDBCustomConfigMountPath
+		if px.IsCluster() {
+			auditConfigMountPath = api.PerconaXtraDBClusterCustomConfigMountPath
+		}
+		volumes = append(volumes, core.Volume{
+			Name: "audit-config",
+			VolumeSource: core.VolumeSource{
+				ConfigMap: &core.ConfigMapVolumeSource{
+					LocalObjectReference: core.LocalObjectReference{
+						Name: c.auditConfigName(px),
+					},
+				},
+			},
+		})
+		volumeMounts = append(volumeMounts, core.VolumeMount{
+			Name:      "audit-config",
+			MountPath: auditConfigMountPath + auditConfigFileName,
+			SubPath:   auditConfigFileName,
+		})
+
+		// the audit file lands on the log volume when one is declared,
+		// otherwise on a dedicated emptyDir shared with the forwarder
+		logVolumeName := "audit-log"
+		if px.Spec.LogStorage != nil && px.Spec.StorageType != api.StorageTypeEphemeral {
+			logVolumeName = "logs"
+		} else {
+			volumes = append(volumes, core.Volume{
+				Name: "audit-log",
+				VolumeSource: core.VolumeSource{
+					EmptyDir: &core.EmptyDirVolumeSource{},
+				},
+			})
+			volumeMounts = append(volumeMounts, core.VolumeMount{
+				Name:      "audit-log",
+				MountPath: api.PerconaXtraDBLogMountPath,
+			})
+		}
+		auditContainer = auditForwarderSidecar(px, logVolumeName, pxVersion.Spec.DB.Image)
+	}
+
+	// serialize spec.wsrepProviderOptions and the spec.replicationPort listen
+	// address into the generated galera config. With replication TLS the
+	// options are merged into the TLS snippet above instead, as the provider
+	// only honors the last wsrep_provider_options line.
+	if px.IsCluster() && galeraProviderOptions(px) != "" {
+		if !(px.Spec.TLS != nil && px.Spec.TLS.IssuerRef != nil) {
+			if err := c.ensureWsrepConfig(px); err != nil {
+				return kutil.VerbUnchanged, err
+			}
+			volumes = append(volumes, core.Volume{
+				Name: "wsrep-config",
+				VolumeSource: core.VolumeSource{
+					ConfigMap: &core.ConfigMapVolumeSource{
+						LocalObjectReference: core.LocalObjectReference{
+							Name: c.wsrepConfigName(px),
+						},
+					},
+				},
+			})
+			volumeMounts = append(volumeMounts, core.VolumeMount{
+				Name:      "wsrep-config",
+				MountPath: api.PerconaXtraDBClusterCustomConfigMountPath + wsrepConfigFileName,
+				SubPath:   wsrepConfigFileName,
+			})
+		}
+		if px.Spec.PodTemplate.Annotations == nil {
+			px.Spec.PodTemplate.Annotations = map[string]string{}
+		}
+		px.Spec.PodTemplate.Annotations[wsrepOptionsHashAnnotation] = wsrepOptionsHash(px)
+	}
+
+	// write spec.sstMethod into the generated galera config. The snippet is a
+	// secret since the xtrabackup method carries the SST user credentials.
+	if px.IsCluster() && px.Spec.SSTMethod != "" {
+		if err := c.ensureSSTConfig(px); err != nil {
+			return kutil.VerbUnchanged, err
+		}
+		volumes = append(volumes, core.Volume{
+			Name: "sst-config",
+			VolumeSource: core.VolumeSource{
+				Secret: &core.SecretVolumeSource{
+					SecretName: c.sstConfigName(px),
+				},
+			},
+		})
+		volumeMounts = append(volumeMounts, core.VolumeMount{
+			Name:      "sst-config",
+			MountPath: api.PerconaXtraDBClusterCustomConfigMountPath + sstConfigFileName,
+			SubPath:   sstConfigFileName,
+		})
+	}
+
+	// enable binary logging and GTID positioning for async source-replica
+	// clusters; the replicas are pointed at the source by the health check
+	// loop once the pods run
+	if px.UsesAsyncReplication() {
+		if err := c.ensureAsyncReplicationConfig(px); err != nil {
+			return kutil.VerbUnchanged, err
+		}
+		volumes = append(volumes, core.Volume{
+			Name: "async-replication-config",
+			VolumeSource: core.VolumeSource{
+				ConfigMap: &core.ConfigMapVolumeSource{
+					LocalObjectReference: core.LocalObjectReference{
+						Name: c.asyncReplicationConfigName(px),
+					},
+				},
+			},
+		})
+		volumeMounts = append(volumeMounts, core.VolumeMount{
+			Name:      "async-replication-config",
+			MountPath: api.PerconaXtraDBClusterCustomConfigMountPath + asyncReplicationConfigFileName,
+			SubPath:   asyncReplicationConfigFileName,
+		})
+	}
+
+	// render the gcomm list with pod IPs when spec.clusterAddressStrategy is
+	// "PodIP", for CNIs whose pod DNS is too slow at startup for joins. The
+	// health check loop keeps the rendered list current.
+	if usesPodIPAddressStrategy(px) {
+		if err := c.ensureClusterAddressConfig(px); err != nil {
+			return kutil.VerbUnchanged, err
+		}
+		volumes = append(volumes, core.Volume{
+			Name: "cluster-address-config",
+			VolumeSource: core.VolumeSource{
+				ConfigMap: &core.ConfigMapVolumeSource{
+					LocalObjectReference: core.LocalObjectReference{
+						Name: c.clusterAddressConfigName(px),
+					},
+				},
+			},
+		})
+		volumeMounts = append(volumeMounts, core.VolumeMount{
+			Name:      "cluster-address-config",
+			MountPath: api.PerconaXtraDBClusterCustomConfigMountPath + clusterAddressConfigFileName,
+			SubPath:   clusterAddressConfigFileName,
+		})
+	}
+
+	// stamp a hash of the user env on the pod template, so env changes are
+	// detected and rolled out like other pod template changes
+	if len(px.Spec.PodTemplate.Spec.Env) > 0 {
+		if px.Spec.PodTemplate.Annotations == nil {
+			px.Spec.PodTemplate.Annotations = map[string]string{}
+		}
+		px.Spec.PodTemplate.Annotations[envHashAnnotation] = envHash(px)
+	}
+
+	configSource, err := c.customConfigSource(px)
+	if err != nil {
+		return kutil.VerbUnchanged, err
+	}
+
+	replicas, err := c.desiredReplicas(px)
+	if err != nil {
+		return kutil.VerbUnchanged, err
+	}
+
+	// when spec.version has moved to a new image, roll it out in pod order and
+	// run mysql_upgrade on each pod as it comes up
+	updating, err := c.isVersionChanging(px, pxVersion.Spec.DB.Image)
+	if err != nil {
+		return kutil.VerbUnchanged, err
+	}
+	// a bumped restart annotation rolls the pods one at a time the same way a
+	// version change does
+	restarting, err := c.isRestartPending(px)
+	if err != nil {
+		return kutil.VerbUnchanged, err
+	}
+
+	// a changed memory limit changes the computed buffer pool size, which has
+	// to be rolled out to the pods the same way
+	retuning, err := c.isBufferPoolChanging(px)
+	if err != nil {
+		return kutil.VerbUnchanged, err
+	}
+
+	// changed wsrep provider options also require a rollout
+	reconfiguring, err := c.isWsrepOptionsChanging(px)
+	if err != nil {
+		return kutil.VerbUnchanged, err
+	}
+	retuning = retuning || reconfiguring
+
+	// changed tolerations or nodeSelector roll the pods, so they actually
+	// move to the newly selected nodes
+	rescheduling, err := c.isSchedulingChanging(px)
+	if err != nil {
+		return kutil.VerbUnchanged, err
+	}
+	retuning = retuning || rescheduling
+
+	// a changed spec.configSecret only rolls the pods when it touches
+	// non-dynamic variables; known-dynamic ones are applied live over a
+	// connection instead
+	reloading, err := c.applyOrRollConfig(px)
+	if err != nil {
+		return kutil.VerbUnchanged, err
+	}
+	retuning = retuning || reloading
+
+	// the binlog expiry variable is dynamic on both 5.7 and 8.0: a changed
+	// spec.binlogRetention is applied live instead of rolling the pods
+	if err := c.applyBinlogRetention(px); err != nil {
+		return kutil.VerbUnchanged, err
+	}
+
+	// max_connections is dynamic as well, but only a raised limit is applied
+	// live; a lowered one waits for the next restart
+	if err := c.applyMaxConnections(px); err != nil {
+		return kutil.VerbUnchanged, err
+	}
+
+	// changed user env only takes effect on container start, so it has to be
+	// rolled out as well
+	envChanging, err := c.isEnvChanging(px)
+	if err != nil {
+		return kutil.VerbUnchanged, err
+	}
+	retuning = retuning || envChanging
+
+	// user pod labels likewise only reach the pods at creation
+	relabeling, err := c.isPodLabelsChanging(px)
+	if err != nil {
+		return kutil.VerbUnchanged, err
+	}
+	retuning = retuning || relabeling
+
+	newReconcileTracer(px).Tracef("StatefulSet diff: replicas=%v updating=%v restarting=%v retuning=%v",
+		types.Int32(replicas), updating, restarting, retuning)
+
+	// disruptive rollouts wait for the maintenance window. Everything ensured
+	// before this point does not touch the running pods and has already been
+	// applied.
+	if (updating || restarting || retuning) && !px.MaintenanceWindowActive(time.Now()) {
+		if err := c.setMaintenancePending(px); err != nil {
+			return kutil.VerbUnchanged, err
 		}
+		log.Infof("PerconaXtraDB %v/%v has a disruptive change queued; waiting for the maintenance window", px.Namespace, px.Name)
+		return kutil.VerbUnchanged, nil
+	}
+
+	updateStrategy := apps.StatefulSetUpdateStrategy{
+		Type: apps.OnDeleteStatefulSetStrategyType,
+	}
+	if updating {
+		if err := c.prepareVersionUpdate(px); err != nil {
+			return kutil.VerbUnchanged, err
+		}
+	}
+	if restarting {
+		if err := c.prepareRestart(px); err != nil {
+			return kutil.VerbUnchanged, err
+		}
+	}
+	// an armed full-outage recovery also switches to RollingUpdate, so the
+	// template change with the recovery init container propagates. It skips
+	// the maintenance window gate above: the cluster is already down.
+	recovering := px.IsCluster() && px.Annotations[bootstrapPodAnnotation] != ""
+	if updating || restarting || retuning || recovering {
+		updateStrategy = apps.StatefulSetUpdateStrategy{
+			Type: apps.RollingUpdateStatefulSetStrategyType,
+		}
+		// a canary rollout starts with every pod held back behind the
+		// partition; the canary reconciler steps it down one pod at a time as
+		// the updated pods pass their health checks. A full-outage recovery
+		// must reach all pods at once, so it ignores the canary strategy.
+		if px.UsesCanaryRollout() && !recovering {
+			updateStrategy.RollingUpdate = &apps.RollingUpdateStatefulSetStrategy{
+				Partition: types.Int32P(types.Int32(replicas)),
+			}
+		}
+	}
+
+	// shut the server down in a controlled manner before the kubelet kills the
+	// container. Desyncing first lets a cluster node leave the group cleanly,
+	// so the remaining nodes do not attempt SST recovery. A user-provided
+	// preStop hook, i.e. deregistering from external service discovery, runs
+	// first with the shutdown appended after it.
+	shutdownCmd := `mysqladmin -uroot -p"${MYSQL_ROOT_PASSWORD}" shutdown`
+	if px.IsCluster() {
+		shutdownCmd = `mysql -uroot -p"${MYSQL_ROOT_PASSWORD}" -e "SET GLOBAL wsrep_desync = ON" || true
+mysqladmin -uroot -p"${MYSQL_ROOT_PASSWORD}" shutdown`
 	}
+	if px.Spec.PodTemplate.Spec.Lifecycle == nil {
+		px.Spec.PodTemplate.Spec.Lifecycle = &core.Lifecycle{}
+	}
+	px.Spec.PodTemplate.Spec.Lifecycle.PreStop = mergeExecHook(px.Spec.PodTemplate.Spec.Lifecycle.PreStop, shutdownCmd, false)
 
 	opts := workloadOptions{
-		stsName:          px.OffshootName(),
-		labels:           px.OffshootLabels(),
-		selectors:        px.OffshootSelectors(),
-		conatainerName:   api.ResourceSingularPerconaXtraDB,
-		image:            pxVersion.Spec.DB.Image,
-		args:             args,
-		cmd:              cmds,
-		ports:            ports,
-		envList:          envList,
-		initContainers:   initContainers,
-		gvrSvcName:       c.GoverningService,
-		podTemplate:      &px.Spec.PodTemplate,
-		configSource:     px.Spec.ConfigSource,
-		pvcSpec:          px.Spec.Storage,
-		replicas:         px.Spec.Replicas,
-		volume:           volumes,
-		volumeMount:      volumeMounts,
-		monitorContainer: &monitorContainer,
-	}
-
-	return c.ensureStatefulSet(px, opts)
+		stsName:              px.OffshootName(),
+		labels:               px.OffshootLabels(),
+		selectors:            px.OffshootSelectors(),
+		conatainerName:       api.ResourceSingularPerconaXtraDB,
+		image:                pxVersion.Spec.DB.Image,
+		args:                 args,
+		cmd:                  cmds,
+		ports:                ports,
+		envList:              envList,
+		initContainers:       initContainers,
+		gvrSvcName:           c.GoverningService,
+		podTemplate:          &px.Spec.PodTemplate,
+		configSource:         configSource,
+		pvcSpec:              px.Spec.Storage,
+		replicas:             replicas,
+		volume:               volumes,
+		volumeMount:          volumeMounts,
+		monitorContainer:     &monitorContainer,
+		proxysqlContainer:    proxysqlContainer,
+		coordinatorContainer: coordContainer,
+		auditContainer:       auditContainer,
+		updateStrategy:       updateStrategy,
+	}
+
+	vt, err := c.ensureStatefulSet(px, opts)
+	if err != nil {
+		return vt, err
+	}
+	if err := c.ensureArbiter(px, pxVersion); err != nil {
+		return vt, err
+	}
+	if updating {
+		if err := c.setUpdateCondition(px, api.DatabaseUpdated, "Database finished rolling out the new version"); err != nil {
+			return vt, err
+		}
+	}
+	if restarting {
+		if err := c.finishRestart(px); err != nil {
+			return vt, err
+		}
+	}
+	if err := c.clearMaintenancePending(px); err != nil {
+		return vt, err
+	}
+	return vt, nil
+}
+
+// collectorArgs translates the collector names from
+// spec.monitor.prometheus.exporter.collectors into mysqld_exporter flags. A
+// leading "-" disables a collector the exporter enables by default.
+func collectorArgs(collectors []string) []string {
+	var args []string
+	for _, collector := range collectors {
+		if strings.HasPrefix(collector, "-") {
+			args = append(args, "--no-collect."+strings.TrimPrefix(collector, "-"))
+		} else {
+			args = append(args, "--collect."+collector)
+		}
+	}
+	return args
+}
+
+// customConfigSource returns the volume source for the custom configuration.
+// When spec.configSecret is set, the user provided config and the Secret are
+// projected into a single volume with the Secret listed last, so its values
+// take precedence over the user my.cnf. It also stamps a checksum annotation
+// over both sources on the pod template, so that changing either one triggers
+// a rolling restart.
+func (c *Controller) customConfigSource(px *api.PerconaXtraDB) (*core.VolumeSource, error) {
+	configSource := px.Spec.ConfigSource
+	if px.Spec.ConfigSecret == nil {
+		return configSource, nil
+	}
+
+	var sources []core.VolumeProjection
+	if configSource != nil {
+		if configSource.ConfigMap != nil {
+			sources = append(sources, core.VolumeProjection{
+				ConfigMap: &core.ConfigMapProjection{
+					LocalObjectReference: configSource.ConfigMap.LocalObjectReference,
+					Items:                configSource.ConfigMap.Items,
+				},
+			})
+		} else if configSource.Secret != nil {
+			sources = append(sources, core.VolumeProjection{
+				Secret: &core.SecretProjection{
+					LocalObjectReference: core.LocalObjectReference{
+						Name: configSource.Secret.SecretName,
+					},
+					Items: configSource.Secret.Items,
+				},
+			})
+		}
+	}
+	sources = append(sources, core.VolumeProjection{
+		Secret: &core.SecretProjection{
+			LocalObjectReference: *px.Spec.ConfigSecret,
+		},
+	})
+
+	configHash, err := c.customConfigHash(px)
+	if err != nil {
+		return nil, err
+	}
+	if px.Spec.PodTemplate.Annotations == nil {
+		px.Spec.PodTemplate.Annotations = map[string]string{}
+	}
+	px.Spec.PodTemplate.Annotations[customConfigHashAnnotation] = configHash
+
+	return &core.VolumeSource{
+		Projected: &core.ProjectedVolumeSource{
+			Sources: sources,
+		},
+	}, nil
+}
+
+// customConfigHash returns a hash over the contents of the custom config
+// sources. Sources that do not exist yet are skipped instead of failing the
+// reconcile.
+func (c *Controller) customConfigHash(px *api.PerconaXtraDB) (string, error) {
+	objs := make(map[string]string, 2)
+	if px.Spec.ConfigSource != nil && px.Spec.ConfigSource.ConfigMap != nil {
+		cm, err := c.Client.CoreV1().ConfigMaps(px.Namespace).Get(context.TODO(), px.Spec.ConfigSource.ConfigMap.Name, metav1.GetOptions{})
+		if err != nil && !kerr.IsNotFound(err) {
+			return "", err
+		} else if err == nil {
+			objs["configMap"] = meta_util.ObjectHash(cm)
+		}
+	}
+	if px.Spec.ConfigSecret != nil {
+		secret, err := c.Client.CoreV1().Secrets(px.Namespace).Get(context.TODO(), px.Spec.ConfigSecret.Name, metav1.GetOptions{})
+		if err != nil && !kerr.IsNotFound(err) {
+			return "", err
+		} else if err == nil {
+			objs["configSecret"] = meta_util.ObjectHash(secret)
+		}
+	}
+
+	h := fnv.New64a()
+	meta_util.DeepHashObject(h, objs)
+	return strconv.FormatUint(h.Sum64(), 10), nil
 }
 
 func (c *Controller) checkStatefulSet(px *api.PerconaXtraDB, stsName string) error {
@@ -245,6 +1116,184 @@ func upsertCustomConfig(
 	return template
 }
 
+// defaultAffinity returns the pod anti-affinity the operator ships for cluster
+// mode: prefer spreading the nodes of this one database across hosts. The
+// selector is scoped to the offshoot selectors, which carry the instance name,
+// so two databases never repel each other's pods. Standalone databases get no
+// affinity, and a user-declared spec.podTemplate.spec.affinity replaces the
+// generated one entirely.
+func defaultAffinity(px *api.PerconaXtraDB) *core.Affinity {
+	if !px.IsCluster() {
+		return nil
+	}
+	return &core.Affinity{
+		PodAntiAffinity: &core.PodAntiAffinity{
+			PreferredDuringSchedulingIgnoredDuringExecution: []core.WeightedPodAffinityTerm{
+				{
+					Weight: 100,
+					PodAffinityTerm: core.PodAffinityTerm{
+						TopologyKey: core.LabelHostname,
+						LabelSelector: &metav1.LabelSelector{
+							MatchLabels: px.OffshootSelectors(),
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// defaultReadinessProbe returns the readiness check the operator ships for the
+// database container. For cluster mode, the probe also requires the node to be
+// synced with the group, so that joining nodes stay out of the services until
+// SST has finished.
+func defaultReadinessProbe(px *api.PerconaXtraDB) *core.Probe {
+	cmd := `mysqladmin -uroot -p"${MYSQL_ROOT_PASSWORD}" ping`
+	if px.IsCluster() {
+		cmd = `state=$(mysql -uroot -p"${MYSQL_ROOT_PASSWORD}" -NBe "SHOW STATUS LIKE 'wsrep_local_state_comment'" | awk '{print $2}')
+[ "$state" == "Synced" ] || [ "$state" == "Donor/Desynced" ]`
+		// with the coordinator sidecar the evaluation happens out of band and
+		// the probe only consults its verdict
+		if px.Spec.Coordinator != nil {
+			cmd = "test -f " + coordinatorReadyFile
+		}
+	}
+	return &core.Probe{
+		Handler: core.Handler{
+			Exec: &core.ExecAction{
+				Command: []string{"bash", "-c", cmd},
+			},
+		},
+		InitialDelaySeconds: 60,
+		PeriodSeconds:       10,
+		TimeoutSeconds:      50,
+		SuccessThreshold:    1,
+		FailureThreshold:    3,
+	}
+}
+
+// defaultStartupProbe returns the startup check the operator ships for the
+// database container. InnoDB crash recovery scales with the data on disk, so
+// the probe's failure budget grows with the requested storage size: five
+// minutes base plus a minute per requested GiB. The kubelet holds the liveness
+// and readiness probes back until the startup probe has passed, so a slow
+// recovery is never mistaken for a dead container.
+func defaultStartupProbe(px *api.PerconaXtraDB) *core.Probe {
+	failureThreshold := int32(30)
+	if px.Spec.Storage != nil {
+		if request, found := px.Spec.Storage.Resources.Requests[core.ResourceStorage]; found {
+			failureThreshold += int32(request.Value() / (1 << 30) * 6)
+		}
+	}
+	return &core.Probe{
+		Handler: core.Handler{
+			Exec: &core.ExecAction{
+				Command: []string{"bash", "-c", `mysqladmin -uroot -p"${MYSQL_ROOT_PASSWORD}" ping`},
+			},
+		},
+		InitialDelaySeconds: 10,
+		PeriodSeconds:       10,
+		TimeoutSeconds:      10,
+		SuccessThreshold:    1,
+		FailureThreshold:    failureThreshold,
+	}
+}
+
+// mergeProbe overlays the timing fields a user set on a probe in
+// spec.podTemplate.spec on top of the operator default, without clobbering the
+// default command unless the user supplied a handler of their own. Setting the
+// probe to an empty struct disables it entirely, matching the other
+// overridable defaults.
+func mergeProbe(userProbe, defaultProbe *core.Probe) *core.Probe {
+	if userProbe == nil {
+		return defaultProbe
+	}
+	if structs.IsZero(*userProbe) {
+		return nil
+	}
+	probe := defaultProbe.DeepCopy()
+	if userProbe.Exec != nil || userProbe.HTTPGet != nil || userProbe.TCPSocket != nil {
+		probe.Handler = userProbe.Handler
+	}
+	if userProbe.InitialDelaySeconds > 0 {
+		probe.InitialDelaySeconds = userProbe.InitialDelaySeconds
+	}
+	if userProbe.PeriodSeconds > 0 {
+		probe.PeriodSeconds = userProbe.PeriodSeconds
+	}
+	if userProbe.TimeoutSeconds > 0 {
+		probe.TimeoutSeconds = userProbe.TimeoutSeconds
+	}
+	if userProbe.SuccessThreshold > 0 {
+		probe.SuccessThreshold = userProbe.SuccessThreshold
+	}
+	if userProbe.FailureThreshold > 0 {
+		probe.FailureThreshold = userProbe.FailureThreshold
+	}
+	return probe
+}
+
+// isSchedulingChanging reports whether spec.podTemplate moves the pods to
+// different nodes, i.e. its nodeSelector or tolerations differ from the ones
+// on the running StatefulSet. Under the default OnDelete strategy such a
+// change would otherwise leave the running pods on their old nodes forever.
+func (c *Controller) isSchedulingChanging(px *api.PerconaXtraDB) (bool, error) {
+	sts, err := c.Client.AppsV1().StatefulSets(px.Namespace).Get(context.TODO(), px.OffshootName(), metav1.GetOptions{})
+	if err != nil {
+		if kerr.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	pt := px.Spec.PodTemplate
+	if len(pt.Spec.NodeSelector) > 0 && !reflect.DeepEqual(sts.Spec.Template.Spec.NodeSelector, pt.Spec.NodeSelector) {
+		return true, nil
+	}
+	if len(sts.Spec.Template.Spec.Tolerations) != 0 || len(pt.Spec.Tolerations) != 0 {
+		return !reflect.DeepEqual(sts.Spec.Template.Spec.Tolerations, pt.Spec.Tolerations), nil
+	}
+	return false, nil
+}
+
+// envHash returns a hash over the user supplied container env, used to detect
+// env changes on the running pod template.
+func envHash(px *api.PerconaXtraDB) string {
+	h := fnv.New64a()
+	meta_util.DeepHashObject(h, px.Spec.PodTemplate.Spec.Env)
+	return strconv.FormatUint(h.Sum64(), 10)
+}
+
+// isEnvChanging reports whether the running StatefulSet still carries user env
+// different from spec.podTemplate.spec.env, in which case the new values have
+// to be rolled out; env only takes effect on container start.
+func (c *Controller) isEnvChanging(px *api.PerconaXtraDB) (bool, error) {
+	sts, err := c.Client.AppsV1().StatefulSets(px.Namespace).Get(context.TODO(), px.OffshootName(), metav1.GetOptions{})
+	if err != nil {
+		if kerr.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return sts.Spec.Template.Annotations[envHashAnnotation] != px.Spec.PodTemplate.Annotations[envHashAnnotation], nil
+}
+
+// isPodLabelsChanging reports whether the pod template labels of the running
+// StatefulSet differ from the merge of spec.podTemplate.metadata.labels and
+// the selector labels; labels only reach the pods at creation, so a change
+// has to be rolled out.
+func (c *Controller) isPodLabelsChanging(px *api.PerconaXtraDB) (bool, error) {
+	sts, err := c.Client.AppsV1().StatefulSets(px.Namespace).Get(context.TODO(), px.OffshootName(), metav1.GetOptions{})
+	if err != nil {
+		if kerr.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	desired := core_util.UpsertMap(nil, px.Spec.PodTemplate.Labels)
+	desired = core_util.UpsertMap(desired, px.OffshootSelectors())
+	return !reflect.DeepEqual(sts.Spec.Template.Labels, desired), nil
+}
+
 func (c *Controller) ensureStatefulSet(px *api.PerconaXtraDB, opts workloadOptions) (kutil.VerbType, error) {
 	// Take value of podTemplate
 	var pt ofst.PodTemplateSpec
@@ -263,22 +1312,12 @@ func (c *Controller) ensureStatefulSet(px *api.PerconaXtraDB, opts workloadOptio
 
 	owner := metav1.NewControllerRef(px, api.SchemeGroupVersion.WithKind(api.ResourceKindPerconaXtraDB))
 
-	readinessProbe := pt.Spec.ReadinessProbe
-	if readinessProbe != nil && structs.IsZero(*readinessProbe) {
-		readinessProbe = nil
-	}
+	readinessProbe := mergeProbe(pt.Spec.ReadinessProbe, defaultReadinessProbe(px))
+	startupProbe := mergeProbe(pt.Spec.StartupProbe, defaultStartupProbe(px))
 	livenessProbe := pt.Spec.LivenessProbe
 	if livenessProbe != nil && structs.IsZero(*livenessProbe) {
 		livenessProbe = nil
 	}
-
-	if readinessProbe != nil {
-		readinessProbe.InitialDelaySeconds = 60
-		readinessProbe.PeriodSeconds = 10
-		readinessProbe.TimeoutSeconds = 50
-		readinessProbe.SuccessThreshold = 1
-		readinessProbe.FailureThreshold = 3
-	}
 	if livenessProbe != nil {
 		livenessProbe.InitialDelaySeconds = 60
 		livenessProbe.PeriodSeconds = 10
@@ -292,7 +1331,12 @@ func (c *Controller) ensureStatefulSet(px *api.PerconaXtraDB, opts workloadOptio
 		c.Client,
 		statefulSetMeta,
 		func(in *apps.StatefulSet) *apps.StatefulSet {
-			in.Labels = opts.labels
+			// user labels and annotations from spec.podTemplate.controller land
+			// on the StatefulSet object itself, distinct from the pod-level
+			// metadata; the operator's own labels take precedence. Both are
+			// object metadata only and never touch the pod template, so they
+			// cannot trigger a rolling update.
+			in.Labels = core_util.UpsertMap(pt.Controller.Labels, opts.labels)
 			in.Annotations = pt.Controller.Annotations
 			core_util.EnsureOwnerReference(&in.ObjectMeta, owner)
 
@@ -301,8 +1345,14 @@ func (c *Controller) ensureStatefulSet(px *api.PerconaXtraDB, opts workloadOptio
 			in.Spec.Selector = &metav1.LabelSelector{
 				MatchLabels: opts.selectors,
 			}
-			in.Spec.Template.Labels = opts.selectors
+			// user labels from spec.podTemplate.metadata are merged in, with
+			// the operator's selector labels taking precedence
+			in.Spec.Template.Labels = core_util.UpsertMap(pt.Labels, opts.selectors)
 			in.Spec.Template.Annotations = pt.Annotations
+			// user supplied init containers are upserted first and the
+			// operator's own ones afterwards, so the operator init always runs
+			// last. Init containers injected by other controllers (e.g. a Stash
+			// restore) survive the upserts.
 			in.Spec.Template.Spec.InitContainers = core_util.UpsertContainers(
 				in.Spec.Template.Spec.InitContainers,
 				pt.Spec.InitContainers,
@@ -319,9 +1369,14 @@ func (c *Controller) ensureStatefulSet(px *api.PerconaXtraDB, opts workloadOptio
 					Env:             core_util.UpsertEnvVars(opts.envList, pt.Spec.Env...),
 					Resources:       pt.Spec.Resources,
 					Lifecycle:       pt.Spec.Lifecycle,
+					StartupProbe:    startupProbe,
 					LivenessProbe:   livenessProbe,
 					ReadinessProbe:  readinessProbe,
-					VolumeMounts:    opts.volumeMount,
+					// user supplied mounts first, so an operator mount of the
+					// same name wins; the reserved mount paths are guarded by
+					// the validating webhook
+					VolumeMounts:    core_util.UpsertVolumeMount(pt.Spec.VolumeMounts, opts.volumeMount...),
+					SecurityContext: pt.Spec.ContainerSecurityContext,
 				})
 
 			in.Spec.Template.Spec.InitContainers = core_util.UpsertContainers(
@@ -329,33 +1384,110 @@ func (c *Controller) ensureStatefulSet(px *api.PerconaXtraDB, opts workloadOptio
 				opts.initContainers,
 			)
 
-			if opts.monitorContainer != nil && px.Spec.Monitor != nil && px.Spec.Monitor.Agent.Vendor() == mona.VendorPrometheus {
+			if opts.monitorContainer != nil && px.Spec.Monitor != nil && !px.Spec.Monitor.Paused && px.Spec.Monitor.Agent.Vendor() == mona.VendorPrometheus {
 				in.Spec.Template.Spec.Containers = core_util.UpsertContainer(
 					in.Spec.Template.Spec.Containers, *opts.monitorContainer)
 			}
+			// paused monitoring drops the exporter sidecar from the template;
+			// with the OnDelete strategy the running pods are not recreated
+			// for it, the sidecar disappears on their next natural restart
+			if px.Spec.Monitor != nil && px.Spec.Monitor.Paused {
+				in.Spec.Template.Spec.Containers = core_util.EnsureContainerDeleted(
+					in.Spec.Template.Spec.Containers, api.ContainerExporterName)
+			}
 
+			if opts.proxysqlContainer != nil {
+				in.Spec.Template.Spec.Containers = core_util.UpsertContainer(
+					in.Spec.Template.Spec.Containers, *opts.proxysqlContainer)
+			}
+			if opts.coordinatorContainer != nil {
+				in.Spec.Template.Spec.Containers = core_util.UpsertContainer(
+					in.Spec.Template.Spec.Containers, *opts.coordinatorContainer)
+			}
+			if opts.auditContainer != nil {
+				in.Spec.Template.Spec.Containers = core_util.UpsertContainer(
+					in.Spec.Template.Spec.Containers, *opts.auditContainer)
+			}
+
+			// likewise user volumes before the operator's own, so a name
+			// collision resolves in favor of the operator volume
+			in.Spec.Template.Spec.Volumes = core_util.UpsertVolume(in.Spec.Template.Spec.Volumes, pt.Spec.Volumes...)
 			in.Spec.Template.Spec.Volumes = core_util.UpsertVolume(in.Spec.Template.Spec.Volumes, opts.volume...)
 
+			// the replication readiness gate holds lagging async replicas out
+			// of the service endpoints; its condition is maintained by the
+			// operator's async replication check
+			if px.UsesAsyncReplication() && px.MaxReplicationLagSeconds() > 0 {
+				in.Spec.Template.Spec.ReadinessGates = upsertReadinessGate(in.Spec.Template.Spec.ReadinessGates,
+					core.PodReadinessGate{ConditionType: api.PerconaXtraDBReplicationCaughtUpCondition})
+			}
+
 			in = upsertEnv(in, px)
 			in = upsertDataVolume(in, px)
+			in = upsertLogVolume(in, px)
 
 			if opts.configSource != nil {
 				in.Spec.Template = upsertCustomConfig(in.Spec.Template, opts.configSource, types.Int32(px.Spec.Replicas))
 			}
 
-			in.Spec.Template.Spec.NodeSelector = pt.Spec.NodeSelector
+			// nodeSelector and affinity are both enforced: a node has to
+			// satisfy the nodeSelector terms and the affinity rules. An
+			// empty nodeSelector keeps whatever the cluster's admission
+			// defaults put on the template instead of stripping it.
+			if len(pt.Spec.NodeSelector) > 0 {
+				in.Spec.Template.Spec.NodeSelector = pt.Spec.NodeSelector
+			}
 			in.Spec.Template.Spec.Affinity = pt.Spec.Affinity
+			in.Spec.Template.Spec.TopologySpreadConstraints = pt.Spec.TopologySpreadConstraints
 			if pt.Spec.SchedulerName != "" {
 				in.Spec.Template.Spec.SchedulerName = pt.Spec.SchedulerName
 			}
 			in.Spec.Template.Spec.Tolerations = pt.Spec.Tolerations
 			in.Spec.Template.Spec.ImagePullSecrets = pt.Spec.ImagePullSecrets
+			// split-horizon environments resolve cross-cluster peer names,
+			// i.e. in wsrep_cluster_address, through extra search domains; an
+			// empty policy keeps the kubelet's ClusterFirst default
+			if pt.Spec.DNSPolicy != "" {
+				in.Spec.Template.Spec.DNSPolicy = pt.Spec.DNSPolicy
+			}
+			in.Spec.Template.Spec.DNSConfig = pt.Spec.DNSConfig
+			// off by default; sharing the PID namespace lets a debugging
+			// sidecar inspect and signal mysqld. Changing it rolls the pods,
+			// since the pod template changes.
+			in.Spec.Template.Spec.ShareProcessNamespace = pt.Spec.ShareProcessNamespace
 			in.Spec.Template.Spec.PriorityClassName = pt.Spec.PriorityClassName
 			in.Spec.Template.Spec.Priority = pt.Spec.Priority
-			in.Spec.Template.Spec.SecurityContext = pt.Spec.SecurityContext
+			// the user's pod securityContext is honored, but fsGroup falls
+			// back to the mysql group of the image, so the data volume stays
+			// writable for mysqld
+			psc := pt.Spec.SecurityContext.DeepCopy()
+			if psc == nil {
+				psc = &core.PodSecurityContext{}
+			}
+			if psc.FSGroup == nil {
+				psc.FSGroup = types.Int64P(api.PerconaXtraDBMySQLGroupID)
+			}
+			in.Spec.Template.Spec.SecurityContext = psc
 			in.Spec.Template.Spec.ServiceAccountName = pt.Spec.ServiceAccountName
-			in.Spec.UpdateStrategy = apps.StatefulSetUpdateStrategy{
-				Type: apps.OnDeleteStatefulSetStrategyType,
+			in.Spec.Template.Spec.TerminationGracePeriodSeconds = pt.Spec.TerminationGracePeriodSeconds
+			if in.Spec.Template.Spec.TerminationGracePeriodSeconds == nil {
+				in.Spec.Template.Spec.TerminationGracePeriodSeconds = types.Int64P(defaultTerminationGracePeriodSeconds)
+			}
+			// a canary rollout already underway keeps its stepped-down
+			// partition instead of being reset to the full hold on every
+			// reconcile; aborting restores the hold through the canary
+			// reconciler
+			previous := in.Spec.UpdateStrategy.RollingUpdate
+			in.Spec.UpdateStrategy = opts.updateStrategy
+			if in.Spec.UpdateStrategy.RollingUpdate != nil && previous != nil && previous.Partition != nil &&
+				*previous.Partition < types.Int32(in.Spec.UpdateStrategy.RollingUpdate.Partition) &&
+				!canaryAborted(px) {
+				in.Spec.UpdateStrategy.RollingUpdate = previous
+			}
+			if in.Spec.UpdateStrategy.Type == "" {
+				in.Spec.UpdateStrategy = apps.StatefulSetUpdateStrategy{
+					Type: apps.OnDeleteStatefulSetStrategyType,
+				}
 			}
 
 			return in
@@ -366,6 +1498,8 @@ func (c *Controller) ensureStatefulSet(px *api.PerconaXtraDB, opts workloadOptio
 	if err != nil {
 		return kutil.VerbUnchanged, err
 	}
+	newReconcileTracer(px).Tracef("StatefulSet %v %v: image=%v replicas=%v strategy=%v",
+		opts.stsName, vt, opts.image, types.Int32(statefulSet.Spec.Replicas), statefulSet.Spec.UpdateStrategy.Type)
 
 	// Check StatefulSet Pod status
 	if vt != kutil.VerbUnchanged {
@@ -384,6 +1518,17 @@ func (c *Controller) ensureStatefulSet(px *api.PerconaXtraDB, opts workloadOptio
 	return vt, nil
 }
 
+// upsertReadinessGate adds a readiness gate unless one with the same condition
+// type is already present.
+func upsertReadinessGate(gates []core.PodReadinessGate, gate core.PodReadinessGate) []core.PodReadinessGate {
+	for _, g := range gates {
+		if g.ConditionType == gate.ConditionType {
+			return gates
+		}
+	}
+	return append(gates, gate)
+}
+
 func upsertDataVolume(statefulSet *apps.StatefulSet, px *api.PerconaXtraDB) *apps.StatefulSet {
 	for i, container := range statefulSet.Spec.Template.Spec.Containers {
 		if container.Name == api.ResourceSingularPerconaXtraDB {
@@ -419,9 +1564,12 @@ func upsertDataVolume(statefulSet *apps.StatefulSet, px *api.PerconaXtraDB) *app
 					log.Infof(`Using "%v" as AccessModes in .spec.storage`, core.ReadWriteOnce)
 				}
 
+				// PVCs spawned from the template carry the offshoot selector
+				// labels, so termination handling can select them
 				claim := core.PersistentVolumeClaim{
 					ObjectMeta: metav1.ObjectMeta{
-						Name: "data",
+						Name:   "data",
+						Labels: px.OffshootSelectors(),
 					},
 					Spec: *pvcSpec,
 				}
@@ -438,10 +1586,54 @@ func upsertDataVolume(statefulSet *apps.StatefulSet, px *api.PerconaXtraDB) *app
 	return statefulSet
 }
 
+// upsertLogVolume adds a separate volume for the binary and error logs when
+// spec.logStorage declares one, i.e. on a cheaper storage class than the data
+// volume. Without it the logs simply live on the data volume.
+func upsertLogVolume(statefulSet *apps.StatefulSet, px *api.PerconaXtraDB) *apps.StatefulSet {
+	if px.Spec.LogStorage == nil || px.Spec.StorageType == api.StorageTypeEphemeral {
+		return statefulSet
+	}
+
+	for i, container := range statefulSet.Spec.Template.Spec.Containers {
+		if container.Name == api.ResourceSingularPerconaXtraDB {
+			statefulSet.Spec.Template.Spec.Containers[i].VolumeMounts = core_util.UpsertVolumeMount(
+				container.VolumeMounts,
+				core.VolumeMount{
+					Name:      "logs",
+					MountPath: api.PerconaXtraDBLogMountPath,
+				})
+
+			pvcSpec := px.Spec.LogStorage
+			if len(pvcSpec.AccessModes) == 0 {
+				pvcSpec.AccessModes = []core.PersistentVolumeAccessMode{
+					core.ReadWriteOnce,
+				}
+				log.Infof(`Using "%v" as AccessModes in .spec.logStorage`, core.ReadWriteOnce)
+			}
+
+			claim := core.PersistentVolumeClaim{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   "logs",
+					Labels: px.OffshootSelectors(),
+				},
+				Spec: *pvcSpec,
+			}
+			if pvcSpec.StorageClassName != nil {
+				claim.Annotations = map[string]string{
+					"volume.beta.kubernetes.io/storage-class": *pvcSpec.StorageClassName,
+				}
+			}
+			statefulSet.Spec.VolumeClaimTemplates = core_util.UpsertVolumeClaim(statefulSet.Spec.VolumeClaimTemplates, claim)
+			break
+		}
+	}
+	return statefulSet
+}
+
 // upsertUserEnv add/overwrite env from user provided env in crd spec
 func upsertEnv(statefulSet *apps.StatefulSet, px *api.PerconaXtraDB) *apps.StatefulSet {
 	for i, container := range statefulSet.Spec.Template.Spec.Containers {
-		if container.Name == api.ResourceSingularPerconaXtraDB || container.Name == "exporter" {
+		if container.Name == api.ResourceSingularPerconaXtraDB || container.Name == coordinatorContainerName {
 			envs := []core.EnvVar{
 				{
 					Name: "MYSQL_ROOT_PASSWORD",
@@ -467,6 +1659,35 @@ func upsertEnv(statefulSet *apps.StatefulSet, px *api.PerconaXtraDB) *apps.State
 				},
 			}
 
+			statefulSet.Spec.Template.Spec.Containers[i].Env = core_util.UpsertEnvVars(container.Env, envs...)
+		} else if container.Name == api.ContainerExporterName {
+			// the exporter authenticates with the dedicated monitoring user
+			// instead of root, so a compromised sidecar cannot write data
+			envs := []core.EnvVar{
+				{
+					Name: "MONITOR_PASSWORD",
+					ValueFrom: &core.EnvVarSource{
+						SecretKeyRef: &core.SecretKeySelector{
+							LocalObjectReference: core.LocalObjectReference{
+								Name: exporterSecretName(px),
+							},
+							Key: core.BasicAuthPasswordKey,
+						},
+					},
+				},
+				{
+					Name: "MONITOR_USERNAME",
+					ValueFrom: &core.EnvVarSource{
+						SecretKeyRef: &core.SecretKeySelector{
+							LocalObjectReference: core.LocalObjectReference{
+								Name: exporterSecretName(px),
+							},
+							Key: core.BasicAuthUsernameKey,
+						},
+					},
+				},
+			}
+
 			statefulSet.Spec.Template.Spec.Containers[i].Env = core_util.UpsertEnvVars(container.Env, envs...)
 		}
 	}
@@ -0,0 +1,74 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+
+	"github.com/appscode/go/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// TestDefaultAffinityScopedToInstance checks that the generated anti-affinity
+// only repels pods of the same database: each cluster spreads its own nodes
+// across hosts, while the pods of two different clusters in one namespace can
+// still land on the same host.
+func TestDefaultAffinityScopedToInstance(t *testing.T) {
+	newCluster := func(name string) *api.PerconaXtraDB {
+		return &api.PerconaXtraDB{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "demo",
+			},
+			Spec: api.PerconaXtraDBSpec{
+				Replicas: types.Int32P(3),
+			},
+		}
+	}
+	alpha := newCluster("alpha")
+	beta := newCluster("beta")
+
+	affinity := defaultAffinity(alpha)
+	if affinity == nil || affinity.PodAntiAffinity == nil {
+		t.Fatal("expected a generated anti-affinity for a cluster")
+	}
+	terms := affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution
+	if len(terms) != 1 {
+		t.Fatalf("expected one preferred anti-affinity term, got %d", len(terms))
+	}
+	selector, err := metav1.LabelSelectorAsSelector(terms[0].PodAffinityTerm.LabelSelector)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !selector.Matches(labels.Set(alpha.OffshootSelectors())) {
+		t.Error("anti-affinity of alpha does not match alpha's own pods, so they would not spread")
+	}
+	if selector.Matches(labels.Set(beta.OffshootSelectors())) {
+		t.Error("anti-affinity of alpha matches beta's pods, so two clusters could not co-schedule")
+	}
+
+	if got := defaultAffinity(&api.PerconaXtraDB{
+		ObjectMeta: metav1.ObjectMeta{Name: "solo", Namespace: "demo"},
+		Spec:       api.PerconaXtraDBSpec{Replicas: types.Int32P(1)},
+	}); got != nil {
+		t.Error("expected no generated affinity for a standalone database")
+	}
+}
@@ -0,0 +1,218 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+	"kubedb.dev/apimachinery/client/clientset/versioned/typed/kubedb/v1alpha2/util"
+	"kubedb.dev/apimachinery/pkg/eventer"
+
+	"github.com/appscode/go/log"
+	"github.com/appscode/go/types"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	kmapi "kmodules.xyz/client-go/api/v1"
+	core_util "kmodules.xyz/client-go/core/v1"
+)
+
+// isDataClaim reports whether a PVC belongs to the "data" volume claim
+// template of the database StatefulSet. The optional log volume claims carry
+// the same offshoot labels, so a label selector alone cannot tell the two
+// apart; the StatefulSet claim naming scheme data-<pod> can.
+func isDataClaim(px *api.PerconaXtraDB, claimName string) bool {
+	return strings.HasPrefix(claimName, "data-"+px.OffshootName()+"-")
+}
+
+// expandStorage patches the requested size of the database PVCs when
+// spec.storage.resources.requests.storage has grown. It must run before the
+// StatefulSet is patched, so that the pod template is only updated after the
+// PVCs accepted the new size.
+func (c *Controller) expandStorage(px *api.PerconaXtraDB) error {
+	if px.Spec.StorageType != api.StorageTypeDurable || px.Spec.Storage == nil {
+		return nil
+	}
+	desired, found := px.Spec.Storage.Resources.Requests[core.ResourceStorage]
+	if !found {
+		return nil
+	}
+
+	pvcList, err := c.Client.CoreV1().PersistentVolumeClaims(px.Namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(px.OffshootSelectors()).String(),
+	})
+	if err != nil {
+		return err
+	}
+
+	// only the data volume claims are resized; log volumes take their size
+	// from spec.logStorage
+	var dataPVCs []*core.PersistentVolumeClaim
+	for i := range pvcList.Items {
+		if isDataClaim(px, pvcList.Items[i].Name) {
+			dataPVCs = append(dataPVCs, &pvcList.Items[i])
+		}
+	}
+
+	var expanding bool
+	expanded := len(dataPVCs) == int(types.Int32(px.Spec.Replicas))
+	for _, pvc := range dataPVCs {
+		if capacity, ok := pvc.Status.Capacity[core.ResourceStorage]; !ok || capacity.Cmp(desired) < 0 {
+			expanded = false
+		}
+
+		current := pvc.Spec.Resources.Requests[core.ResourceStorage]
+		if current.Cmp(desired) >= 0 {
+			continue
+		}
+
+		allowed, err := c.storageClassAllowsExpansion(pvc.Spec.StorageClassName)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			c.Recorder.Eventf(
+				px,
+				core.EventTypeWarning,
+				eventer.EventReasonFailedToUpdate,
+				`Cannot expand PVC "%v/%v". StorageClass %q does not allow volume expansion`,
+				pvc.Namespace, pvc.Name, types.String(pvc.Spec.StorageClassName),
+			)
+			return nil
+		}
+
+		if _, _, err := core_util.PatchPVC(context.TODO(), c.Client, pvc, func(in *core.PersistentVolumeClaim) *core.PersistentVolumeClaim {
+			in.Spec.Resources.Requests[core.ResourceStorage] = desired
+			return in
+		}, metav1.PatchOptions{}); err != nil {
+			return err
+		}
+		expanding = true
+	}
+
+	if expanding {
+		return c.setStorageCondition(px, api.DatabaseStorageExpanding, "PVC storage requests are being expanded")
+	}
+	if expanded && kmapi.IsConditionTrue(px.Status.Conditions, api.DatabaseStorageExpanding) {
+		return c.setStorageCondition(px, api.DatabaseStorageExpanded, "PVC storage requests have been expanded")
+	}
+	return nil
+}
+
+func (c *Controller) setStorageCondition(px *api.PerconaXtraDB, condType, msg string) error {
+	per, err := util.UpdatePerconaXtraDBStatus(context.TODO(), c.DBClient.KubedbV1alpha2(), px.ObjectMeta, func(in *api.PerconaXtraDBStatus) *api.PerconaXtraDBStatus {
+		if condType == api.DatabaseStorageExpanded {
+			in.Conditions = kmapi.RemoveCondition(in.Conditions, api.DatabaseStorageExpanding)
+		}
+		in.Conditions = kmapi.SetCondition(in.Conditions, kmapi.NewCondition(condType, msg, px.Generation))
+		return in
+	}, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+	px.Status = per.Status
+	return nil
+}
+
+// storageExpandCooldown is the minimum time between two automatic storage
+// expansions of the same database.
+const storageExpandCooldown = 10 * time.Minute
+
+// autoExpandStorage grows spec.storage.resources.requests.storage by the
+// increment from spec.storageAutoScaler, capped at its max size. The regular
+// reconcile then picks the new request up and expands the PVCs through
+// expandStorage. scName is the StorageClass of the existing PVCs.
+func (c *Controller) autoExpandStorage(px *api.PerconaXtraDB, usagePercent int32, scName *string) error {
+	sas := px.Spec.StorageAutoScaler
+	if sas.ScalingIncrement == nil || px.Spec.Storage == nil {
+		return nil
+	}
+	current := px.Spec.Storage.Resources.Requests[core.ResourceStorage]
+	if sas.MaxStorage != nil && current.Cmp(*sas.MaxStorage) >= 0 {
+		log.Warningf("PerconaXtraDB %v/%v is %d%% full, but its storage request already reached the %v cap",
+			px.Namespace, px.Name, usagePercent, sas.MaxStorage)
+		return nil
+	}
+
+	allowed, err := c.storageClassAllowsExpansion(scName)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		log.Warningf("cannot auto expand storage of PerconaXtraDB %v/%v. StorageClass %q does not allow volume expansion",
+			px.Namespace, px.Name, types.String(scName))
+		return nil
+	}
+
+	if !c.shouldExpandStorage(px) {
+		return nil
+	}
+
+	desired := current.DeepCopy()
+	desired.Add(*sas.ScalingIncrement)
+	if sas.MaxStorage != nil && desired.Cmp(*sas.MaxStorage) > 0 {
+		desired = sas.MaxStorage.DeepCopy()
+	}
+
+	per, _, err := util.PatchPerconaXtraDB(context.TODO(), c.DBClient.KubedbV1alpha2(), px, func(in *api.PerconaXtraDB) *api.PerconaXtraDB {
+		in.Spec.Storage.Resources.Requests[core.ResourceStorage] = desired
+		return in
+	}, metav1.PatchOptions{})
+	if err != nil {
+		return err
+	}
+	px.Spec.Storage = per.Spec.Storage
+
+	c.Recorder.Eventf(
+		px,
+		core.EventTypeNormal,
+		api.DatabaseStorageExpanded,
+		"Storage request of PerconaXtraDB %v/%v auto expanded from %v to %v. Datadir usage was %d%%",
+		px.Namespace, px.Name, &current, &desired, usagePercent,
+	)
+	return nil
+}
+
+// shouldExpandStorage rate-limits automatic expansions to one per cooldown
+// period per database.
+func (c *Controller) shouldExpandStorage(px *api.PerconaXtraDB) bool {
+	key := px.Namespace + "/" + px.Name
+
+	c.expandMutex.Lock()
+	defer c.expandMutex.Unlock()
+	if last, ok := c.lastStorageExpand[key]; ok && time.Since(last) < storageExpandCooldown {
+		return false
+	}
+	c.lastStorageExpand[key] = time.Now()
+	return true
+}
+
+// storageClassAllowsExpansion returns whether the named StorageClass has
+// allowVolumeExpansion set.
+func (c *Controller) storageClassAllowsExpansion(scName *string) (bool, error) {
+	if scName == nil {
+		return false, nil
+	}
+	sc, err := c.Client.StorageV1().StorageClasses().Get(context.TODO(), *scName, metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+	return sc.AllowVolumeExpansion != nil && *sc.AllowVolumeExpansion, nil
+}
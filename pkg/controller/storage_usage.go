@@ -0,0 +1,179 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+	"kubedb.dev/apimachinery/client/clientset/versioned/typed/kubedb/v1alpha2/util"
+
+	"github.com/appscode/go/log"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	kmapi "kmodules.xyz/client-go/api/v1"
+)
+
+// storageUsageTick is how often the datadir usage of the monitored databases
+// is measured.
+const storageUsageTick = time.Minute
+
+// RunStorageUsageChecker periodically compares the datadir usage of every pod
+// against its PVC capacity for databases with spec.storageAutoScaler set.
+// Crossing the usage threshold raises a StorageNearFull condition and a
+// warning event, giving operators time to act before the disk fills up.
+func (c *Controller) RunStorageUsageChecker(stopCh <-chan struct{}) {
+	go wait.Until(c.checkStorageUsage, storageUsageTick, stopCh)
+}
+
+func (c *Controller) checkStorageUsage() {
+	dbs, err := c.pxLister.PerconaXtraDBs(core.NamespaceAll).List(labels.Everything())
+	if err != nil {
+		log.Errorf("failed to list PerconaXtraDBs for storage usage check. Reason: %v", err)
+		return
+	}
+	for _, px := range dbs {
+		if px.StorageUsageThresholdPercent() == 0 ||
+			px.Spec.StorageType != api.StorageTypeDurable ||
+			px.Spec.Halted ||
+			px.Status.Phase == "" || px.Status.Phase == api.DatabasePhaseProvisioning {
+			continue
+		}
+		if err := c.checkDatadirUsage(px.DeepCopy()); err != nil {
+			log.Errorf("failed to check storage usage of PerconaXtraDB %v/%v. Reason: %v", px.Namespace, px.Name, err)
+		}
+	}
+}
+
+// checkDatadirUsage measures the datadir usage of every running pod and
+// reconciles the StorageNearFull condition against the threshold from
+// spec.storageAutoScaler.
+func (c *Controller) checkDatadirUsage(px *api.PerconaXtraDB) error {
+	pods, err := c.Client.CoreV1().Pods(px.Namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(px.OffshootSelectors()).String(),
+	})
+	if err != nil {
+		return err
+	}
+	pvcs, err := c.Client.CoreV1().PersistentVolumeClaims(px.Namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(px.OffshootSelectors()).String(),
+	})
+	if err != nil {
+		return err
+	}
+	capacities := make(map[string]int64, len(pvcs.Items))
+	for i := range pvcs.Items {
+		pvc := &pvcs.Items[i]
+		// log volume claims carry the same labels; only the data claims count
+		if !isDataClaim(px, pvc.Name) {
+			continue
+		}
+		if capacity, ok := pvc.Status.Capacity[core.ResourceStorage]; ok {
+			capacities[pvc.Name] = capacity.Value()
+		}
+	}
+
+	var worst int32
+	var usages []string
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Status.PodIP == "" {
+			continue
+		}
+		capacity := capacities["data-"+pod.Name]
+		if capacity == 0 {
+			continue
+		}
+		used, err := c.podDatadirUsage(px, pod.Status.PodIP)
+		if err != nil {
+			usages = append(usages, fmt.Sprintf("%s: unreachable", pod.Name))
+			continue
+		}
+		percent := int32(used * 100 / capacity)
+		usages = append(usages, fmt.Sprintf("%s: %d%%", pod.Name, percent))
+		if percent > worst {
+			worst = percent
+		}
+	}
+	if len(usages) == 0 {
+		return nil
+	}
+
+	threshold := px.StorageUsageThresholdPercent()
+	if worst >= threshold {
+		c.Recorder.Eventf(
+			px,
+			core.EventTypeWarning,
+			api.DatabaseStorageNearFull,
+			"Datadir usage of PerconaXtraDB %v/%v crossed %d%%. %s",
+			px.Namespace, px.Name, threshold, strings.Join(usages, "; "),
+		)
+		if err := c.setStorageNearFullCondition(px, true,
+			fmt.Sprintf("Datadir usage crossed %d%% of the PVC capacity. %s", threshold, strings.Join(usages, "; "))); err != nil {
+			return err
+		}
+	} else if kmapi.HasCondition(px.Status.Conditions, api.DatabaseStorageNearFull) {
+		if err := c.setStorageNearFullCondition(px, false,
+			fmt.Sprintf("Datadir usage is below %d%% of the PVC capacity. %s", threshold, strings.Join(usages, "; "))); err != nil {
+			return err
+		}
+	}
+
+	// automatic expansion builds on the same measurement
+	sas := px.Spec.StorageAutoScaler
+	if sas.ScalingThresholdPercent != nil && worst >= *sas.ScalingThresholdPercent {
+		var scName *string
+		if len(pvcs.Items) > 0 {
+			scName = pvcs.Items[0].Spec.StorageClassName
+		}
+		return c.autoExpandStorage(px, worst, scName)
+	}
+	return nil
+}
+
+func (c *Controller) setStorageNearFullCondition(px *api.PerconaXtraDB, nearFull bool, msg string) error {
+	per, err := util.UpdatePerconaXtraDBStatus(context.TODO(), c.DBClient.KubedbV1alpha2(), px.ObjectMeta, func(in *api.PerconaXtraDBStatus) *api.PerconaXtraDBStatus {
+		in.Conditions = kmapi.SetCondition(in.Conditions, kmapi.NewCondition(api.DatabaseStorageNearFull, msg, px.Generation, nearFull))
+		return in
+	}, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+	px.Status = per.Status
+	return nil
+}
+
+// podDatadirUsage returns the bytes the server occupies on its data volume,
+// approximated from the table statistics of information_schema.
+func (c *Controller) podDatadirUsage(px *api.PerconaXtraDB, podIP string) (int64, error) {
+	en, err := c.connectToPod(px, podIP)
+	if err != nil {
+		return 0, err
+	}
+	defer en.Close()
+
+	var used int64
+	if err := en.QueryRow(`SELECT COALESCE(SUM(data_length + index_length + data_free), 0) FROM information_schema.tables`).Scan(&used); err != nil {
+		return 0, err
+	}
+	return used, nil
+}
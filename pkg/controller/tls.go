@@ -0,0 +1,105 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	core_util "kmodules.xyz/client-go/core/v1"
+	meta_util "kmodules.xyz/client-go/meta"
+)
+
+const (
+	replicationTLSConfigFileName = "galera-tls.cnf"
+	tlsCertHashAnnotation        = api.PerconaXtraDBKey + "/tls-cert-hash"
+)
+
+func (c *Controller) replicationTLSConfigName(px *api.PerconaXtraDB) string {
+	return px.OffshootName() + "-replication-tls-config"
+}
+
+// replicationTLSConfig renders the my.cnf snippet that encrypts Galera SST
+// and replication traffic using the issued replication certificates.
+func replicationTLSConfig(px *api.PerconaXtraDB) string {
+	// the provider only honors the last wsrep_provider_options line it reads,
+	// so the generated options for spec.replicationPort and the user options
+	// from spec.wsrepProviderOptions have to share the line with the SSL
+	// settings
+	providerOptions := fmt.Sprintf("socket.ssl_key=%[1]s/tls.key;socket.ssl_cert=%[1]s/tls.crt;socket.ssl_ca=%[1]s/ca.crt", api.PerconaXtraDBReplicationCertMountPath)
+	if extra := galeraProviderOptions(px); extra != "" {
+		providerOptions = providerOptions + ";" + extra
+	}
+
+	return fmt.Sprintf(`[mysqld]
+wsrep_provider_options="%[2]v"
+
+[sst]
+encrypt=4
+ssl-ca=%[1]s/ca.crt
+ssl-cert=%[1]s/tls.crt
+ssl-key=%[1]s/tls.key
+`, api.PerconaXtraDBReplicationCertMountPath, providerOptions)
+}
+
+// ensureReplicationTLSConfig creates a ConfigMap holding the my.cnf snippet
+// that encrypts Galera SST and replication traffic using the issued
+// replication certificates.
+func (c *Controller) ensureReplicationTLSConfig(px *api.PerconaXtraDB) error {
+	owner := metav1.NewControllerRef(px, api.SchemeGroupVersion.WithKind(api.ResourceKindPerconaXtraDB))
+
+	cnf := replicationTLSConfig(px)
+
+	meta := metav1.ObjectMeta{
+		Name:      c.replicationTLSConfigName(px),
+		Namespace: px.Namespace,
+	}
+
+	_, _, err := core_util.CreateOrPatchConfigMap(context.TODO(), c.Client, meta, func(in *core.ConfigMap) *core.ConfigMap {
+		core_util.EnsureOwnerReference(&in.ObjectMeta, owner)
+		in.Labels = px.OffshootLabels()
+		in.Data = map[string]string{
+			replicationTLSConfigFileName: cnf,
+		}
+		return in
+	}, metav1.PatchOptions{})
+	return err
+}
+
+// tlsCertHash returns a hash over the issued certificate secret contents, so
+// that cert rotation results in a pod template change and thereby a controlled
+// rolling restart instead of leaving stale certs mounted.
+func (c *Controller) tlsCertHash(px *api.PerconaXtraDB, aliases ...api.PerconaXtraDBCertificateAlias) (string, error) {
+	hashes := make(map[string]string, len(aliases))
+	for _, alias := range aliases {
+		secret, err := c.Client.CoreV1().Secrets(px.Namespace).Get(context.TODO(), px.MustCertSecretName(alias), metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		hashes[string(alias)] = meta_util.ObjectHash(secret)
+	}
+
+	h := fnv.New64a()
+	meta_util.DeepHashObject(h, hashes)
+	return strconv.FormatUint(h.Sum64(), 10), nil
+}
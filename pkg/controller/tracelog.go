@@ -0,0 +1,68 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"strconv"
+
+	"kubedb.dev/apimachinery/apis/kubedb"
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+
+	"github.com/appscode/go/log"
+)
+
+// logLevelAnnotation lets a single object opt into verbose reconcile logs
+// without raising the operator-wide -v flag.
+const logLevelAnnotation = kubedb.GroupName + "/log-level"
+
+// reconcileTracer emits step-by-step logs for one object's reconcile. Trace
+// lines are logged at Info level when the object carries a log-level
+// annotation of at least the debug verbosity, and at Debug level otherwise,
+// so without the annotation they follow the operator-wide -v flag.
+type reconcileTracer struct {
+	prefix  string
+	verbose bool
+}
+
+// newReconcileTracer reads the log-level annotation of the given object. An
+// unparsable value is ignored with a warning.
+func newReconcileTracer(px *api.PerconaXtraDB) reconcileTracer {
+	t := reconcileTracer{
+		prefix: fmt.Sprintf("PerconaXtraDB %v/%v: ", px.Namespace, px.Name),
+	}
+	raw, ok := px.Annotations[logLevelAnnotation]
+	if !ok {
+		return t
+	}
+	level, err := strconv.Atoi(raw)
+	if err != nil {
+		log.Warningf("%signoring annotation %s=%q: value is not an integer log level", t.prefix, logLevelAnnotation, raw)
+		return t
+	}
+	t.verbose = level >= int(log.LevelDebug)
+	return t
+}
+
+// Tracef logs one reconcile step.
+func (t reconcileTracer) Tracef(format string, args ...interface{}) {
+	if t.verbose {
+		log.Infof(t.prefix+format, args...)
+	} else {
+		log.Debugf(t.prefix+format, args...)
+	}
+}
@@ -0,0 +1,75 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+	"kubedb.dev/apimachinery/client/clientset/versioned/typed/kubedb/v1alpha2/util"
+
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kmapi "kmodules.xyz/client-go/api/v1"
+)
+
+// isVersionChanging reports whether the running StatefulSet still uses a
+// different database image than the one of the currently requested version.
+func (c *Controller) isVersionChanging(px *api.PerconaXtraDB, image string) (bool, error) {
+	sts, err := c.Client.AppsV1().StatefulSets(px.Namespace).Get(context.TODO(), px.OffshootName(), metav1.GetOptions{})
+	if err != nil {
+		if kerr.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	for _, container := range sts.Spec.Template.Spec.Containers {
+		if container.Name == api.ResourceSingularPerconaXtraDB {
+			return container.Image != image, nil
+		}
+	}
+	return false, nil
+}
+
+// prepareVersionUpdate marks the database as updating and injects a postStart
+// step that runs mysql_upgrade on each pod once it comes up with the new
+// image. A user-provided postStart hook runs after the upgrade step.
+func (c *Controller) prepareVersionUpdate(px *api.PerconaXtraDB) error {
+	upgradeCmd := `until mysqladmin -uroot -p"${MYSQL_ROOT_PASSWORD}" ping &>/dev/null; do sleep 1; done
+mysql_upgrade -uroot -p"${MYSQL_ROOT_PASSWORD}" || true`
+	if px.Spec.PodTemplate.Spec.Lifecycle == nil {
+		px.Spec.PodTemplate.Spec.Lifecycle = &core.Lifecycle{}
+	}
+	px.Spec.PodTemplate.Spec.Lifecycle.PostStart = mergeExecHook(px.Spec.PodTemplate.Spec.Lifecycle.PostStart, upgradeCmd, true)
+	return c.setUpdateCondition(px, api.DatabaseUpdating, "Database is rolling out a new version")
+}
+
+func (c *Controller) setUpdateCondition(px *api.PerconaXtraDB, condType, msg string) error {
+	per, err := util.UpdatePerconaXtraDBStatus(context.TODO(), c.DBClient.KubedbV1alpha2(), px.ObjectMeta, func(in *api.PerconaXtraDBStatus) *api.PerconaXtraDBStatus {
+		if condType == api.DatabaseUpdated {
+			in.Conditions = kmapi.RemoveCondition(in.Conditions, api.DatabaseUpdating)
+		}
+		in.Conditions = kmapi.SetCondition(in.Conditions, kmapi.NewCondition(condType, msg, px.Generation))
+		return in
+	}, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+	px.Status = per.Status
+	return nil
+}
@@ -0,0 +1,174 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+	"kubedb.dev/apimachinery/client/clientset/versioned/typed/kubedb/v1alpha2/util"
+
+	"github.com/appscode/go/log"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+	"gomodules.xyz/sets"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kmapi "kmodules.xyz/client-go/api/v1"
+	core_util "kmodules.xyz/client-go/core/v1"
+)
+
+const managedUsersKey = "users"
+
+func (c *Controller) managedUsersConfigMapName(px *api.PerconaXtraDB) string {
+	return px.OffshootName() + "-managed-users"
+}
+
+// reconcileUsers provisions the users declared in spec.users. It runs after
+// the database becomes ready, and failures surface as the "UsersReady"
+// condition instead of blocking the reconcile.
+func (c *Controller) reconcileUsers(px *api.PerconaXtraDB) {
+	err := c.syncUsers(px)
+	msg := "All users in spec.users have been provisioned"
+	if err != nil {
+		log.Errorln(err)
+		msg = err.Error()
+	}
+
+	per, serr := util.UpdatePerconaXtraDBStatus(context.TODO(), c.DBClient.KubedbV1alpha2(), px.ObjectMeta, func(in *api.PerconaXtraDBStatus) *api.PerconaXtraDBStatus {
+		in.Conditions = kmapi.SetCondition(in.Conditions, kmapi.NewCondition(api.DatabaseUsersReady, msg, px.Generation, err == nil))
+		return in
+	}, metav1.UpdateOptions{})
+	if serr != nil {
+		log.Errorln(serr)
+		return
+	}
+	px.Status = per.Status
+}
+
+func (c *Controller) syncUsers(px *api.PerconaXtraDB) error {
+	previous, err := c.previouslyManagedUsers(px)
+	if err != nil {
+		return err
+	}
+	if len(px.Spec.Users) == 0 && previous.Len() == 0 {
+		return nil
+	}
+
+	en, err := c.connectToPrimary(px)
+	if err != nil {
+		return err
+	}
+	defer en.Close()
+
+	current := sets.NewString()
+	for _, user := range px.Spec.Users {
+		current.Insert(user.Name)
+
+		secret, err := c.Client.CoreV1().Secrets(px.Namespace).Get(context.TODO(), user.PasswordSecret.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		password := string(secret.Data[core.BasicAuthPasswordKey])
+		if password == "" {
+			return errors.Errorf(`secret "%v/%v" is missing key %q`, px.Namespace, user.PasswordSecret.Name, core.BasicAuthPasswordKey)
+		}
+
+		if _, err := en.Exec(fmt.Sprintf("CREATE USER IF NOT EXISTS '%s'@'%%' IDENTIFIED BY %s", user.Name, quoteStringLiteral(password))); err != nil {
+			return errors.Wrapf(err, "failed to create user %q", user.Name)
+		}
+		// keep the password in sync if the referenced secret has been rotated
+		if _, err := en.Exec(fmt.Sprintf("ALTER USER '%s'@'%%' IDENTIFIED BY %s", user.Name, quoteStringLiteral(password))); err != nil {
+			return errors.Wrapf(err, "failed to update password of user %q", user.Name)
+		}
+		for _, grant := range user.Grants {
+			if _, err := en.Exec(fmt.Sprintf("GRANT %s TO '%s'@'%%'", grant, user.Name)); err != nil {
+				return errors.Wrapf(err, "failed to apply grant %q to user %q", grant, user.Name)
+			}
+		}
+	}
+
+	// drop users that were previously provisioned but have been removed from spec.users
+	for _, name := range previous.Difference(current).List() {
+		if _, err := en.Exec(fmt.Sprintf("DROP USER IF EXISTS '%s'@'%%'", name)); err != nil {
+			return errors.Wrapf(err, "failed to drop user %q", name)
+		}
+	}
+
+	if _, err := en.Exec("FLUSH PRIVILEGES"); err != nil {
+		return err
+	}
+
+	return c.recordManagedUsers(px, current)
+}
+
+func (c *Controller) connectToPrimary(px *api.PerconaXtraDB) (*sql.DB, error) {
+	secret, err := c.Client.CoreV1().Secrets(px.Namespace).Get(context.TODO(), px.GetDatabaseSecretName(), metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	en, err := sql.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s.%s.svc:%d)/%s",
+		string(secret.Data[core.BasicAuthUsernameKey]),
+		string(secret.Data[core.BasicAuthPasswordKey]),
+		px.ServiceName(), px.Namespace, px.SQLPort(),
+		c.dbDSNParams()))
+	if err != nil {
+		return nil, err
+	}
+	if err := en.Ping(); err != nil {
+		en.Close()
+		return nil, markTransientIfTimeout(err)
+	}
+	return en, nil
+}
+
+// previouslyManagedUsers returns the users provisioned by an earlier
+// reconcile, recorded in the managed-users ConfigMap.
+func (c *Controller) previouslyManagedUsers(px *api.PerconaXtraDB) (sets.String, error) {
+	cm, err := c.Client.CoreV1().ConfigMaps(px.Namespace).Get(context.TODO(), c.managedUsersConfigMapName(px), metav1.GetOptions{})
+	if err != nil {
+		if kerr.IsNotFound(err) {
+			return sets.NewString(), nil
+		}
+		return nil, err
+	}
+	return sets.NewString(strings.Fields(cm.Data[managedUsersKey])...), nil
+}
+
+func (c *Controller) recordManagedUsers(px *api.PerconaXtraDB, users sets.String) error {
+	owner := metav1.NewControllerRef(px, api.SchemeGroupVersion.WithKind(api.ResourceKindPerconaXtraDB))
+
+	meta := metav1.ObjectMeta{
+		Name:      c.managedUsersConfigMapName(px),
+		Namespace: px.Namespace,
+	}
+
+	_, _, err := core_util.CreateOrPatchConfigMap(context.TODO(), c.Client, meta, func(in *core.ConfigMap) *core.ConfigMap {
+		core_util.EnsureOwnerReference(&in.ObjectMeta, owner)
+		in.Labels = px.OffshootLabels()
+		in.Data = map[string]string{
+			managedUsersKey: strings.Join(users.List(), "\n"),
+		}
+		return in
+	}, metav1.PatchOptions{})
+	return err
+}
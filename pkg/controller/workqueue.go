@@ -30,9 +30,23 @@ import (
 	"kmodules.xyz/client-go/tools/queue"
 )
 
+// pausedAnnotation stops the controller from reconciling an object, for
+// debugging. Unlike "spec.halted", which scales the database down, a paused
+// object is left completely untouched: its StatefulSet keeps running. The
+// annotation takes precedence over "spec.halted", so a paused object is not
+// halted either until the annotation is removed.
+const pausedAnnotation = kubedb.GroupName + "/paused"
+
 func (c *Controller) initWatcher() {
 	c.pxInformer = c.KubedbInformerFactory.Kubedb().V1alpha2().PerconaXtraDBs().Informer()
-	c.pxQueue = queue.New("PerconaXtraDB", c.MaxNumRequeues, c.NumThreads, c.runPerconaXtraDB)
+	// the workqueue never hands the same key to two workers at once, so a
+	// higher worker count parallelizes across objects while reconciles of one
+	// object stay serialized
+	workers := c.reconcileWorkers
+	if workers <= 0 {
+		workers = c.NumThreads
+	}
+	c.pxQueue = queue.New("PerconaXtraDB", c.MaxNumRequeues, workers, c.runPerconaXtraDB)
 	c.pxLister = c.KubedbInformerFactory.Kubedb().V1alpha2().PerconaXtraDBs().Lister()
 	c.pxInformer.AddEventHandler(queue.NewChangeHandler(c.pxQueue.GetQueue()))
 }
@@ -76,18 +90,48 @@ func (c *Controller) runPerconaXtraDB(key string) error {
 				return nil
 			}
 
+			if _, ok := px.Annotations[pausedAnnotation]; ok {
+				log.Infof("Skipping reconciliation of paused PerconaXtraDB %v/%v", px.Namespace, px.Name)
+				return nil
+			}
+
+			// a repeatedly failing object is skipped until its spec changes
+			// or the resume annotation shows up
+			if c.reconcileBroken(px) {
+				log.Infof("Skipping reconciliation of halted PerconaXtraDB %v/%v; update the spec or add the %q annotation to resume",
+					px.Namespace, px.Name, resumeReconcileAnnotation)
+				return nil
+			}
+
 			if px.Spec.Halted {
 				if err := c.halt(px); err != nil {
 					log.Errorln(err)
 					c.pushFailureEvent(px, err.Error())
+					if c.breakReconcile(px, key, err) {
+						return nil
+					}
 					return err
 				}
 			} else {
 				if err := c.create(px); err != nil {
 					log.Errorln(err)
 					c.pushFailureEvent(px, err.Error())
+					// a briefly unreachable database is retried with
+					// exponential backoff instead of hammering the queue;
+					// terminal errors keep failing fast
+					if isTransientError(err) {
+						delay := c.nextBackoff(key)
+						log.Warningf("PerconaXtraDB %s is temporarily unreachable; retrying in %v", key, delay)
+						c.pxQueue.GetQueue().AddAfter(key, delay)
+						return nil
+					}
+					if c.breakReconcile(px, key, err) {
+						return nil
+					}
 					return err
 				}
+				c.clearBackoff(key)
+				c.clearReconcileFailures(key)
 			}
 		}
 	}
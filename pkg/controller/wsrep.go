@@ -0,0 +1,129 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+
+	api "kubedb.dev/apimachinery/apis/kubedb/v1alpha2"
+
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	core_util "kmodules.xyz/client-go/core/v1"
+	meta_util "kmodules.xyz/client-go/meta"
+)
+
+const (
+	wsrepConfigFileName        = "wsrep.cnf"
+	wsrepOptionsHashAnnotation = api.PerconaXtraDBKey + "/wsrep-options-hash"
+)
+
+func (c *Controller) wsrepConfigName(px *api.PerconaXtraDB) string {
+	return px.OffshootName() + "-wsrep-config"
+}
+
+// serializeWsrepProviderOptions renders spec.wsrepProviderOptions as the
+// semicolon separated string the Galera provider expects. Keys are sorted so
+// the output is stable across reconciles.
+func serializeWsrepProviderOptions(options map[string]string) string {
+	keys := make([]string, 0, len(options))
+	for key := range options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, key+"="+options[key])
+	}
+	return strings.Join(pairs, ";")
+}
+
+// galeraProviderOptions renders the complete wsrep_provider_options value:
+// the listen address derived from spec.replicationPort, when set, followed by
+// the user options from spec.wsrepProviderOptions.
+func galeraProviderOptions(px *api.PerconaXtraDB) string {
+	var parts []string
+	if px.Spec.ReplicationPort != nil {
+		parts = append(parts, fmt.Sprintf("gmcast.listen_addr=tcp://0.0.0.0:%d", px.GaleraReplicationPort()))
+	}
+	if len(px.Spec.WsrepProviderOptions) > 0 {
+		parts = append(parts, serializeWsrepProviderOptions(px.Spec.WsrepProviderOptions))
+	}
+	return strings.Join(parts, ";")
+}
+
+// wsrepOptionsHash returns a hash over the serialized provider options, used
+// to detect option changes on the running pod template.
+func wsrepOptionsHash(px *api.PerconaXtraDB) string {
+	h := fnv.New64a()
+	meta_util.DeepHashObject(h, galeraProviderOptions(px))
+	return strconv.FormatUint(h.Sum64(), 10)
+}
+
+// wsrepConfig renders the my.cnf snippet with the serialized
+// wsrep_provider_options.
+func wsrepConfig(px *api.PerconaXtraDB) string {
+	return fmt.Sprintf(`[mysqld]
+wsrep_provider_options="%v"
+`, galeraProviderOptions(px))
+}
+
+// ensureWsrepConfig creates a ConfigMap holding the my.cnf snippet with the
+// serialized wsrep_provider_options. It is only used for clusters without
+// replication TLS; with TLS the options ride along in the TLS snippet, as the
+// provider only honors the last wsrep_provider_options line it reads.
+func (c *Controller) ensureWsrepConfig(px *api.PerconaXtraDB) error {
+	owner := metav1.NewControllerRef(px, api.SchemeGroupVersion.WithKind(api.ResourceKindPerconaXtraDB))
+
+	cnf := wsrepConfig(px)
+
+	meta := metav1.ObjectMeta{
+		Name:      c.wsrepConfigName(px),
+		Namespace: px.Namespace,
+	}
+
+	_, _, err := core_util.CreateOrPatchConfigMap(context.TODO(), c.Client, meta, func(in *core.ConfigMap) *core.ConfigMap {
+		core_util.EnsureOwnerReference(&in.ObjectMeta, owner)
+		in.Labels = px.OffshootLabels()
+		in.Data = map[string]string{
+			wsrepConfigFileName: cnf,
+		}
+		return in
+	}, metav1.PatchOptions{})
+	return err
+}
+
+// isWsrepOptionsChanging reports whether the running StatefulSet still carries
+// wsrep provider options different from the requested ones, in which case the
+// new values have to be rolled out.
+func (c *Controller) isWsrepOptionsChanging(px *api.PerconaXtraDB) (bool, error) {
+	sts, err := c.Client.AppsV1().StatefulSets(px.Namespace).Get(context.TODO(), px.OffshootName(), metav1.GetOptions{})
+	if err != nil {
+		if kerr.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return sts.Spec.Template.Annotations[wsrepOptionsHashAnnotation] != px.Spec.PodTemplate.Annotations[wsrepOptionsHashAnnotation], nil
+}